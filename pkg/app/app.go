@@ -3,10 +3,19 @@ package app
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/denylist"
+	"github.com/Adedunmol/zephyr/pkg/directory"
+	"github.com/Adedunmol/zephyr/pkg/handlers"
 	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/mailer"
+	"github.com/Adedunmol/zephyr/pkg/oauth"
+	"github.com/Adedunmol/zephyr/pkg/password"
+	"github.com/Adedunmol/zephyr/pkg/ratelimit"
 	"github.com/Adedunmol/zephyr/pkg/routes"
+	"github.com/Adedunmol/zephyr/pkg/saml"
 )
 
 const PORT = 5001
@@ -19,6 +28,69 @@ func init() {
 	if err != nil {
 		helpers.Error.Fatal("Error loading .env file", err)
 	}
+
+	mailer.InitMailer()
+
+	if helpers.EnvConfig.SigningKeys != "" {
+		retired, err := helpers.ParseRetiredKeys(helpers.EnvConfig.RetiredKeys)
+
+		if err != nil {
+			helpers.Error.Fatal("Error loading signing keys", err)
+		}
+
+		helpers.Keys, err = helpers.LoadKeyManager(strings.Split(helpers.EnvConfig.SigningKeys, ","), helpers.EnvConfig.ActiveKeyID, retired)
+
+		if err != nil {
+			helpers.Error.Fatal("Error loading signing keys", err)
+		}
+	}
+
+	password.Default, err = password.FromConfig()
+
+	if err != nil {
+		helpers.Error.Fatal("Error configuring password hashing", err)
+	}
+
+	password.DefaultPolicy, err = password.PolicyFromConfig()
+
+	if err != nil {
+		helpers.Error.Fatal("Error loading password policy", err)
+	}
+
+	if helpers.EnvConfig.DenylistStore == "postgres" {
+		denylist.Default = denylist.NewPostgresStore(database.DB)
+	}
+
+	if helpers.EnvConfig.RateLimitStore == "postgres" {
+		ratelimit.Default = ratelimit.NewPostgresStore(database.DB)
+	}
+
+	if helpers.EnvConfig.GitHubClientID != "" {
+		oauth.Register(oauth.NewGitHub(helpers.EnvConfig.GitHubClientID, helpers.EnvConfig.GitHubClientSecret))
+	}
+
+	if helpers.EnvConfig.GoogleClientID != "" {
+		oauth.Register(oauth.NewGoogle(helpers.EnvConfig.GoogleClientID, helpers.EnvConfig.GoogleClientSecret))
+	}
+
+	// users the directory doesn't know still log in with their password.
+	if helpers.EnvConfig.LDAPURL != "" {
+		dir, err := directory.FromConfig()
+
+		if err != nil {
+			helpers.Error.Fatal("Error configuring the LDAP directory", err)
+		}
+
+		handlers.Authenticators = []handlers.Authenticator{handlers.NewLDAPAuthenticator(dir), handlers.PasswordAuthenticator{}}
+	}
+
+	if helpers.EnvConfig.SAMLCertificate != "" {
+		saml.Default, err = saml.FromConfig()
+
+		if err != nil {
+			helpers.Error.Fatal("Error loading the SAML key pair", err)
+		}
+	}
 }
 
 func Run() {
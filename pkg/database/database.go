@@ -3,6 +3,7 @@ package database
 import (
 	"github.com/Adedunmol/zephyr/pkg/helpers"
 	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/tenant"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -23,11 +24,19 @@ func InitDB() {
 		helpers.Error.Fatal("error connecting to db: %w", err)
 	}
 
+	if err := DB.Use(tenant.Plugin{}); err != nil {
+		helpers.Error.Fatal("error registering tenant plugin: ", err)
+	}
+
 	if helpers.EnvConfig.Environment != "test" {
 		DB.Logger = logger.Default.LogMode(logger.Info)
 
 		helpers.Info.Println("Running migrations")
 	}
 
-	DB.AutoMigrate(&models.User{})
+	DB.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.UserToken{}, &models.RecoveryCode{}, &models.Credential{}, &models.WebAuthnSession{}, &models.Permission{}, &models.Role{}, &models.Organization{}, &models.Membership{}, &models.Invitation{}, &models.RateLimitCounter{}, &models.Session{}, &models.APIKey{}, &models.LinkedIdentity{}, &models.Client{}, &models.AuthorizationRequest{}, &models.Consent{}, &models.SAMLProvider{})
+
+	if err := SeedRoles(DB); err != nil {
+		helpers.Error.Println("error seeding roles", err)
+	}
 }
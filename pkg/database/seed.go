@@ -0,0 +1,92 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"gorm.io/gorm"
+)
+
+var defaultPermissions = []models.Permission{
+	{Name: models.UsersReadPermission, Description: "View user accounts"},
+	{Name: models.UsersWritePermission, Description: "Manage user accounts"},
+	{Name: models.RolesReadPermission, Description: "View roles and role assignments"},
+	{Name: models.RolesWritePermission, Description: "Assign and remove roles"},
+	{Name: models.ClientsReadPermission, Description: "View registered OAuth clients"},
+	{Name: models.ClientsWritePermission, Description: "Register and remove OAuth clients"},
+}
+
+var defaultRoles = map[string][]string{
+	models.AdminRole: {models.UsersReadPermission, models.UsersWritePermission, models.RolesReadPermission, models.RolesWritePermission, models.ClientsReadPermission, models.ClientsWritePermission},
+	models.UserRole:  {},
+}
+
+var roleDescriptions = map[string]string{
+	models.AdminRole: "Full access to the admin endpoints",
+	models.UserRole:  "Default role given to every registered user",
+}
+
+// SeedRoles creates the default roles and permissions if they don't exist yet and
+// gives the admin role to the user with ADMIN_EMAIL, if any. It is safe to run on
+// every start.
+func SeedRoles(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		permissions := make(map[string]models.Permission, len(defaultPermissions))
+
+		for _, p := range defaultPermissions {
+			permission := p
+
+			result := tx.Where(models.Permission{Name: p.Name}).Attrs(models.Permission{Description: p.Description}).FirstOrCreate(&permission)
+
+			if result.Error != nil {
+				return result.Error
+			}
+
+			permissions[p.Name] = permission
+		}
+
+		for name, granted := range defaultRoles {
+			var role models.Role
+
+			result := tx.Where(models.Role{Name: name}).Attrs(models.Role{Description: roleDescriptions[name]}).FirstOrCreate(&role)
+
+			if result.Error != nil {
+				return result.Error
+			}
+
+			for _, name := range granted {
+				permission := permissions[name]
+
+				// the join rows are inserted with ON CONFLICT DO NOTHING.
+				if err := tx.Model(&role).Association("Permissions").Append(&permission); err != nil {
+					return err
+				}
+			}
+		}
+
+		if helpers.EnvConfig.AdminEmail == "" {
+			return nil
+		}
+
+		var admin models.User
+		var role models.Role
+
+		result := tx.Where(models.User{Email: helpers.EnvConfig.AdminEmail}).First(&admin)
+
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			helpers.Warning.Printf("admin user %s does not exist yet", helpers.EnvConfig.AdminEmail)
+			return nil
+		}
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result := tx.Where(models.Role{Name: models.AdminRole}).First(&role); result.Error != nil {
+			return result.Error
+		}
+
+		return tx.Model(&admin).Association("Roles").Append(&role)
+	})
+}
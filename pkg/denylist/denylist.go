@@ -0,0 +1,18 @@
+package denylist
+
+import (
+	"context"
+	"time"
+)
+
+// Store keeps track of revoked token IDs until they expire.
+type Store interface {
+	// Revoke denylists tokenID until expiresAt.
+	Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error
+	// IsRevoked reports whether tokenID has been revoked and is not yet expired.
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+}
+
+// Default is the store consulted by the auth middleware. It is replaced on startup
+// when a shared store is configured.
+var Default Store = NewMemoryStore()
@@ -0,0 +1,44 @@
+package denylist
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store local to the running process.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	tokens map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tokens: make(map[string]time.Time)}
+}
+
+func (s *MemoryStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	// drop the entries that can no longer be presented anyway.
+	for id, exp := range s.tokens {
+		if !exp.After(now) {
+			delete(s.tokens, id)
+		}
+	}
+
+	s.tokens[tokenID] = expiresAt
+
+	return nil
+}
+
+func (s *MemoryStore) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expiresAt, ok := s.tokens[tokenID]
+
+	return ok && expiresAt.After(time.Now()), nil
+}
@@ -0,0 +1,45 @@
+package denylist
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const checkMark = "\u2713"
+const ballotX = "\u2717"
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	t.Log("Given the need to test the in-memory denylist.")
+	{
+		t.Log("\tWhen checking a revoked token.")
+		{
+			if err := store.Revoke(ctx, "revoked", time.Now().Add(time.Minute)); err != nil {
+				t.Fatal("\t\tShould be able to revoke the token.", ballotX, err)
+			}
+
+			if revoked, _ := store.IsRevoked(ctx, "revoked"); !revoked {
+				t.Error("\t\tShould report the token as revoked.", ballotX)
+			}
+			t.Log("\t\tShould report the token as revoked.", checkMark)
+
+			if revoked, _ := store.IsRevoked(ctx, "other"); revoked {
+				t.Error("\t\tShould not report other tokens as revoked.", ballotX)
+			}
+			t.Log("\t\tShould not report other tokens as revoked.", checkMark)
+		}
+
+		t.Log("\tWhen checking an expired entry.")
+		{
+			store.Revoke(ctx, "expired", time.Now().Add(-time.Minute))
+
+			if revoked, _ := store.IsRevoked(ctx, "expired"); revoked {
+				t.Error("\t\tShould forget the token once it has expired.", ballotX)
+			}
+			t.Log("\t\tShould forget the token once it has expired.", checkMark)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package denylist
+
+import (
+	"context"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PostgresStore is a Store shared by every instance using the same database.
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	db := s.db.WithContext(ctx)
+
+	result := db.Where("expires_at <= ?", time.Now()).Delete(&models.RevokedToken{})
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	result = db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.RevokedToken{TokenID: tokenID, ExpiresAt: expiresAt})
+
+	return result.Error
+}
+
+func (s *PostgresStore) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	var count int64
+
+	result := s.db.WithContext(ctx).Model(&models.RevokedToken{}).
+		Where("token_id = ? AND expires_at > ?", tokenID, time.Now()).
+		Count(&count)
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return count > 0, nil
+}
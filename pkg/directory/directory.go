@@ -0,0 +1,314 @@
+package directory
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrUserNotFound       = errors.New("user not found in directory")
+	ErrInvalidCredentials = errors.New("invalid directory credentials")
+)
+
+// defaults for the LDAP_* settings, which suit OpenLDAP. Active Directory wants
+// sAMAccountName and objectGUID for the username and ID attributes.
+const (
+	DEFAULT_USER_FILTER        = "(&(objectClass=person)(mail={login}))"
+	DEFAULT_USERNAME_ATTRIBUTE = "uid"
+	DEFAULT_ID_ATTRIBUTE       = "entryUUID"
+	DEFAULT_TIMEOUT            = 10 * time.Second
+)
+
+// Directory checks logins against an LDAP server. It looks the user up with the
+// service account, then binds as them with their password.
+type Directory struct {
+	URL      string
+	StartTLS bool
+	// TLSConfig is used for ldaps:// URLs and StartTLS, nil meaning the defaults.
+	TLSConfig *tls.Config
+	// BindDN and BindPassword are the service account searching for users. Left
+	// empty, users are searched for anonymously.
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter finds the entry of a login, which replaces {login}.
+	UserFilter         string
+	EmailAttribute     string
+	UsernameAttribute  string
+	FirstNameAttribute string
+	LastNameAttribute  string
+	GroupAttribute     string
+	// IDAttribute never changes for an entry, unlike its DN. Binary values, such as
+	// objectGUID, are hex encoded.
+	IDAttribute string
+	Roles       GroupRoles
+	Timeout     time.Duration
+}
+
+// Entry is a user found in the directory.
+type Entry struct {
+	ID        string
+	DN        string
+	Email     string
+	Username  string
+	FirstName string
+	LastName  string
+	// Groups are the DNs of the groups the user is a member of.
+	Groups []string
+}
+
+// New returns a directory at url, finding users under baseDN with the default
+// filter and attributes.
+func New(serverURL, baseDN string) *Directory {
+	return &Directory{
+		URL:                serverURL,
+		BaseDN:             baseDN,
+		UserFilter:         DEFAULT_USER_FILTER,
+		EmailAttribute:     "mail",
+		UsernameAttribute:  DEFAULT_USERNAME_ATTRIBUTE,
+		FirstNameAttribute: "givenName",
+		LastNameAttribute:  "sn",
+		GroupAttribute:     "memberOf",
+		IDAttribute:        DEFAULT_ID_ATTRIBUTE,
+		Timeout:            DEFAULT_TIMEOUT,
+	}
+}
+
+// FromConfig returns the directory described by the LDAP_* settings, using the
+// defaults for anything left unset.
+func FromConfig() (*Directory, error) {
+	config := helpers.EnvConfig
+
+	if config.LDAPURL == "" || config.LDAPBaseDN == "" {
+		return nil, errors.New("LDAP_URL and LDAP_BASE_DN are required")
+	}
+
+	directory := New(config.LDAPURL, config.LDAPBaseDN)
+	directory.StartTLS = config.LDAPStartTLS
+	directory.BindDN = config.LDAPBindDN
+	directory.BindPassword = config.LDAPBindPassword
+
+	if config.LDAPUserFilter != "" {
+		directory.UserFilter = config.LDAPUserFilter
+	}
+
+	if config.LDAPUsernameAttribute != "" {
+		directory.UsernameAttribute = config.LDAPUsernameAttribute
+	}
+
+	if config.LDAPIDAttribute != "" {
+		directory.IDAttribute = config.LDAPIDAttribute
+	}
+
+	roles, err := ParseGroupRoles(config.LDAPGroupRoles)
+
+	if err != nil {
+		return nil, err
+	}
+
+	directory.Roles = roles
+
+	return directory, nil
+}
+
+func (d *Directory) dial() (*ldap.Conn, error) {
+	opts := []ldap.DialOpt{ldap.DialWithDialer(&net.Dialer{Timeout: d.Timeout})}
+
+	if d.TLSConfig != nil {
+		opts = append(opts, ldap.DialWithTLSConfig(d.TLSConfig))
+	}
+
+	conn, err := ldap.DialURL(d.URL, opts...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetTimeout(d.Timeout)
+
+	if d.StartTLS {
+		config := d.TLSConfig
+
+		if config == nil {
+			parsed, err := url.Parse(d.URL)
+
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+
+			config = &tls.Config{ServerName: parsed.Hostname()}
+		}
+
+		if err := conn.StartTLS(config); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// Authenticate checks the password of the user login finds. It returns
+// ErrUserNotFound when there is no such user, so that other ways of logging in can be
+// tried, and ErrInvalidCredentials when the password is wrong.
+func (d *Directory) Authenticate(login, password string) (*Entry, error) {
+	conn, err := d.dial()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	if d.BindDN != "" {
+		if err := conn.Bind(d.BindDN, d.BindPassword); err != nil {
+			return nil, fmt.Errorf("binding as the service account: %w", err)
+		}
+	}
+
+	attributes := []string{d.EmailAttribute, d.UsernameAttribute, d.FirstNameAttribute, d.LastNameAttribute, d.GroupAttribute, d.IDAttribute}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		d.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(d.Timeout.Seconds()), false,
+		strings.ReplaceAll(d.UserFilter, "{login}", ldap.EscapeFilter(login)),
+		attributes, nil,
+	))
+
+	// a filter matching several users is a mistake in the configuration, which
+	// mustn't let any of them in.
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) || (err == nil && len(result.Entries) > 1) {
+		return nil, fmt.Errorf("more than one entry matches %q", login)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Entries) == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	// servers take a simple bind without a password as an anonymous one, which
+	// succeeds.
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	found := result.Entries[0]
+
+	if err := conn.Bind(found.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+
+		return nil, err
+	}
+
+	entry := &Entry{
+		ID:        found.DN,
+		DN:        found.DN,
+		Email:     found.GetAttributeValue(d.EmailAttribute),
+		Username:  found.GetAttributeValue(d.UsernameAttribute),
+		FirstName: found.GetAttributeValue(d.FirstNameAttribute),
+		LastName:  found.GetAttributeValue(d.LastNameAttribute),
+		Groups:    found.GetAttributeValues(d.GroupAttribute),
+	}
+
+	if id := found.GetRawAttributeValue(d.IDAttribute); len(id) > 0 {
+		if utf8.Valid(id) {
+			entry.ID = string(id)
+		} else {
+			entry.ID = hex.EncodeToString(id)
+		}
+	}
+
+	return entry, nil
+}
+
+// GroupRole gives Role to the members of Group.
+type GroupRole struct {
+	Group *ldap.DN
+	Role  string
+}
+
+// GroupRoles map directory groups to roles.
+type GroupRoles []GroupRole
+
+// ParseGroupRoles reads mappings written as "<group DN>:<role>", separated by
+// semicolons.
+func ParseGroupRoles(s string) (GroupRoles, error) {
+	var roles GroupRoles
+
+	for _, mapping := range strings.Split(s, ";") {
+		mapping = strings.TrimSpace(mapping)
+
+		if mapping == "" {
+			continue
+		}
+
+		i := strings.LastIndex(mapping, ":")
+
+		if i < 0 || strings.TrimSpace(mapping[i+1:]) == "" {
+			return nil, fmt.Errorf("group role mapping %q has no role", mapping)
+		}
+
+		group, err := ldap.ParseDN(strings.TrimSpace(mapping[:i]))
+
+		if err != nil {
+			return nil, fmt.Errorf("group role mapping %q: %w", mapping, err)
+		}
+
+		roles = append(roles, GroupRole{Group: group, Role: strings.TrimSpace(mapping[i+1:])})
+	}
+
+	return roles, nil
+}
+
+// Resolve returns the roles the members of groups get, and the mapped roles they
+// don't, which are to be taken away. Roles that aren't mapped are in neither.
+func (g GroupRoles) Resolve(groups []string) (granted, revoked []string) {
+	member := make(map[string]bool)
+
+	for _, mapping := range g {
+		if _, ok := member[mapping.Role]; !ok {
+			member[mapping.Role] = false
+		}
+
+		for _, group := range groups {
+			dn, err := ldap.ParseDN(group)
+
+			if err == nil && mapping.Group.EqualFold(dn) {
+				member[mapping.Role] = true
+			}
+		}
+	}
+
+	for _, mapping := range g {
+		isMember, ok := member[mapping.Role]
+
+		if !ok {
+			continue
+		}
+
+		if isMember {
+			granted = append(granted, mapping.Role)
+		} else {
+			revoked = append(revoked, mapping.Role)
+		}
+
+		delete(member, mapping.Role)
+	}
+
+	return granted, revoked
+}
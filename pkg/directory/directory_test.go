@@ -0,0 +1,355 @@
+package directory
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const checkMark = "\u2713"
+const ballotX = "\u2717"
+
+type fakeEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// fakeServer is just enough of an LDAP server for Directory: simple binds, and
+// searches for the filters the tests use. Like real servers, it takes a bind without
+// a password as an anonymous one.
+type fakeServer struct {
+	listener        net.Listener
+	serviceDN       string
+	servicePassword string
+	entries         []fakeEntry
+}
+
+func newFakeServer(t *testing.T, entries ...fakeEntry) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal("Should be able to start the fake LDAP server.", ballotX, err)
+	}
+
+	server := &fakeServer{listener: listener, serviceDN: "cn=zephyr,dc=example,dc=com", servicePassword: "service secret", entries: entries}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go server.serve(conn)
+		}
+	}()
+
+	t.Cleanup(func() { listener.Close() })
+
+	return server
+}
+
+func (s *fakeServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	bound := ""
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+
+		id := packet.Children[0].Value
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			name := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+
+			var code uint16 = ldap.LDAPResultInvalidCredentials
+
+			switch {
+			case password == "":
+				bound, code = "", ldap.LDAPResultSuccess
+			case name == s.serviceDN && password == s.servicePassword:
+				bound, code = name, ldap.LDAPResultSuccess
+			default:
+				for _, entry := range s.entries {
+					if entry.dn == name && entry.password == password {
+						bound, code = name, ldap.LDAPResultSuccess
+					}
+				}
+			}
+
+			s.respond(conn, id, ldap.ApplicationBindResponse, code)
+		case ldap.ApplicationSearchRequest:
+			if bound != s.serviceDN {
+				s.respond(conn, id, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights)
+				continue
+			}
+
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+
+			for _, entry := range s.entries {
+				if !s.matches(filter, entry) {
+					continue
+				}
+
+				var requested []string
+
+				for _, attribute := range op.Children[7].Children {
+					requested = append(requested, attribute.Value.(string))
+				}
+
+				conn.Write(envelope(id, searchResultEntry(entry, requested)).Bytes())
+			}
+
+			s.respond(conn, id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)
+		default:
+			return
+		}
+	}
+}
+
+// matches supports filters on mail, and objectClass=person alone, which matches
+// everyone.
+func (s *fakeServer) matches(filter string, entry fakeEntry) bool {
+	if filter == "(objectClass=person)" || strings.Contains(filter, "(mail=*)") {
+		return true
+	}
+
+	for _, mail := range entry.attributes["mail"] {
+		if strings.Contains(filter, "(mail="+mail+")") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *fakeServer) respond(conn net.Conn, id interface{}, tag ber.Tag, code uint16) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+
+	conn.Write(envelope(id, op).Bytes())
+}
+
+func envelope(id interface{}, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	packet.AppendChild(op)
+
+	return packet
+}
+
+func searchResultEntry(entry fakeEntry, requested []string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, ""))
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+
+	for _, name := range requested {
+		values, ok := entry.attributes[name]
+
+		if !ok {
+			continue
+		}
+
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+		}
+
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+
+	op.AppendChild(attributes)
+
+	return op
+}
+
+func TestAuthenticate(t *testing.T) {
+	ada := fakeEntry{
+		dn:       "uid=ada,ou=people,dc=example,dc=com",
+		password: "analytical engine",
+		attributes: map[string][]string{
+			"mail":      {"ada@example.com"},
+			"uid":       {"ada"},
+			"givenName": {"Ada"},
+			"sn":        {"Lovelace"},
+			"memberOf":  {"cn=admins,ou=groups,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"},
+			"entryUUID": {"5c0ad2a4-8d1b-4e51-9a4c-3f2b1e0d9c8a"},
+		},
+	}
+
+	charles := fakeEntry{
+		dn:         "uid=charles,ou=people,dc=example,dc=com",
+		password:   "difference engine",
+		attributes: map[string][]string{"mail": {"charles@example.com"}},
+	}
+
+	server := newFakeServer(t, ada, charles)
+
+	directory := New(server.URL(), "dc=example,dc=com")
+	directory.BindDN = server.serviceDN
+	directory.BindPassword = server.servicePassword
+
+	t.Log("Given the need to test logging in with directory credentials.")
+	{
+		t.Log("\tWhen the password is right.")
+		{
+			entry, err := directory.Authenticate("ada@example.com", "analytical engine")
+
+			if err != nil {
+				t.Fatal("\t\tShould find the user.", ballotX, err)
+			}
+			t.Log("\t\tShould find the user.", checkMark)
+
+			if entry.DN != ada.dn || entry.Email != "ada@example.com" || entry.Username != "ada" || entry.FirstName != "Ada" || entry.LastName != "Lovelace" {
+				t.Errorf("\t\tShould read the user's attributes, but got %+v. %v", entry, ballotX)
+			}
+			t.Log("\t\tShould read the user's attributes.", checkMark)
+
+			if entry.ID != "5c0ad2a4-8d1b-4e51-9a4c-3f2b1e0d9c8a" {
+				t.Errorf("\t\tShould identify the user by their entryUUID, but got %q. %v", entry.ID, ballotX)
+			}
+			t.Log("\t\tShould identify the user by their entryUUID.", checkMark)
+
+			if len(entry.Groups) != 2 {
+				t.Errorf("\t\tShould read the user's groups, but got %v. %v", entry.Groups, ballotX)
+			}
+			t.Log("\t\tShould read the user's groups.", checkMark)
+		}
+
+		t.Log("\tWhen the entry has no ID attribute.")
+		{
+			entry, err := directory.Authenticate("charles@example.com", "difference engine")
+
+			if err != nil || entry.ID != charles.dn {
+				t.Errorf("\t\tShould fall back to the DN, but got %+v %v. %v", entry, err, ballotX)
+			}
+			t.Log("\t\tShould fall back to the DN.", checkMark)
+		}
+
+		t.Log("\tWhen the password is wrong.")
+		{
+			if _, err := directory.Authenticate("ada@example.com", "difference engine"); !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("\t\tShould reject the credentials, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould reject the credentials.", checkMark)
+		}
+
+		t.Log("\tWhen the password is empty.")
+		{
+			if _, err := directory.Authenticate("ada@example.com", ""); !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("\t\tShould not take the anonymous bind for a login, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould not take the anonymous bind for a login.", checkMark)
+		}
+
+		t.Log("\tWhen the user isn't in the directory.")
+		{
+			if _, err := directory.Authenticate("grace@example.com", "compiler"); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("\t\tShould say the user wasn't found, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould say the user wasn't found.", checkMark)
+		}
+
+		t.Log("\tWhen the login contains filter syntax.")
+		{
+			if _, err := directory.Authenticate("*", "analytical engine"); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("\t\tShould escape it, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould escape it.", checkMark)
+		}
+
+		t.Log("\tWhen the filter matches several users.")
+		{
+			loose := *directory
+			loose.UserFilter = "(objectClass=person)"
+
+			if _, err := loose.Authenticate("ada@example.com", "analytical engine"); err == nil || errors.Is(err, ErrUserNotFound) {
+				t.Errorf("\t\tShould refuse to pick one, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould refuse to pick one.", checkMark)
+		}
+
+		t.Log("\tWhen the service account password is wrong.")
+		{
+			misconfigured := *directory
+			misconfigured.BindPassword = "wrong"
+
+			if _, err := misconfigured.Authenticate("ada@example.com", "analytical engine"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("\t\tShould fail without blaming the user, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould fail without blaming the user.", checkMark)
+		}
+	}
+}
+
+func TestGroupRoles(t *testing.T) {
+	t.Log("Given the need to test mapping directory groups to roles.")
+	{
+		roles, err := ParseGroupRoles("cn=admins,ou=groups,dc=example,dc=com:admin; cn=root,ou=groups,dc=example,dc=com:admin; cn=auditors,ou=groups,dc=example,dc=com:auditor")
+
+		t.Log("\tWhen parsing mappings.")
+		{
+			if err != nil || len(roles) != 3 {
+				t.Fatalf("\t\tShould read every mapping, but got %v %v. %v", roles, err, ballotX)
+			}
+			t.Log("\t\tShould read every mapping.", checkMark)
+
+			for _, bad := range []string{"cn=admins,ou=groups,dc=example,dc=com", "cn=admins,ou=groups:", "not a dn:admin"} {
+				if _, err := ParseGroupRoles(bad); err == nil {
+					t.Errorf("\t\tShould reject %q. %v", bad, ballotX)
+				}
+			}
+			t.Log("\t\tShould reject malformed mappings.", checkMark)
+		}
+
+		t.Log("\tWhen the user is a member of a mapped group.")
+		{
+			granted, revoked := roles.Resolve([]string{"CN=Root, OU=Groups, DC=Example, DC=Com", "cn=staff,ou=groups,dc=example,dc=com"})
+
+			if len(granted) != 1 || granted[0] != "admin" {
+				t.Errorf("\t\tShould grant the role whatever the case and spacing of the DN, but got %v. %v", granted, ballotX)
+			}
+			t.Log("\t\tShould grant the role whatever the case and spacing of the DN.", checkMark)
+
+			if len(revoked) != 1 || revoked[0] != "auditor" {
+				t.Errorf("\t\tShould revoke the roles of the other mapped groups, but got %v. %v", revoked, ballotX)
+			}
+			t.Log("\t\tShould revoke the roles of the other mapped groups.", checkMark)
+		}
+
+		t.Log("\tWhen the user is in no mapped group.")
+		{
+			granted, revoked := roles.Resolve(nil)
+
+			if len(granted) != 0 || len(revoked) != 2 {
+				t.Errorf("\t\tShould revoke every mapped role once, but got %v %v. %v", granted, revoked, ballotX)
+			}
+			t.Log("\t\tShould revoke every mapped role once.", checkMark)
+		}
+	}
+}
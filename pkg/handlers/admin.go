@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/schema"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+const DEFAULT_PAGE_SIZE = 50
+const MAX_PAGE_SIZE = 100
+
+// pagination reads the page and page_size query parameters.
+func pagination(r *http.Request) (int, int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	size, err := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if err != nil || size < 1 {
+		size = DEFAULT_PAGE_SIZE
+	}
+
+	if size > MAX_PAGE_SIZE {
+		size = MAX_PAGE_SIZE
+	}
+
+	return page, size
+}
+
+// userFromURL loads the user named by the {id} URL parameter along with their roles.
+func userFromURL(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+
+	if err != nil {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "user does not exist", Data: nil, Status: "error"})
+		return nil, false
+	}
+
+	var user models.User
+
+	result := database.DB.Preload("Roles").First(&user, id)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "user does not exist", Data: nil, Status: "error"})
+			return nil, false
+		}
+
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load user", Data: nil, Status: "error"})
+		return nil, false
+	}
+
+	return &user, true
+}
+
+func ListRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles := []models.Role{}
+
+	result := database.DB.Preload("Permissions").Order("name").Find(&roles)
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load roles", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: roles, Status: "success"})
+}
+
+func ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	page, size := pagination(r)
+
+	users := []models.User{}
+
+	result := database.DB.Preload("Roles").Order("id").Offset((page - 1) * size).Limit(size).Find(&users)
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load users", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: users, Status: "success"})
+}
+
+func GetUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromURL(w, r)
+
+	if !ok {
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: user.Roles, Status: "success"})
+}
+
+func AssignRoleHandler(w http.ResponseWriter, r *http.Request) {
+	data, problems, err := helpers.DecodeJSON[*schema.AssignRole](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	user, ok := userFromURL(w, r)
+
+	if !ok {
+		return
+	}
+
+	var role models.Role
+
+	result := database.DB.Where(models.Role{Name: data.Role}).First(&role)
+
+	if result.Error != nil {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "role does not exist", Data: nil, Status: "error"})
+		return
+	}
+
+	if err := database.DB.Model(user).Association("Roles").Append(&role); err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to assign role", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.Info.Printf("role %s assigned to user %d", role.Name, user.ID)
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "role assigned", Data: user.Roles, Status: "success"})
+}
+
+func RemoveRoleHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromURL(w, r)
+
+	if !ok {
+		return
+	}
+
+	name := chi.URLParam(r, "role")
+
+	if !user.HasRole(name) {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "user does not have the role", Data: nil, Status: "error"})
+		return
+	}
+
+	var role models.Role
+
+	result := database.DB.Where(models.Role{Name: name}).First(&role)
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load role", Data: nil, Status: "error"})
+		return
+	}
+
+	// nobody would be left to hand the role out again.
+	if role.Name == models.AdminRole {
+		var admins int64
+
+		result = database.DB.Table("user_roles").Where("role_id = ?", role.ID).Count(&admins)
+
+		if result.Error != nil {
+			helpers.Error.Println(result.Error)
+			helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load role", Data: nil, Status: "error"})
+			return
+		}
+
+		if admins <= 1 {
+			helpers.RespondWithJSON(w, http.StatusConflict, helpers.APIResponse{Message: "cannot remove the last admin", Data: nil, Status: "error"})
+			return
+		}
+	}
+
+	if err := database.DB.Model(user).Association("Roles").Delete(&role); err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to remove role", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.Info.Printf("role %s removed from user %d", role.Name, user.ID)
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "role removed", Data: user.Roles, Status: "success"})
+}
+
+// UnlockUserHandler lifts a login lockout and forgets the user's failed attempts.
+func UnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromURL(w, r)
+
+	if !ok {
+		return
+	}
+
+	result := database.DB.Model(&models.User{}).
+		Where("id = ?", user.ID).
+		UpdateColumns(map[string]interface{}{"failed_logins": 0, "locked_until": nil})
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to unlock user", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.Info.Printf("user %d unlocked", user.ID)
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "user unlocked", Data: nil, Status: "success"})
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/schema"
+	"github.com/go-chi/chi/v5"
+)
+
+type apiKeyResponse struct {
+	models.APIKey
+	// Key is only ever shown when the key is created.
+	Key string `json:"key"`
+}
+
+// grantableScope reports whether user may give scope to a key: the general scopes
+// and the permissions the user holds.
+func grantableScope(user *models.User, scope string) bool {
+	return scope == models.ReadScope || scope == models.WriteScope || user.HasPermission(scope)
+}
+
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	data, problems, err := helpers.DecodeJSON[*schema.CreateAPIKey](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	for _, scope := range data.Scopes {
+		if !grantableScope(principal.User, scope) {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: map[string]string{"Scopes": fmt.Sprintf("Field 'Scopes': '%s' is not a scope you can grant", scope)}})
+			return
+		}
+	}
+
+	key, prefix, err := helpers.GenerateAPIKey()
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to create API key", Data: nil, Status: "error"})
+		return
+	}
+
+	_, secret, _ := helpers.ParseAPIKey(key)
+
+	apiKey := models.APIKey{
+		UserID:     principal.User.ID,
+		Name:       data.Name,
+		Prefix:     prefix,
+		SecretHash: helpers.HashToken(secret),
+		Scopes:     data.Scopes,
+		ExpiresAt:  data.ExpiresAt,
+	}
+
+	// keys act in the organization the user is working in when creating them.
+	if principal.Claims.Organization != 0 {
+		organization := principal.Claims.Organization
+		apiKey.OrganizationID = &organization
+	}
+
+	if result := database.DB.Create(&apiKey); result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to create API key", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusCreated, helpers.APIResponse{Message: "store the key now, it won't be shown again", Data: apiKeyResponse{APIKey: apiKey, Key: key}, Status: "success"})
+}
+
+func ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	keys := []models.APIKey{}
+
+	result := database.DB.
+		Where("user_id = ? AND revoked_at IS NULL", principal.User.ID).
+		Order("created_at").
+		Find(&keys)
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load API keys", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: keys, Status: "success"})
+}
+
+func RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+
+	if err != nil {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "API key does not exist", Data: nil, Status: "error"})
+		return
+	}
+
+	result := database.DB.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, principal.User.ID).
+		Update("revoked_at", time.Now())
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to revoke API key", Data: nil, Status: "error"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "API key does not exist", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "API key revoked", Data: nil, Status: "success"})
+}
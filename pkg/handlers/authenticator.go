@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/password"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownAccount     = errors.New("unknown account")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Authenticator checks the email and password of a login.
+type Authenticator interface {
+	// Authenticate returns the user the credentials belong to. It returns
+	// ErrUnknownAccount when it doesn't know the email, so that the next authenticator
+	// is tried, and ErrInvalidCredentials when the password is wrong.
+	Authenticate(ctx context.Context, email, password string) (*models.User, error)
+}
+
+// Authenticators are tried in turn by LoginUserHandler. They are replaced on startup
+// when a directory is configured.
+var Authenticators = []Authenticator{PasswordAuthenticator{}}
+
+// authenticate asks each of authenticators in turn, until one knows the email.
+func authenticate(ctx context.Context, authenticators []Authenticator, email, password string) (*models.User, error) {
+	for _, authenticator := range authenticators {
+		user, err := authenticator.Authenticate(ctx, email, password)
+
+		if errors.Is(err, ErrUnknownAccount) {
+			continue
+		}
+
+		return user, err
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+// PasswordAuthenticator checks the password hashes stored with users.
+type PasswordAuthenticator struct{}
+
+// Authenticate takes as long for unknown emails as for known ones. Hashes made with
+// older parameters are replaced once the password is known to match.
+func (PasswordAuthenticator) Authenticate(ctx context.Context, email, plaintext string) (*models.User, error) {
+	var user models.User
+
+	result := database.DB.Where(models.User{Email: email}).First(&user)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		compareDummyPassword(plaintext)
+		return nil, ErrUnknownAccount
+	}
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	matched, rehash, err := password.Verify(plaintext, user.Password)
+
+	// users who signed up through a provider have no password to check.
+	if err != nil && user.Password != "" {
+		helpers.Error.Printf("could not check password of user %d: %v", user.ID, err)
+	}
+
+	if !matched {
+		return nil, ErrInvalidCredentials
+	}
+
+	if rehash {
+		if err := rehashPassword(&user, plaintext); err != nil {
+			helpers.Error.Println(err)
+		}
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Adedunmol/zephyr/pkg/directory"
+	"github.com/Adedunmol/zephyr/pkg/models"
+)
+
+// authenticatorFunc lets a function stand in for an Authenticator.
+type authenticatorFunc func(email, password string) (*models.User, error)
+
+func (f authenticatorFunc) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	return f(email, password)
+}
+
+func TestAuthenticate(t *testing.T) {
+	errDirectoryDown := errors.New("directory down")
+
+	unknown := authenticatorFunc(func(email, password string) (*models.User, error) {
+		return nil, ErrUnknownAccount
+	})
+
+	invalid := authenticatorFunc(func(email, password string) (*models.User, error) {
+		return nil, ErrInvalidCredentials
+	})
+
+	failing := authenticatorFunc(func(email, password string) (*models.User, error) {
+		return nil, errDirectoryDown
+	})
+
+	valid := authenticatorFunc(func(email, password string) (*models.User, error) {
+		return &models.User{Email: email}, nil
+	})
+
+	tests := []struct {
+		name           string
+		authenticators []Authenticator
+		err            error
+	}{
+		{"the first authenticator knows the account", []Authenticator{valid, invalid}, nil},
+		{"only a later authenticator knows the account", []Authenticator{unknown, valid}, nil},
+		{"an earlier authenticator rejects the password", []Authenticator{invalid, valid}, ErrInvalidCredentials},
+		{"an earlier authenticator fails", []Authenticator{failing, valid}, errDirectoryDown},
+		{"no authenticator knows the account", []Authenticator{unknown, unknown}, ErrInvalidCredentials},
+	}
+
+	t.Log("Given the need to test trying authenticators in turn.")
+	{
+		for _, tt := range tests {
+			t.Logf("\tWhen %s.", tt.name)
+			{
+				user, err := authenticate(context.Background(), tt.authenticators, "ada@example.com", "analytical engine")
+
+				if !errors.Is(err, tt.err) || (err == nil && user == nil) {
+					t.Errorf("\t\tShould answer %v, but got %v %v. %v", tt.err, user, err, ballotX)
+				}
+				t.Logf("\t\tShould answer %v. %v", tt.err, checkMark)
+			}
+		}
+	}
+}
+
+func TestLDAPAuthenticatorOutage(t *testing.T) {
+	// nothing listens on port 1, so every login fails to dial.
+	unreachable := directory.New("ldap://127.0.0.1:1", "dc=example,dc=com")
+
+	tests := []struct {
+		name   string
+		linked bool
+		err    error
+	}{
+		{"the account was never linked to the directory", false, ErrUnknownAccount},
+		{"the account is linked to the directory", true, nil},
+	}
+
+	t.Log("Given the need to test logins while the directory is unreachable.")
+	{
+		for _, tt := range tests {
+			t.Logf("\tWhen %s.", tt.name)
+			{
+				authenticator := &LDAPAuthenticator{Directory: unreachable, linked: func(email string) (bool, error) {
+					return tt.linked, nil
+				}}
+
+				_, err := authenticator.Authenticate(context.Background(), "ada@example.com", "analytical engine")
+
+				switch {
+				case tt.err != nil && !errors.Is(err, tt.err):
+					t.Errorf("\t\tShould answer %v, but got %v. %v", tt.err, err, ballotX)
+				case tt.err == nil && (err == nil || errors.Is(err, ErrUnknownAccount)):
+					t.Errorf("\t\tShould fail the login, but got %v. %v", err, ballotX)
+				}
+				t.Log("\t\tShould only let the next authenticator try unlinked accounts.", checkMark)
+			}
+		}
+	}
+}
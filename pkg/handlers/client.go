@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/oidc"
+	"github.com/Adedunmol/zephyr/pkg/schema"
+	"github.com/go-chi/chi/v5"
+)
+
+type clientResponse struct {
+	models.Client
+	// Secret is only ever shown when a confidential client is registered.
+	Secret string `json:"client_secret,omitempty"`
+}
+
+// clientScope reports whether principal may register a client for grantTypes with
+// scope: the OpenID Connect scopes to sign users in, and for services the permissions
+// principal holds itself.
+func clientScope(principal *middleware.Principal, grantTypes models.Scopes, scope string) bool {
+	if _, ok := oidc.ScopeDescriptions[scope]; ok {
+		return grantTypes.Has(models.AuthorizationCodeGrant)
+	}
+
+	return grantTypes.Has(models.ClientCredentialsGrant) && principal.HasPermission(scope)
+}
+
+func CreateClientHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	data, problems, err := helpers.DecodeJSON[*schema.CreateClient](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	grantTypes := models.Scopes(data.Grants())
+
+	for _, scope := range data.Scopes {
+		if !clientScope(principal, grantTypes, scope) {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: map[string]string{"Scopes": fmt.Sprintf("Field 'Scopes': '%s' is not a scope you can grant to this client", scope)}})
+			return
+		}
+	}
+
+	clientID, err := helpers.GenerateRandomString(16)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to register client", Data: nil, Status: "error"})
+		return
+	}
+
+	client := models.Client{
+		ClientID:     clientID,
+		Name:         data.Name,
+		RedirectURIs: data.RedirectURIs,
+		Scopes:       data.Scopes,
+		GrantTypes:   grantTypes,
+	}
+
+	var secret string
+
+	if data.Confidential {
+		secret, err = helpers.GenerateRandomString(32)
+
+		if err != nil {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to register client", Data: nil, Status: "error"})
+			return
+		}
+
+		client.SecretHash = helpers.HashToken(secret)
+	}
+
+	if result := database.DB.Create(&client); result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to register client", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusCreated, helpers.APIResponse{Message: "client registered", Data: clientResponse{Client: client, Secret: secret}, Status: "success"})
+}
+
+func ListClientsHandler(w http.ResponseWriter, r *http.Request) {
+	page, size := pagination(r)
+
+	clients := []models.Client{}
+
+	result := database.DB.Order("id").Offset((page - 1) * size).Limit(size).Find(&clients)
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load clients", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: clients, Status: "success"})
+}
+
+// DeleteClientHandler removes a client. Codes it hasn't exchanged yet can't be used
+// anymore, since exchanging them needs the client.
+func DeleteClientHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+
+	if err != nil {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "client does not exist", Data: nil, Status: "error"})
+		return
+	}
+
+	result := database.DB.Delete(&models.Client{}, id)
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to delete client", Data: nil, Status: "error"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "client does not exist", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "client deleted", Data: nil, Status: "success"})
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/denylist"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/oidc"
+	"gorm.io/gorm"
+)
+
+// introspectedTypes are the JWTs the introspection and revocation endpoints know
+// about. MFA and magic link tokens never leave the login flow.
+var introspectedTypes = []string{helpers.AccessTokenType, helpers.OAuthAccessTokenType, helpers.ServiceTokenType, helpers.RefreshTokenType}
+
+// findAPIKey returns the key with the secret key, whether or not it is still active.
+func findAPIKey(key string) (*models.APIKey, error) {
+	prefix, secret, ok := helpers.ParseAPIKey(key)
+
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var apiKey models.APIKey
+
+	if result := database.DB.Preload("User").Where(models.APIKey{Prefix: prefix}).First(&apiKey); result.Error != nil {
+		return nil, result.Error
+	}
+
+	if subtle.ConstantTimeCompare([]byte(helpers.HashToken(secret)), []byte(apiKey.SecretHash)) != 1 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return &apiKey, nil
+}
+
+// findRefreshToken returns the stored refresh token claims were issued for, if it can
+// still be used.
+func findRefreshToken(claims *helpers.Claims) (*models.RefreshToken, error) {
+	var storedToken models.RefreshToken
+
+	result := database.DB.Where(models.RefreshToken{TokenID: claims.ID}).First(&storedToken)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	// refresh tokens are single use, a used one has been rotated.
+	if storedToken.Family != claims.Family || storedToken.RevokedAt != nil || storedToken.UsedAt != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	return &storedToken, nil
+}
+
+// introspect describes token if it is active. It makes the same checks as the
+// endpoints accepting the token would, so revoking a token, its session or the user's
+// other logins shows here straight away. An error is only returned when the checks
+// couldn't be made.
+func introspect(ctx context.Context, token string) (oidc.Introspection, error) {
+	if strings.HasPrefix(token, helpers.API_KEY_PREFIX) {
+		return introspectAPIKey(token)
+	}
+
+	claims, err := helpers.ParseToken(token, introspectedTypes...)
+
+	if err != nil {
+		return oidc.Introspection{}, nil
+	}
+
+	if claims.Type == helpers.RefreshTokenType {
+		if _, err := findRefreshToken(claims); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return oidc.Introspection{}, nil
+			}
+
+			return oidc.Introspection{}, err
+		}
+	} else {
+		revoked, err := denylist.Default.IsRevoked(ctx, claims.ID)
+
+		if err != nil || revoked {
+			return oidc.Introspection{}, err
+		}
+	}
+
+	introspection := oidc.Introspection{
+		Active:   true,
+		Scope:    claims.Scope,
+		ClientID: claims.ClientID,
+		Issuer:   issuer(),
+		TokenID:  claims.ID,
+	}
+
+	introspection.SetTimes(claims.IssuedAt.Time, &claims.ExpiresAt.Time)
+
+	if claims.Type != helpers.RefreshTokenType {
+		introspection.TokenType = "Bearer"
+	}
+
+	if claims.Type == helpers.ServiceTokenType {
+		if claims.ClientID == "" {
+			return oidc.Introspection{}, nil
+		}
+
+		var client models.Client
+
+		result := database.DB.Where(models.Client{ClientID: claims.ClientID}).First(&client)
+
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return oidc.Introspection{}, nil
+		}
+
+		if result.Error != nil {
+			return oidc.Introspection{}, result.Error
+		}
+
+		if client.Public() || !client.AllowsGrant(models.ClientCredentialsGrant) {
+			return oidc.Introspection{}, nil
+		}
+
+		introspection.Subject = client.ClientID
+
+		return introspection, nil
+	}
+
+	if claims.Username == "" {
+		return oidc.Introspection{}, nil
+	}
+
+	var user models.User
+
+	result := database.DB.Where(models.User{Username: claims.Username}).First(&user)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return oidc.Introspection{}, nil
+	}
+
+	if result.Error != nil {
+		return oidc.Introspection{}, result.Error
+	}
+
+	if claims.Version != user.TokenVersion {
+		return oidc.Introspection{}, nil
+	}
+
+	if claims.Session != 0 {
+		active, err := models.SessionActive(database.DB, claims.Session, user.ID)
+
+		if err != nil || !active {
+			return oidc.Introspection{}, err
+		}
+	}
+
+	introspection.Subject = subject(&user)
+	introspection.Username = user.Username
+
+	return introspection, nil
+}
+
+func introspectAPIKey(key string) (oidc.Introspection, error) {
+	apiKey, err := findAPIKey(key)
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return oidc.Introspection{}, nil
+	}
+
+	if err != nil {
+		return oidc.Introspection{}, err
+	}
+
+	// deleting the user doesn't revoke their keys, it only makes them useless.
+	if !apiKey.Active() || apiKey.User.ID == 0 {
+		return oidc.Introspection{}, nil
+	}
+
+	introspection := oidc.Introspection{
+		Active:    true,
+		Scope:     strings.Join(apiKey.Scopes, " "),
+		Username:  apiKey.User.Username,
+		TokenType: "Bearer",
+		Subject:   subject(&apiKey.User),
+		Issuer:    issuer(),
+	}
+
+	introspection.SetTimes(apiKey.CreatedAt, apiKey.ExpiresAt)
+
+	return introspection, nil
+}
+
+// IntrospectTokenHandler tells resource servers whether a token is active and what it
+// is good for, as described in RFC 7662. It takes access tokens, service tokens,
+// refresh tokens and API keys. Only confidential clients may call it.
+func IntrospectTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondOAuthError(w, http.StatusBadRequest, &oidc.Error{Code: oidc.InvalidRequest, Description: "the request must be form encoded"})
+		return
+	}
+
+	client, ok := requireClient(w, r)
+
+	if !ok {
+		return
+	}
+
+	if client.Public() {
+		respondOAuthError(w, http.StatusUnauthorized, &oidc.Error{Code: oidc.InvalidClient, Description: "public clients can't introspect tokens"})
+		return
+	}
+
+	token := r.PostForm.Get("token")
+
+	if token == "" {
+		respondOAuthError(w, http.StatusBadRequest, &oidc.Error{Code: oidc.InvalidRequest, Description: "token is required"})
+		return
+	}
+
+	// the token_type_hint can be ignored, tokens tell what they are by themselves.
+	introspection, err := introspect(r.Context(), token)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		respondOAuthError(w, http.StatusInternalServerError, &oidc.Error{Code: oidc.ServerError})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	helpers.RespondWithJSON(w, http.StatusOK, introspection)
+}
+
+// revoke makes token unusable. Revoking a refresh token ends its session, which the
+// access tokens issued with it are checked against. Tokens issued to another client
+// are left alone, as are tokens that are invalid already.
+func revoke(ctx context.Context, client *models.Client, token string) error {
+	if strings.HasPrefix(token, helpers.API_KEY_PREFIX) {
+		apiKey, err := findAPIKey(token)
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return database.DB.Model(&models.APIKey{}).
+			Where("id = ? AND revoked_at IS NULL", apiKey.ID).
+			Update("revoked_at", time.Now()).Error
+	}
+
+	claims, err := helpers.ParseToken(token, introspectedTypes...)
+
+	if err != nil || (claims.ClientID != "" && claims.ClientID != client.ClientID) {
+		return nil
+	}
+
+	if claims.Type == helpers.RefreshTokenType {
+		storedToken, err := findRefreshToken(claims)
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return revokeTokenFamily(storedToken.Family)
+	}
+
+	return denylist.Default.Revoke(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// RevokeTokenHandler revokes a token as described in RFC 7009. It takes the same
+// tokens as IntrospectTokenHandler; holding one is enough to revoke it, so public
+// clients may call it as well.
+func RevokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondOAuthError(w, http.StatusBadRequest, &oidc.Error{Code: oidc.InvalidRequest, Description: "the request must be form encoded"})
+		return
+	}
+
+	client, ok := requireClient(w, r)
+
+	if !ok {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+
+	if token == "" {
+		respondOAuthError(w, http.StatusBadRequest, &oidc.Error{Code: oidc.InvalidRequest, Description: "token is required"})
+		return
+	}
+
+	// RFC 7009 section 2.2.1 has clients retry later on a 503.
+	if err := revoke(r.Context(), client, token); err != nil {
+		helpers.Error.Println(err)
+		respondOAuthError(w, http.StatusServiceUnavailable, &oidc.Error{Code: oidc.ServerError})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
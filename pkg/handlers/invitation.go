@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/schema"
+	"github.com/Adedunmol/zephyr/pkg/tenant"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const INVITATION_EXPIRATION = 7 * 24 * time.Hour
+
+var errInvalidInvitation = errors.New("invalid or expired invitation")
+
+// pendingInvitations limits a query to invitations that can still be answered.
+func pendingInvitations(db *gorm.DB) *gorm.DB {
+	return db.Where("accepted_at IS NULL AND declined_at IS NULL AND revoked_at IS NULL AND expires_at > ?", time.Now())
+}
+
+// answerInvitation marks a pending invitation as accepted or declined, depending on
+// column. It only succeeds once per invitation.
+func answerInvitation(tx *gorm.DB, id uint, column string) error {
+	result := tx.Model(&models.Invitation{}).
+		Scopes(pendingInvitations).
+		Where("id = ?", id).
+		Update(column, time.Now())
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errInvalidInvitation
+	}
+
+	return nil
+}
+
+func CreateInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok || principal.Membership == nil {
+		helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "no organization selected", Data: nil, Status: "error"})
+		return
+	}
+
+	data, problems, err := helpers.DecodeJSON[*schema.CreateInvitation](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	var members int64
+
+	result := database.DB.Model(&models.Membership{}).
+		Joins("JOIN users ON users.id = memberships.user_id").
+		Where("memberships.organization_id = ? AND users.email = ?", principal.Membership.OrganizationID, data.Email).
+		Count(&members)
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to create invitation", Data: nil, Status: "error"})
+		return
+	}
+
+	if members > 0 {
+		helpers.RespondWithJSON(w, http.StatusConflict, helpers.APIResponse{Message: "user is already a member", Data: nil, Status: "error"})
+		return
+	}
+
+	token, err := helpers.GenerateRandomString(32)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to create invitation", Data: nil, Status: "error"})
+		return
+	}
+
+	invitation := models.Invitation{
+		Email:       data.Email,
+		Role:        data.Role,
+		TokenHash:   helpers.HashToken(token),
+		InvitedByID: principal.User.ID,
+		ExpiresAt:   time.Now().Add(INVITATION_EXPIRATION),
+	}
+
+	// the organization is filled in from the request context.
+	err = database.DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Invitation{}).
+			Scopes(pendingInvitations).
+			Where("email = ?", data.Email).
+			Update("revoked_at", time.Now())
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		return tx.Create(&invitation).Error
+	})
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to create invitation", Data: nil, Status: "error"})
+		return
+	}
+
+	sendInvitationEmail(invitation, *principal.Membership.Organization, *principal.User, token)
+
+	helpers.RespondWithJSON(w, http.StatusCreated, helpers.APIResponse{Message: "invitation sent", Data: invitation, Status: "success"})
+}
+
+func ListInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	invitations := []models.Invitation{}
+
+	result := database.DB.WithContext(r.Context()).
+		Preload("InvitedBy").
+		Scopes(pendingInvitations).
+		Order("created_at").
+		Find(&invitations)
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load invitations", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: invitations, Status: "success"})
+}
+
+func RevokeInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+
+	if err != nil {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "invitation does not exist", Data: nil, Status: "error"})
+		return
+	}
+
+	result := database.DB.WithContext(r.Context()).
+		Model(&models.Invitation{}).
+		Scopes(pendingInvitations).
+		Where("id = ?", id).
+		Update("revoked_at", time.Now())
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to revoke invitation", Data: nil, Status: "error"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "invitation does not exist", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "invitation revoked", Data: nil, Status: "success"})
+}
+
+// AcceptInvitationHandler adds the invited user to the organization. Invitations sent
+// to an email without an account register one on the way, going through the same
+// validation as CreateUserHandler. Holding the token proves the email address, so
+// it is marked as verified.
+func AcceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	data, problems, err := helpers.DecodeJSON[*schema.AcceptInvitation](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	// the invitee doesn't belong to the organization yet.
+	ctx := tenant.Unscoped(r.Context())
+
+	var invitation models.Invitation
+
+	result := database.DB.WithContext(ctx).
+		Preload("Organization").
+		Scopes(pendingInvitations).
+		Where("token_hash = ?", helpers.HashToken(data.Token)).
+		First(&invitation)
+
+	if result.Error != nil {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid or expired invitation", Data: nil, Status: "error"})
+		return
+	}
+
+	var user *models.User
+	var existing models.User
+
+	result = database.DB.Where(models.User{Email: invitation.Email}).First(&existing)
+
+	switch {
+	case result.Error == nil:
+		user = &existing
+	case errors.Is(result.Error, gorm.ErrRecordNotFound):
+		if data.User == nil {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: map[string]string{"User": "Field 'User' cannot be blank"}})
+			return
+		}
+
+		data.User.Email = invitation.Email
+
+		if problems := data.User.Valid(r.Context()); len(problems) != 0 {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+	default:
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to accept invitation", Data: nil, Status: "error"})
+		return
+	}
+
+	registered := user == nil
+	membership := models.Membership{OrganizationID: invitation.OrganizationID, Role: invitation.Role}
+
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := answerInvitation(tx, invitation.ID, "accepted_at"); err != nil {
+			return err
+		}
+
+		if registered {
+			created, err := registerUser(tx, data.User, true)
+			if err != nil {
+				return err
+			}
+
+			user = created
+		} else if user.EmailVerifiedAt == nil {
+			if err := tx.Model(user).Update("email_verified_at", time.Now()).Error; err != nil {
+				return err
+			}
+		}
+
+		membership.UserID = user.ID
+
+		// accepting twice, e.g. two invitations to the same organization, is harmless.
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&membership).Error
+	})
+
+	if err != nil {
+		if errors.Is(err, errInvalidInvitation) {
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid or expired invitation", Data: nil, Status: "error"})
+			return
+		}
+
+		respondRegistrationError(w, err)
+		return
+	}
+
+	membership.Organization = invitation.Organization
+	membership.User = user
+
+	status := http.StatusOK
+	if registered {
+		status = http.StatusCreated
+	}
+
+	helpers.RespondWithJSON(w, status, helpers.APIResponse{Message: "invitation accepted", Data: membership, Status: "success"})
+}
+
+func DeclineInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	data, problems, err := helpers.DecodeJSON[*schema.DeclineInvitation](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	result := database.DB.WithContext(tenant.Unscoped(r.Context())).
+		Model(&models.Invitation{}).
+		Scopes(pendingInvitations).
+		Where("token_hash = ?", helpers.HashToken(data.Token)).
+		Update("declined_at", time.Now())
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to decline invitation", Data: nil, Status: "error"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid or expired invitation", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "invitation declined", Data: nil, Status: "success"})
+}
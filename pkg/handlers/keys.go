@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+)
+
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	jwks := helpers.JSONWebKeySet{Keys: []helpers.JSONWebKey{}}
+
+	if helpers.Keys != nil {
+		jwks = helpers.Keys.JWKS()
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	helpers.RespondWithJSON(w, http.StatusOK, jwks)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/directory"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/oauth"
+	"gorm.io/gorm"
+)
+
+// DIRECTORY_PROVIDER names the linked identities of users signing in with the
+// directory.
+const DIRECTORY_PROVIDER = "ldap"
+
+// LDAPAuthenticator checks logins against a directory. Users are created on their
+// first login, and the roles mapped from directory groups are brought up to date on
+// every login.
+type LDAPAuthenticator struct {
+	Directory *directory.Directory
+	// linked reports whether the account with an email has been linked to the
+	// directory.
+	linked func(email string) (bool, error)
+}
+
+func NewLDAPAuthenticator(d *directory.Directory) *LDAPAuthenticator {
+	return &LDAPAuthenticator{Directory: d, linked: directoryLinked}
+}
+
+// Authenticate leaves accounts that were never linked to the directory to the next
+// authenticator when the directory can't be reached, so that an outage doesn't lock
+// out local accounts.
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	entry, err := a.Directory.Authenticate(email, password)
+
+	switch {
+	case errors.Is(err, directory.ErrUserNotFound):
+		// users removed from the directory mustn't get in with a password they had
+		// before their account was linked to it.
+		linked, err := a.linked(email)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if linked {
+			return nil, ErrInvalidCredentials
+		}
+
+		return nil, ErrUnknownAccount
+	case errors.Is(err, directory.ErrInvalidCredentials):
+		return nil, ErrInvalidCredentials
+	case err != nil:
+		helpers.Error.Printf("could not reach the directory: %v", err)
+
+		linked, linkedErr := a.linked(email)
+
+		if linkedErr != nil {
+			return nil, linkedErr
+		}
+
+		if linked {
+			return nil, err
+		}
+
+		return nil, ErrUnknownAccount
+	}
+
+	if entry.Email == "" {
+		entry.Email = email
+	}
+
+	// the directory vouches for the email addresses of its users.
+	user, err := userForIdentity(DIRECTORY_PROVIDER, &oauth.Profile{
+		Subject:       entry.ID,
+		Email:         entry.Email,
+		EmailVerified: true,
+		Username:      entry.Username,
+		FirstName:     entry.FirstName,
+		LastName:      entry.LastName,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syncDirectoryRoles(user, a.Directory.Roles, entry.Groups); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// directoryLinked reports whether the user with email has been linked to the
+// directory.
+func directoryLinked(email string) (bool, error) {
+	var count int64
+
+	result := database.DB.Model(&models.LinkedIdentity{}).
+		Joins("JOIN users ON users.id = linked_identities.user_id AND users.deleted_at IS NULL").
+		Where("linked_identities.provider = ? AND users.email = ?", DIRECTORY_PROVIDER, email).
+		Count(&count)
+
+	return count > 0, result.Error
+}
+
+// syncDirectoryRoles gives user the roles mapped from the groups they are a member of,
+// and takes away the mapped roles of the groups they aren't. Roles given by hand are
+// left alone.
+func syncDirectoryRoles(user *models.User, mappings directory.GroupRoles, groups []string) error {
+	granted, revoked := mappings.Resolve(groups)
+
+	if len(granted) == 0 && len(revoked) == 0 {
+		return nil
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var roles []models.Role
+
+		if result := tx.Where("name IN ?", append(granted, revoked...)).Find(&roles); result.Error != nil {
+			return result.Error
+		}
+
+		for _, role := range roles {
+			role := role
+
+			if slices.Contains(granted, role.Name) {
+				if err := tx.Model(user).Association("Roles").Append(&role); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if err := tx.Model(user).Association("Roles").Delete(&role); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
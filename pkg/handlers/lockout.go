@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/password"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaults for the LOGIN_* settings.
+const DEFAULT_LOGIN_MAX_ATTEMPTS = 5
+const DEFAULT_LOGIN_IP_MAX_ATTEMPTS = 20
+const DEFAULT_LOGIN_LOCKOUT = 1 * time.Minute
+
+const MAX_LOGIN_LOCKOUT = 24 * time.Hour
+
+// LOGIN_FAILURE_WINDOW is how long failures are remembered for addresses and unknown
+// accounts that stop failing.
+const LOGIN_FAILURE_WINDOW = 24 * time.Hour
+
+func loginMaxAttempts() int {
+	if helpers.EnvConfig.LoginMaxAttempts > 0 {
+		return helpers.EnvConfig.LoginMaxAttempts
+	}
+
+	return DEFAULT_LOGIN_MAX_ATTEMPTS
+}
+
+func loginIPMaxAttempts() int {
+	if helpers.EnvConfig.LoginIPMaxAttempts > 0 {
+		return helpers.EnvConfig.LoginIPMaxAttempts
+	}
+
+	return DEFAULT_LOGIN_IP_MAX_ATTEMPTS
+}
+
+// lockoutDuration is how long to lock out after the given number of consecutive
+// failures. Reaching maxAttempts locks for LOGIN_LOCKOUT, every failure after that
+// doubles it.
+func lockoutDuration(failures, maxAttempts int) time.Duration {
+	if failures < maxAttempts {
+		return 0
+	}
+
+	lockout := helpers.EnvConfig.LoginLockout
+	if lockout <= 0 {
+		lockout = DEFAULT_LOGIN_LOCKOUT
+	}
+
+	for i := maxAttempts; i < failures && lockout < MAX_LOGIN_LOCKOUT; i++ {
+		lockout *= 2
+	}
+
+	if lockout > MAX_LOGIN_LOCKOUT {
+		return MAX_LOGIN_LOCKOUT
+	}
+
+	return lockout
+}
+
+type loginFailures struct {
+	count       int
+	lockedUntil time.Time
+	last        time.Time
+}
+
+// failureTracker counts login failures in memory, for keys that have no account
+// row to keep them on.
+type failureTracker struct {
+	sync.Mutex
+	failures map[string]*loginFailures
+}
+
+func newFailureTracker() *failureTracker {
+	return &failureTracker{failures: make(map[string]*loginFailures)}
+}
+
+func (t *failureTracker) locked(key string) (bool, time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+
+	entry, ok := t.failures[key]
+
+	if !ok {
+		return false, 0
+	}
+
+	if remaining := time.Until(entry.lockedUntil); remaining > 0 {
+		return true, remaining
+	}
+
+	return false, 0
+}
+
+func (t *failureTracker) fail(key string, maxAttempts int) {
+	t.Lock()
+	defer t.Unlock()
+
+	now := time.Now()
+
+	for k, entry := range t.failures {
+		if now.Sub(entry.last) >= LOGIN_FAILURE_WINDOW && !entry.lockedUntil.After(now) {
+			delete(t.failures, k)
+		}
+	}
+
+	entry, ok := t.failures[key]
+
+	if !ok {
+		entry = &loginFailures{}
+		t.failures[key] = entry
+	}
+
+	entry.count++
+	entry.last = now
+
+	if lockout := lockoutDuration(entry.count, maxAttempts); lockout > 0 {
+		entry.lockedUntil = now.Add(lockout)
+	}
+}
+
+// ipFailures tracks failed logins per client address, so that guessing across many
+// accounts is slowed down too.
+var ipFailures = newFailureTracker()
+
+// unknownFailures tracks failed logins for emails without an account, so that they
+// get locked out exactly like real accounts and lockouts don't reveal which exist.
+var unknownFailures = newFailureTracker()
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func accountLocked(user *models.User) (bool, time.Duration) {
+	if user.LockedUntil == nil {
+		return false, 0
+	}
+
+	if remaining := time.Until(*user.LockedUntil); remaining > 0 {
+		return true, remaining
+	}
+
+	return false, 0
+}
+
+// recordAccountFailure counts a failed login against user, locking the account once
+// there have been too many.
+func recordAccountFailure(user *models.User) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var updated models.User
+
+		result := tx.Model(&updated).
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "failed_logins"}}}).
+			Where("id = ?", user.ID).
+			UpdateColumn("failed_logins", gorm.Expr("failed_logins + 1"))
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		lockout := lockoutDuration(updated.FailedLogins, loginMaxAttempts())
+
+		if lockout == 0 {
+			return nil
+		}
+
+		helpers.Warning.Printf("locking user %d for %s after %d failed logins", user.ID, lockout, updated.FailedLogins)
+
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).UpdateColumn("locked_until", time.Now().Add(lockout)).Error
+	})
+}
+
+func resetAccountFailures(user *models.User) error {
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return nil
+	}
+
+	return database.DB.Model(&models.User{}).
+		Where("id = ?", user.ID).
+		UpdateColumns(map[string]interface{}{"failed_logins": 0, "locked_until": nil}).Error
+}
+
+var dummyPasswordHash struct {
+	sync.Once
+	hash string
+}
+
+// compareDummyPassword does the same hashing work as checking a real password, so
+// that unknown accounts can't be told apart by how long the response takes.
+func compareDummyPassword(plaintext string) {
+	dummyPasswordHash.Do(func() {
+		dummyPasswordHash.hash, _ = password.Hash("not the password")
+	})
+
+	password.Verify(plaintext, dummyPasswordHash.hash)
+}
+
+func respondLockedOut(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds()+1)))
+	helpers.RespondWithJSON(w, http.StatusTooManyRequests, helpers.APIResponse{Message: "too many failed login attempts, try again later", Data: nil, Status: "error"})
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+)
+
+const checkMark = "\u2713"
+const ballotX = "\u2717"
+
+func TestLockoutDuration(t *testing.T) {
+	helpers.EnvConfig.LoginLockout = time.Minute
+
+	tests := []struct {
+		failures int
+		lockout  time.Duration
+	}{
+		{4, 0},
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{8, 8 * time.Minute},
+		{100, MAX_LOGIN_LOCKOUT},
+	}
+
+	t.Log("Given the need to test backing off failed logins.")
+	{
+		for _, tt := range tests {
+			t.Logf("\tWhen there have been %d failures.", tt.failures)
+			{
+				if lockout := lockoutDuration(tt.failures, 5); lockout != tt.lockout {
+					t.Errorf("\t\tShould lock out for %s, but got %s. %v", tt.lockout, lockout, ballotX)
+				}
+				t.Logf("\t\tShould lock out for %s. %v", tt.lockout, checkMark)
+			}
+		}
+	}
+}
+
+func TestFailureTracker(t *testing.T) {
+	helpers.EnvConfig.LoginLockout = time.Minute
+
+	tracker := newFailureTracker()
+
+	t.Log("Given the need to test tracking failed logins in memory.")
+	{
+		t.Log("\tWhen failing fewer times than allowed.")
+		{
+			tracker.fail("203.0.113.7", 3)
+			tracker.fail("203.0.113.7", 3)
+
+			if locked, _ := tracker.locked("203.0.113.7"); locked {
+				t.Error("\t\tShould not lock out.", ballotX)
+			}
+			t.Log("\t\tShould not lock out.", checkMark)
+		}
+
+		t.Log("\tWhen reaching the limit.")
+		{
+			tracker.fail("203.0.113.7", 3)
+
+			locked, retryAfter := tracker.locked("203.0.113.7")
+
+			if !locked || retryAfter <= 0 || retryAfter > time.Minute {
+				t.Errorf("\t\tShould lock out for a minute, but got %v %s. %v", locked, retryAfter, ballotX)
+			}
+			t.Log("\t\tShould lock out for a minute.", checkMark)
+
+			if locked, _ := tracker.locked("198.51.100.1"); locked {
+				t.Error("\t\tShould not lock out other keys.", ballotX)
+			}
+			t.Log("\t\tShould not lock out other keys.", checkMark)
+		}
+	}
+}
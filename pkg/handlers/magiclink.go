@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/schema"
+)
+
+// MAGIC_LINK_COOKIE holds the nonce that binds a magic link to the browser that
+// asked for it.
+const MAGIC_LINK_COOKIE = "magic_link"
+
+// createMagicLink signs a login link for user bound to nonce. Only the newest link of
+// a user works, and only once.
+func createMagicLink(user models.User, nonce string) (string, error) {
+	token, claims, err := helpers.GenerateTypedToken(user.Username, user.TokenVersion, helpers.MagicTokenType, helpers.MAGIC_LINK_EXPIRATION, helpers.WithNonce(helpers.HashToken(nonce)))
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := storeUserToken(user.ID, models.MagicLinkPurpose, claims.ID, helpers.MAGIC_LINK_EXPIRATION); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// MagicLinkHandler emails a login link and sets the cookie it will be checked against.
+func MagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	data, problems, err := helpers.DecodeJSON[*schema.MagicLink](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	nonce, err := helpers.GenerateRandomString(32)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to send login link", Data: nil, Status: "error"})
+		return
+	}
+
+	// the cookie is set whether or not the email belongs to an account, so this
+	// endpoint can't be used to find out who is registered.
+	http.SetCookie(w, &http.Cookie{
+		Name:     MAGIC_LINK_COOKIE,
+		Value:    nonce,
+		Path:     "/users/magic-link",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(helpers.MAGIC_LINK_EXPIRATION.Seconds()),
+	})
+
+	var foundUser models.User
+
+	result := database.DB.Where(models.User{Email: data.Email}).First(&foundUser)
+
+	if result.Error == nil {
+		token, err := createMagicLink(foundUser, nonce)
+
+		if err != nil {
+			helpers.Error.Println(err)
+		} else {
+			sendMagicLinkEmail(foundUser, token)
+		}
+	}
+
+	helpers.RespondWithJSON(w, http.StatusAccepted, helpers.APIResponse{Message: "if an account exists for this email, a login link has been sent", Data: nil, Status: "success"})
+}
+
+// ConsumeMagicLinkHandler logs in with a magic link, going through the second factor
+// like a password login would. The browser check comes before the link is used up,
+// so that opening a forwarded link, or a mail scanner fetching it, doesn't burn it.
+func ConsumeMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	if token == "" {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "token is required", Data: nil, Status: "error"})
+		return
+	}
+
+	claims, err := helpers.ParseToken(token, helpers.MagicTokenType)
+
+	if err != nil {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid or expired link", Data: nil, Status: "error"})
+		return
+	}
+
+	cookie, err := r.Cookie(MAGIC_LINK_COOKIE)
+
+	if err != nil || subtle.ConstantTimeCompare([]byte(helpers.HashToken(cookie.Value)), []byte(claims.Nonce)) != 1 {
+		helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "open the link in the browser it was requested from", Data: nil, Status: "error"})
+		return
+	}
+
+	userToken, err := consumeUserToken(database.DB, claims.ID, models.MagicLinkPurpose)
+
+	if err != nil {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid or expired link", Data: nil, Status: "error"})
+		return
+	}
+
+	var foundUser models.User
+
+	result := database.DB.First(&foundUser, userToken.UserID)
+
+	if result.Error != nil || foundUser.Username != claims.Username || foundUser.TokenVersion != claims.Version {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid or expired link", Data: nil, Status: "error"})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: MAGIC_LINK_COOKIE, Value: "", Path: "/users/magic-link", HttpOnly: true, MaxAge: -1})
+
+	// the link was delivered to the address, which proves it.
+	if foundUser.EmailVerifiedAt == nil {
+		if err := database.DB.Model(&foundUser).Update("email_verified_at", time.Now()).Error; err != nil {
+			helpers.Error.Println(err)
+		}
+	}
+
+	completeLogin(w, r, foundUser, 0)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+)
+
+func TestConsumeMagicLink(t *testing.T) {
+	defer func(config helpers.Config) { helpers.EnvConfig = config }(helpers.EnvConfig)
+	helpers.EnvConfig.SecretKey = "magic link test secret"
+
+	token, _, err := helpers.GenerateTypedToken("ade", 0, helpers.MagicTokenType, helpers.MAGIC_LINK_EXPIRATION, helpers.WithNonce(helpers.HashToken("browser nonce")))
+	if err != nil {
+		t.Fatal("Should be able to sign a magic link.", ballotX, err)
+	}
+
+	consume := func(token string, cookie *http.Cookie) int {
+		r := httptest.NewRequest(http.MethodGet, "/users/magic-link/consume?token="+token, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+
+		w := httptest.NewRecorder()
+		ConsumeMagicLinkHandler(w, r)
+
+		return w.Code
+	}
+
+	t.Log("Given the need to test consuming magic links.")
+	{
+		t.Log("\tWhen the link is opened in another browser.")
+		{
+			if code := consume(token, nil); code != http.StatusForbidden {
+				t.Errorf("\t\tShould refuse the link without the cookie, but got %d. %v", code, ballotX)
+			}
+			t.Log("\t\tShould refuse the link without the cookie.", checkMark)
+
+			if code := consume(token, &http.Cookie{Name: MAGIC_LINK_COOKIE, Value: "other nonce"}); code != http.StatusForbidden {
+				t.Errorf("\t\tShould refuse the link with another nonce, but got %d. %v", code, ballotX)
+			}
+			t.Log("\t\tShould refuse the link with another nonce.", checkMark)
+		}
+
+		t.Log("\tWhen another kind of token is used as a link.")
+		{
+			mfaToken, _, _ := helpers.GenerateTypedToken("ade", 0, helpers.MFATokenType, helpers.MFA_TOKEN_EXPIRATION, helpers.WithNonce(helpers.HashToken("browser nonce")))
+
+			if code := consume(mfaToken, &http.Cookie{Name: MAGIC_LINK_COOKIE, Value: "browser nonce"}); code != http.StatusBadRequest {
+				t.Errorf("\t\tShould refuse the token, but got %d. %v", code, ballotX)
+			}
+			t.Log("\t\tShould refuse the token.", checkMark)
+		}
+	}
+}
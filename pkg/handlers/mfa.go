@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/denylist"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/schema"
+	"github.com/Adedunmol/zephyr/pkg/totp"
+	"gorm.io/gorm"
+)
+
+const RECOVERY_CODE_COUNT = 10
+const MAX_MFA_ATTEMPTS = 5
+
+type totpEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	QRCode string `json:"qr_code"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type mfaChallengeResponse struct {
+	MFARequired bool          `json:"mfa_required"`
+	MFAToken    string        `json:"mfa_token"`
+	Methods     []string      `json:"methods"`
+	Expiration  time.Duration `json:"expiration"`
+}
+
+// mfaAttempts counts the failed second factor attempts made with an MFA token, so
+// that a token can't be used to brute-force the 6 digit codes.
+var mfaAttempts = struct {
+	sync.Mutex
+	failures map[string]int
+	expiry   map[string]time.Time
+}{failures: make(map[string]int), expiry: make(map[string]time.Time)}
+
+func recordMFAFailure(claims *helpers.Claims) int {
+	mfaAttempts.Lock()
+	defer mfaAttempts.Unlock()
+
+	now := time.Now()
+
+	for id, expiresAt := range mfaAttempts.expiry {
+		if !expiresAt.After(now) {
+			delete(mfaAttempts.failures, id)
+			delete(mfaAttempts.expiry, id)
+		}
+	}
+
+	mfaAttempts.failures[claims.ID]++
+	mfaAttempts.expiry[claims.ID] = claims.ExpiresAt.Time
+
+	return mfaAttempts.failures[claims.ID]
+}
+
+// completeLogin finishes a successful first factor login. Users with two-factor
+// authentication get a short-lived MFA token to exchange at /users/login/mfa (or
+// /users/login/mfa/webauthn) instead of the real tokens. The tokens are scoped to
+// organization, when the login was made through one.
+func completeLogin(w http.ResponseWriter, r *http.Request, user models.User, organization uint) {
+	var methods []string
+
+	if user.MFAEnabled() {
+		methods = append(methods, "totp")
+	}
+
+	hasCredentials, err := hasWebAuthnCredentials(user.ID)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "Unable to generate token", Data: nil, Status: "error"})
+		return
+	}
+
+	if hasCredentials {
+		methods = append(methods, "webauthn")
+	}
+
+	if len(methods) == 0 {
+		issueTokens(w, r, user, "", organization)
+		return
+	}
+
+	mfaToken, _, err := helpers.GenerateTypedToken(user.Username, user.TokenVersion, helpers.MFATokenType, helpers.MFA_TOKEN_EXPIRATION, helpers.WithOrganization(organization))
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "Unable to generate token", Data: nil, Status: "error"})
+		return
+	}
+
+	res := mfaChallengeResponse{MFARequired: true, MFAToken: mfaToken, Methods: methods, Expiration: time.Duration(helpers.MFA_TOKEN_EXPIRATION.Seconds())}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "two-factor authentication required", Data: res, Status: "success"})
+}
+
+// userFromMFAToken returns the claims of a valid, unused MFA token and the user it
+// was issued to.
+func userFromMFAToken(ctx context.Context, token string) (*helpers.Claims, *models.User, bool) {
+	claims, err := helpers.ParseToken(token, helpers.MFATokenType)
+
+	if err != nil {
+		return nil, nil, false
+	}
+
+	revoked, err := denylist.Default.IsRevoked(ctx, claims.ID)
+
+	if err != nil || revoked {
+		return nil, nil, false
+	}
+
+	var foundUser models.User
+
+	result := database.DB.Where(models.User{Username: claims.Username}).First(&foundUser)
+
+	if result.Error != nil || claims.Version != foundUser.TokenVersion {
+		return nil, nil, false
+	}
+
+	return claims, &foundUser, true
+}
+
+// verifyTOTP checks code against the user's secret, refusing codes from a time step
+// that has already been used.
+func verifyTOTP(user *models.User, code string) (bool, error) {
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+
+	if !ok {
+		return false, nil
+	}
+
+	result := database.DB.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		UpdateColumn("totp_last_step", step)
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// useRecoveryCode consumes one of the user's recovery codes.
+func useRecoveryCode(userID uint, code string) (bool, error) {
+	result := database.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, helpers.HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// verifySecondFactor checks a TOTP code or, failing that, a recovery code. Users who
+// only have passkeys can use their recovery codes here but no TOTP code.
+func verifySecondFactor(user *models.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		if !user.MFAEnabled() {
+			return false, nil
+		}
+
+		return verifyTOTP(user, code)
+	}
+
+	return useRecoveryCode(user.ID, recoveryCode)
+}
+
+// generateRecoveryCodes replaces the user's recovery codes with a fresh set.
+func generateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	result := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{})
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	codes := make([]string, RECOVERY_CODE_COUNT)
+	records := make([]models.RecoveryCode, RECOVERY_CODE_COUNT)
+
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	for i := range codes {
+		raw := make([]byte, 10)
+
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+
+		// lowercase base32 keeps the codes easy to read out and type.
+		code := strings.ToLower(encoding.EncodeToString(raw))
+
+		codes[i] = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+		records[i] = models.RecoveryCode{UserID: userID, CodeHash: helpers.HashToken(code)}
+	}
+
+	result = tx.Create(&records)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return codes, nil
+}
+
+func EnrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	if principal.User.MFAEnabled() {
+		helpers.RespondWithJSON(w, http.StatusConflict, helpers.APIResponse{Message: "two-factor authentication is already enabled", Data: nil, Status: "error"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to generate secret", Data: nil, Status: "error"})
+		return
+	}
+
+	issuer := helpers.EnvConfig.AppName
+	if issuer == "" {
+		issuer = "Zephyr"
+	}
+
+	uri := totp.URI(issuer, principal.User.Email, secret)
+
+	qrCode, err := totp.QRCode(uri, 256)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to generate QR code", Data: nil, Status: "error"})
+		return
+	}
+
+	// the secret only becomes active once a first code has been confirmed.
+	result := database.DB.Model(principal.User).UpdateColumn("totp_secret", secret)
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to save secret", Data: nil, Status: "error"})
+		return
+	}
+
+	res := totpEnrollmentResponse{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(qrCode),
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: res, Status: "success"})
+}
+
+func ConfirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	data, problems, err := helpers.DecodeJSON[*schema.TOTPCode](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	user := principal.User
+
+	if user.MFAEnabled() {
+		helpers.RespondWithJSON(w, http.StatusConflict, helpers.APIResponse{Message: "two-factor authentication is already enabled", Data: nil, Status: "error"})
+		return
+	}
+
+	if user.TOTPSecret == "" {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "two-factor authentication has not been enrolled", Data: nil, Status: "error"})
+		return
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, data.Code, time.Now())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "Invalid code", Data: nil, Status: "error"})
+		return
+	}
+
+	var codes []string
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(user).Updates(map[string]interface{}{"totp_enabled_at": time.Now(), "totp_last_step": step})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		codes, err = generateRecoveryCodes(tx, user.ID)
+
+		return err
+	})
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to enable two-factor authentication", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "two-factor authentication enabled", Data: recoveryCodesResponse{RecoveryCodes: codes}, Status: "success"})
+}
+
+func DisableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	data, problems, err := helpers.DecodeJSON[*schema.SecondFactor](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	user := principal.User
+
+	if !user.MFAEnabled() {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "two-factor authentication is not enabled", Data: nil, Status: "error"})
+		return
+	}
+
+	valid, err := verifySecondFactor(user, data.Code, data.RecoveryCode)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to verify code", Data: nil, Status: "error"})
+		return
+	}
+
+	if !valid {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "Invalid code", Data: nil, Status: "error"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(user).Updates(map[string]interface{}{"totp_secret": "", "totp_enabled_at": nil, "totp_last_step": 0})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		var credentials int64
+
+		if result := tx.Model(&models.Credential{}).Where("user_id = ?", user.ID).Count(&credentials); result.Error != nil {
+			return result.Error
+		}
+
+		// passkeys are still a second factor, which the codes recover.
+		if credentials > 0 {
+			return nil
+		}
+
+		return tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to disable two-factor authentication", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "two-factor authentication disabled", Data: nil, Status: "success"})
+}
+
+func LoginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	data, problems, err := helpers.DecodeJSON[*schema.LoginMFA](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	claims, foundUser, ok := userFromMFAToken(r.Context(), data.MFAToken)
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "Invalid MFA token", Data: nil, Status: "error"})
+		return
+	}
+
+	// recovery codes also stand in for passkeys, when those are the only factor.
+	hasCredentials, err := hasWebAuthnCredentials(foundUser.ID)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to verify code", Data: nil, Status: "error"})
+		return
+	}
+
+	if !foundUser.MFAEnabled() && !hasCredentials {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "Invalid MFA token", Data: nil, Status: "error"})
+		return
+	}
+
+	valid, err := verifySecondFactor(foundUser, data.Code, data.RecoveryCode)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to verify code", Data: nil, Status: "error"})
+		return
+	}
+
+	if !valid {
+		if recordMFAFailure(claims) >= MAX_MFA_ATTEMPTS {
+			denylist.Default.Revoke(r.Context(), claims.ID, claims.ExpiresAt.Time)
+		}
+
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "Invalid code", Data: nil, Status: "error"})
+		return
+	}
+
+	// the MFA token is single use.
+	if err := denylist.Default.Revoke(r.Context(), claims.ID, claims.ExpiresAt.Time); err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to revoke token", Data: nil, Status: "error"})
+		return
+	}
+
+	issueTokens(w, r, *foundUser, "", claims.Organization)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Adedunmol/zephyr/pkg/denylist"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestLoginMFAWithPasskeyOnly(t *testing.T) {
+	helpers.EnvConfig.SecretKey = "test-secret"
+	denylist.Default = denylist.NewMemoryStore()
+
+	const userID = 7
+
+	tests := []struct {
+		name         string
+		code         string
+		recoveryCode string
+		status       int
+	}{
+		{"a recovery code is given", "", "ABCD-EFGH-IJKL-MNOP", http.StatusOK},
+		{"a TOTP code is given", "123456", "", http.StatusUnauthorized},
+	}
+
+	t.Log("Given the need to test signing in users whose only second factor is a passkey.")
+	{
+		for _, tt := range tests {
+			t.Logf("\tWhen %s.", tt.name)
+			{
+				mock := mockDatabase(t)
+
+				mfaToken, _, err := helpers.GenerateTypedToken("Adedunmola", 0, helpers.MFATokenType, helpers.MFA_TOKEN_EXPIRATION)
+				if err != nil {
+					t.Fatal("Should be able to generate an MFA token.", ballotX, err)
+				}
+
+				mock.ExpectQuery(`SELECT \* FROM "users"`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "token_version"}).AddRow(userID, "Adedunmola", 0))
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "credentials"`).
+					WithArgs(userID).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+				if tt.recoveryCode != "" {
+					mock.ExpectBegin()
+					mock.ExpectExec(`UPDATE "recovery_codes" SET`).
+						WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), userID, helpers.HashToken(normalizeRecoveryCode(tt.recoveryCode))).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectCommit()
+
+					mock.ExpectBegin()
+					mock.ExpectQuery(`SELECT \* FROM "sessions"`).
+						WillReturnRows(sqlmock.NewRows([]string{"id"}))
+					mock.ExpectQuery(`SELECT count\(\*\) FROM "sessions"`).
+						WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+					mock.ExpectQuery(`SELECT count\(\*\) FROM "sessions"`).
+						WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+					mock.ExpectQuery(`INSERT INTO "sessions"`).
+						WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+					mock.ExpectCommit()
+
+					mock.ExpectBegin()
+					mock.ExpectQuery(`INSERT INTO "refresh_tokens"`).
+						WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+					mock.ExpectCommit()
+				}
+
+				body, _ := json.Marshal(map[string]string{"mfa_token": mfaToken, "code": tt.code, "recovery_code": tt.recoveryCode})
+
+				r := httptest.NewRequest(http.MethodPost, "/users/login/mfa", bytes.NewReader(body))
+				w := httptest.NewRecorder()
+
+				LoginMFAHandler(w, r)
+
+				if w.Code != tt.status {
+					t.Fatalf("\t\tShould receive a %d status code, but got %d %s. %v", tt.status, w.Code, w.Body, ballotX)
+				}
+				t.Logf("\t\tShould receive a %d status code. %v", tt.status, checkMark)
+
+				if err := mock.ExpectationsWereMet(); err != nil {
+					t.Errorf("\t\tShould only spend a recovery code that was given: %v %v", err, ballotX)
+				}
+				t.Log("\t\tShould only spend a recovery code that was given.", checkMark)
+			}
+		}
+	}
+}
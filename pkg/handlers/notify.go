@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/mailer"
+	"github.com/Adedunmol/zephyr/pkg/models"
+)
+
+type linkMailData struct {
+	Name      string
+	Link      string
+	ExpiresIn string
+}
+
+// sendMail renders t for the recipient and hands it to the mail queue. Delivery
+// happens in the background, failures are only logged.
+func sendMail(t mailer.Template, to string, data interface{}) {
+	if mailer.Default == nil {
+		helpers.Error.Printf("no mailer configured, dropping %s mail", t.Name)
+		return
+	}
+
+	msg, err := mailer.Render(t, to, data)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		return
+	}
+
+	if err := mailer.Default.Enqueue(msg); err != nil {
+		helpers.Error.Printf("unable to queue %s mail: %v", t.Name, err)
+	}
+}
+
+func sendPasswordResetEmail(user models.User, token string) {
+	link := fmt.Sprintf("%s/reset-password?token=%s", helpers.EnvConfig.AppURL, token)
+
+	sendMail(mailer.PasswordResetTemplate, user.Email, linkMailData{Name: user.FirstName, Link: link, ExpiresIn: formatDuration(PASSWORD_RESET_EXPIRATION)})
+}
+
+func sendVerificationEmail(user models.User, token string) {
+	link := fmt.Sprintf("%s/users/verify?token=%s", helpers.EnvConfig.AppURL, token)
+
+	sendMail(mailer.EmailVerificationTemplate, user.Email, linkMailData{Name: user.FirstName, Link: link, ExpiresIn: formatDuration(EMAIL_VERIFICATION_EXPIRATION)})
+}
+
+func sendMagicLinkEmail(user models.User, token string) {
+	link := fmt.Sprintf("%s/users/magic-link/consume?token=%s", helpers.EnvConfig.AppURL, token)
+
+	sendMail(mailer.MagicLinkTemplate, user.Email, linkMailData{Name: user.FirstName, Link: link, ExpiresIn: formatDuration(helpers.MAGIC_LINK_EXPIRATION)})
+}
+
+type newDeviceMailData struct {
+	Name      string
+	UserAgent string
+	IPAddress string
+	Time      string
+}
+
+func sendNewDeviceEmail(user models.User, session models.Session) {
+	data := newDeviceMailData{
+		Name:      user.FirstName,
+		UserAgent: session.UserAgent,
+		IPAddress: session.IPAddress,
+		Time:      session.CreatedAt.UTC().Format("2 Jan 2006 15:04 MST"),
+	}
+
+	if data.UserAgent == "" {
+		data.UserAgent = "unknown"
+	}
+
+	sendMail(mailer.NewDeviceTemplate, user.Email, data)
+}
+
+type invitationMailData struct {
+	Organization string
+	InvitedBy    string
+	Role         string
+	Link         string
+	ExpiresIn    string
+}
+
+func sendInvitationEmail(invitation models.Invitation, organization models.Organization, inviter models.User, token string) {
+	link := fmt.Sprintf("%s/invitations/accept?token=%s", helpers.EnvConfig.AppURL, token)
+
+	data := invitationMailData{
+		Organization: organization.Name,
+		InvitedBy:    strings.TrimSpace(inviter.FirstName + " " + inviter.LastName),
+		Role:         invitation.Role,
+		Link:         link,
+		ExpiresIn:    formatDuration(INVITATION_EXPIRATION),
+	}
+
+	sendMail(mailer.InvitationTemplate, invitation.Email, data)
+}
+
+func formatDuration(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	}
+
+	if d >= time.Hour && d%time.Hour == 0 {
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	}
+
+	return fmt.Sprintf("%d minutes", d/time.Minute)
+}
@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/oauth"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// OAUTH_STATE_COOKIE holds the state and PKCE verifier of a sign-in with a provider
+// until the user comes back from it.
+const OAUTH_STATE_COOKIE = "oauth_state"
+
+const OAUTH_STATE_EXPIRATION = 10 * time.Minute
+
+var (
+	errProviderEmailUnverified = errors.New("email not verified by the provider")
+	errAccountEmailUnverified  = errors.New("account email not verified")
+	errLastSignInMethod        = errors.New("last sign-in method")
+)
+
+func oauthPath(provider string) string {
+	return "/users/oauth/" + provider
+}
+
+func oauthRedirectURI(provider string) string {
+	return strings.TrimRight(helpers.EnvConfig.AppURL, "/") + oauthPath(provider) + "/callback"
+}
+
+// OAuthLoginHandler sends the user to the provider to sign in. The state and PKCE
+// verifier stay in a cookie scoped to the provider's routes, which ties the callback
+// to the browser that started the sign-in.
+func OAuthLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oauth.Lookup(chi.URLParam(r, "provider"))
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "provider does not exist", Data: nil, Status: "error"})
+		return
+	}
+
+	state, err := helpers.GenerateRandomString(32)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to start sign-in", Data: nil, Status: "error"})
+		return
+	}
+
+	verifier, err := oauth.GenerateVerifier()
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to start sign-in", Data: nil, Status: "error"})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     OAUTH_STATE_COOKIE,
+		Value:    state + "." + verifier,
+		Path:     oauthPath(provider.Name()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(OAUTH_STATE_EXPIRATION.Seconds()),
+	})
+
+	http.Redirect(w, r, provider.AuthCodeURL(state, oauth.S256Challenge(verifier), oauthRedirectURI(provider.Name())), http.StatusFound)
+}
+
+// OAuthCallbackHandler finishes signing in with a provider. Accounts are found by
+// the identity linked to them, or else by email, which the provider must have
+// verified. Users signing in for the first time get a new account.
+func OAuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oauth.Lookup(chi.URLParam(r, "provider"))
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "provider does not exist", Data: nil, Status: "error"})
+		return
+	}
+
+	query := r.URL.Query()
+
+	cookie, err := r.Cookie(OAUTH_STATE_COOKIE)
+
+	if err != nil {
+		helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "sign-in was started in another browser or has expired", Data: nil, Status: "error"})
+		return
+	}
+
+	state, verifier, found := strings.Cut(cookie.Value, ".")
+
+	if !found || subtle.ConstantTimeCompare([]byte(state), []byte(query.Get("state"))) != 1 {
+		helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "sign-in was started in another browser or has expired", Data: nil, Status: "error"})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: OAUTH_STATE_COOKIE, Value: "", Path: oauthPath(provider.Name()), HttpOnly: true, MaxAge: -1})
+
+	if query.Get("error") != "" {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "sign-in was cancelled or denied", Data: nil, Status: "error"})
+		return
+	}
+
+	token, err := provider.Exchange(r.Context(), query.Get("code"), verifier, oauthRedirectURI(provider.Name()))
+
+	if err != nil {
+		var oauthErr *oauth.Error
+
+		if errors.As(err, &oauthErr) {
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid or expired code", Data: nil, Status: "error"})
+			return
+		}
+
+		helpers.Error.Println(provider.Name(), err)
+		helpers.RespondWithJSON(w, http.StatusBadGateway, helpers.APIResponse{Message: "unable to sign in with provider", Data: nil, Status: "error"})
+		return
+	}
+
+	profile, err := provider.Profile(r.Context(), token)
+
+	if err != nil {
+		helpers.Error.Println(provider.Name(), err)
+		helpers.RespondWithJSON(w, http.StatusBadGateway, helpers.APIResponse{Message: "unable to sign in with provider", Data: nil, Status: "error"})
+		return
+	}
+
+	user, err := userForIdentity(provider.Name(), profile)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, errProviderEmailUnverified):
+			helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "email address has not been verified with the provider", Data: nil, Status: "error"})
+		case errors.Is(err, errAccountEmailUnverified):
+			helpers.RespondWithJSON(w, http.StatusConflict, helpers.APIResponse{Message: "an account with this email exists, verify it before signing in with a provider", Data: nil, Status: "error"})
+		default:
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to sign in with provider", Data: nil, Status: "error"})
+		}
+		return
+	}
+
+	if locked, retryAfter := accountLocked(user); locked {
+		respondLockedOut(w, retryAfter)
+		return
+	}
+
+	completeLogin(w, r, *user, 0)
+}
+
+// userForIdentity returns the user profile signs in as, linking the identity to an
+// account on its first use. An existing account is only linked when both the
+// provider and the account have verified the email, so that registering someone
+// else's address, here or at the provider, doesn't give access to their account.
+func userForIdentity(provider string, profile *oauth.Profile) (*models.User, error) {
+	var identity models.LinkedIdentity
+
+	result := database.DB.Preload("User").Where("provider = ? AND subject = ?", provider, profile.Subject).First(&identity)
+
+	if result.Error == nil && identity.User.ID == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if result.Error == nil {
+		result = database.DB.Model(&identity).Updates(map[string]interface{}{"email": profile.Email, "last_login_at": time.Now()})
+
+		if result.Error != nil {
+			helpers.Error.Println(result.Error)
+		}
+
+		return &identity.User, nil
+	}
+
+	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, result.Error
+	}
+
+	if profile.Email == "" || !profile.EmailVerified {
+		return nil, errProviderEmailUnverified
+	}
+
+	var user models.User
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where(models.User{Email: profile.Email}).First(&user)
+
+		switch {
+		case result.Error == nil:
+			if user.EmailVerifiedAt == nil {
+				return errAccountEmailUnverified
+			}
+		case errors.Is(result.Error, gorm.ErrRecordNotFound):
+			created, err := registerIdentityUser(tx, profile)
+
+			if err != nil {
+				return err
+			}
+
+			user = *created
+		default:
+			return result.Error
+		}
+
+		now := time.Now()
+
+		return tx.Create(&models.LinkedIdentity{
+			UserID:      user.ID,
+			Provider:    provider,
+			Subject:     profile.Subject,
+			Email:       profile.Email,
+			LastLoginAt: &now,
+		}).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// registerIdentityUser creates an account for someone signing in with a provider for
+// the first time. It has no password, and its email is only verified when the provider
+// vouches for it.
+func registerIdentityUser(tx *gorm.DB, profile *oauth.Profile) (*models.User, error) {
+	username, err := availableUsername(tx, profile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	user := models.User{
+		FirstName: profile.FirstName,
+		LastName:  profile.LastName,
+		Username:  username,
+		Email:     profile.Email,
+	}
+
+	if profile.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	assignDefaultRole(tx, &user)
+
+	if result := tx.Create(&user); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &user, nil
+}
+
+// availableUsername picks a username for profile: its username at the provider when
+// that is free, with a random suffix otherwise.
+func availableUsername(tx *gorm.DB, profile *oauth.Profile) (string, error) {
+	base := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.') {
+			return r
+		}
+
+		return -1
+	}, profile.Username)
+
+	if base == "" {
+		base = "user"
+	}
+
+	username := base
+
+	for i := 0; i < 5; i++ {
+		var count int64
+
+		if result := tx.Unscoped().Model(&models.User{}).Where("username = ?", username).Count(&count); result.Error != nil {
+			return "", result.Error
+		}
+
+		if count == 0 {
+			return username, nil
+		}
+
+		suffix := make([]byte, 3)
+
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+
+		username = base + "-" + hex.EncodeToString(suffix)
+	}
+
+	return "", errors.New("unable to find a free username")
+}
+
+func ListIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	identities := []models.LinkedIdentity{}
+
+	result := database.DB.Where("user_id = ?", principal.User.ID).Order("created_at").Find(&identities)
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load identities", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: identities, Status: "success"})
+}
+
+// UnlinkIdentityHandler stops a provider account from signing in as the user. The
+// last one can't be unlinked from an account without a password, which would leave
+// the account with no way in.
+func UnlinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+
+	if err != nil {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "identity does not exist", Data: nil, Status: "error"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+
+		if result := tx.Model(&models.LinkedIdentity{}).Where("user_id = ?", principal.User.ID).Count(&count); result.Error != nil {
+			return result.Error
+		}
+
+		if count <= 1 && principal.User.Password == "" {
+			return errLastSignInMethod
+		}
+
+		result := tx.Unscoped().Where("id = ? AND user_id = ?", id, principal.User.ID).Delete(&models.LinkedIdentity{})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "identity does not exist", Data: nil, Status: "error"})
+		case errors.Is(err, errLastSignInMethod):
+			helpers.RespondWithJSON(w, http.StatusConflict, helpers.APIResponse{Message: "set a password before unlinking your last provider", Data: nil, Status: "error"})
+		default:
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to unlink identity", Data: nil, Status: "error"})
+		}
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "identity unlinked", Data: nil, Status: "success"})
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Adedunmol/zephyr/pkg/oauth"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestOAuthLogin(t *testing.T) {
+	oauth.Register(oauth.NewGitHub("client", "secret"))
+
+	router := chi.NewRouter()
+	router.Get("/users/oauth/{provider}/login", OAuthLoginHandler)
+	router.Get("/users/oauth/{provider}/callback", OAuthCallbackHandler)
+
+	serve := func(target string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		return w
+	}
+
+	t.Log("Given the need to test signing in with a provider.")
+	{
+		t.Log("\tWhen starting to sign in.")
+		{
+			w := serve("/users/oauth/github/login", nil)
+
+			if w.Code != http.StatusFound {
+				t.Fatalf("\t\tShould redirect to the provider, but got %d. %v", w.Code, ballotX)
+			}
+			t.Log("\t\tShould redirect to the provider.", checkMark)
+
+			location, _ := url.Parse(w.Header().Get("Location"))
+			params := location.Query()
+
+			var cookie *http.Cookie
+
+			for _, c := range w.Result().Cookies() {
+				if c.Name == OAUTH_STATE_COOKIE {
+					cookie = c
+				}
+			}
+
+			if cookie == nil || cookie.Path != "/users/oauth/github" || !cookie.HttpOnly {
+				t.Fatalf("\t\tShould set the state cookie on the provider's routes, but got %+v. %v", cookie, ballotX)
+			}
+			t.Log("\t\tShould set the state cookie on the provider's routes.", checkMark)
+
+			state, verifier, _ := strings.Cut(cookie.Value, ".")
+
+			if params.Get("state") != state || params.Get("code_challenge") != oauth.S256Challenge(verifier) || params.Get("code_challenge_method") != "S256" {
+				t.Errorf("\t\tShould send the state and PKCE challenge, but got %v. %v", params, ballotX)
+			}
+			t.Log("\t\tShould send the state and PKCE challenge.", checkMark)
+
+			if code := serve("/users/oauth/github/callback?code=code&state=other", cookie).Code; code != http.StatusForbidden {
+				t.Errorf("\t\tShould refuse a callback with another state, but got %d. %v", code, ballotX)
+			}
+			t.Log("\t\tShould refuse a callback with another state.", checkMark)
+
+			if code := serve("/users/oauth/github/callback?code=code&state="+state, nil).Code; code != http.StatusForbidden {
+				t.Errorf("\t\tShould refuse a callback without the cookie, but got %d. %v", code, ballotX)
+			}
+			t.Log("\t\tShould refuse a callback without the cookie.", checkMark)
+
+			if code := serve("/users/oauth/github/callback?error=access_denied&state="+state, cookie).Code; code != http.StatusBadRequest {
+				t.Errorf("\t\tShould report a denied sign-in, but got %d. %v", code, ballotX)
+			}
+			t.Log("\t\tShould report a denied sign-in.", checkMark)
+		}
+
+		t.Log("\tWhen using a provider that isn't configured.")
+		{
+			if code := serve("/users/oauth/myspace/login", nil).Code; code != http.StatusNotFound {
+				t.Errorf("\t\tShould receive a 404 status code, but got %d. %v", code, ballotX)
+			}
+			t.Log("\t\tShould receive a 404 status code.", checkMark)
+		}
+	}
+}
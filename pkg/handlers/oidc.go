@@ -0,0 +1,598 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/denylist"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/oidc"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CONSENT_EXPIRATION is how long the user has to answer the consent screen.
+const CONSENT_EXPIRATION = 10 * time.Minute
+
+func issuer() string {
+	return strings.TrimRight(helpers.EnvConfig.AppURL, "/")
+}
+
+// subject is the sub claim of user. The ID is used because, unlike the username and
+// email, it never changes.
+func subject(user *models.User) string {
+	return strconv.FormatUint(uint64(user.ID), 10)
+}
+
+func oidcProfile(user *models.User) *oidc.Profile {
+	return &oidc.Profile{
+		Subject:       subject(user),
+		Username:      user.Username,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+	}
+}
+
+func OpenIDConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	var algs []string
+
+	if helpers.Keys != nil {
+		algs = helpers.Keys.Methods()
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	helpers.RespondWithJSON(w, http.StatusOK, oidc.NewDiscovery(issuer(), algs))
+}
+
+// authorizationClient loads the client of an authorization request and checks its
+// redirect URI. Until both are known good, errors are shown to the user instead of
+// being sent to the redirect URI.
+func authorizationClient(w http.ResponseWriter, clientID, redirectURI string) (*models.Client, bool) {
+	var client models.Client
+
+	result := database.DB.Where(models.Client{ClientID: clientID}).First(&client)
+
+	if result.Error != nil || clientID == "" {
+		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			helpers.Error.Println(result.Error)
+		}
+
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "unknown client", Data: nil, Status: "error"})
+		return nil, false
+	}
+
+	if !client.AllowsGrant(models.AuthorizationCodeGrant) {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "client can't sign users in", Data: nil, Status: "error"})
+		return nil, false
+	}
+
+	if !oidc.RedirectURIAllowed(client.RedirectURIs, redirectURI) {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "redirect_uri is not registered for this client", Data: nil, Status: "error"})
+		return nil, false
+	}
+
+	return &client, true
+}
+
+// loginTime returns when the user behind principal logged in, for the auth_time
+// claim.
+func loginTime(principal *middleware.Principal) time.Time {
+	if principal.Claims.Session != 0 {
+		var session models.Session
+
+		if result := database.DB.First(&session, principal.Claims.Session); result.Error == nil {
+			return session.CreatedAt
+		}
+	}
+
+	return principal.Claims.IssuedAt.Time
+}
+
+// hasConsent reports whether user has already granted every one of scopes to client.
+func hasConsent(userID, clientID uint, scopes []string) (bool, error) {
+	var consent models.Consent
+
+	result := database.DB.Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	for _, scope := range scopes {
+		if !consent.Scopes.Has(scope) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// AuthorizeHandler starts signing the user in to a client. Users who already
+// consented to the scopes go straight back to the client with a code, the others are
+// shown the consent screen.
+func AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	request := oidc.ParseAuthorizationRequest(r.URL.Query())
+
+	client, ok := authorizationClient(w, request.ClientID, request.RedirectURI)
+
+	if !ok {
+		return
+	}
+
+	if err := request.Validate(client.Scopes); err != nil {
+		http.Redirect(w, r, oidc.RedirectWithError(request.RedirectURI, err, request.State), http.StatusFound)
+		return
+	}
+
+	requestID, err := helpers.GenerateRandomString(32)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		http.Redirect(w, r, oidc.RedirectWithError(request.RedirectURI, &oidc.Error{Code: oidc.ServerError}, request.State), http.StatusFound)
+		return
+	}
+
+	pending := models.AuthorizationRequest{
+		RequestHash:   helpers.HashToken(requestID),
+		ClientID:      client.ID,
+		Client:        *client,
+		UserID:        principal.User.ID,
+		SessionID:     principal.Claims.Session,
+		RedirectURI:   request.RedirectURI,
+		Scopes:        request.Scopes,
+		State:         request.State,
+		Nonce:         request.Nonce,
+		CodeChallenge: request.CodeChallenge,
+		AuthTime:      loginTime(principal),
+		ExpiresAt:     time.Now().Add(CONSENT_EXPIRATION),
+	}
+
+	consented, err := hasConsent(principal.User.ID, client.ID, request.Scopes)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		http.Redirect(w, r, oidc.RedirectWithError(request.RedirectURI, &oidc.Error{Code: oidc.ServerError}, request.State), http.StatusFound)
+		return
+	}
+
+	if result := database.DB.Omit(clause.Associations).Create(&pending); result.Error != nil {
+		helpers.Error.Println(result.Error)
+		http.Redirect(w, r, oidc.RedirectWithError(request.RedirectURI, &oidc.Error{Code: oidc.ServerError}, request.State), http.StatusFound)
+		return
+	}
+
+	if consented && request.Prompt != "consent" {
+		approveAuthorization(w, r, &pending)
+		return
+	}
+
+	if request.Prompt == "none" {
+		http.Redirect(w, r, oidc.RedirectWithError(request.RedirectURI, &oidc.Error{Code: oidc.ConsentRequired}, request.State), http.StatusFound)
+		return
+	}
+
+	// the consent screen must not be framed, or clicks on it could be hijacked.
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+
+	consent := oidc.NewConsent(principal.User.FirstName, client.Name, request.Scopes, requestID, "/oauth/authorize")
+
+	if err := oidc.RenderConsent(w, consent); err != nil {
+		helpers.Error.Println(err)
+	}
+}
+
+// AuthorizeDecisionHandler receives the user's answer from the consent screen. The
+// request ID is only known to the user's browser, which keeps other sites from
+// answering in their name.
+func AuthorizeDecisionHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "request body needed", Data: nil, Status: "error"})
+		return
+	}
+
+	var pending models.AuthorizationRequest
+
+	result := database.DB.Preload("Client").
+		Where("request_hash = ? AND user_id = ? AND approved_at IS NULL AND used_at IS NULL AND expires_at > ?", helpers.HashToken(r.PostForm.Get("request_id")), principal.User.ID, time.Now()).
+		First(&pending)
+
+	if result.Error != nil {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid or expired authorization request", Data: nil, Status: "error"})
+		return
+	}
+
+	if r.PostForm.Get("decision") != "allow" {
+		if result := database.DB.Model(&pending).Update("used_at", time.Now()); result.Error != nil {
+			helpers.Error.Println(result.Error)
+		}
+
+		http.Redirect(w, r, oidc.RedirectWithError(pending.RedirectURI, &oidc.Error{Code: oidc.AccessDenied, Description: "the user denied the request"}, pending.State), http.StatusSeeOther)
+		return
+	}
+
+	if err := grantConsent(pending.UserID, pending.ClientID, pending.Scopes); err != nil {
+		helpers.Error.Println(err)
+		http.Redirect(w, r, oidc.RedirectWithError(pending.RedirectURI, &oidc.Error{Code: oidc.ServerError}, pending.State), http.StatusSeeOther)
+		return
+	}
+
+	approveAuthorization(w, r, &pending)
+}
+
+// grantConsent adds scopes to what user has granted client.
+func grantConsent(userID, clientID uint, scopes models.Scopes) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var consent models.Consent
+
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent)
+
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return tx.Create(&models.Consent{UserID: userID, ClientID: clientID, Scopes: scopes}).Error
+		}
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		for _, scope := range scopes {
+			if !consent.Scopes.Has(scope) {
+				consent.Scopes = append(consent.Scopes, scope)
+			}
+		}
+
+		return tx.Model(&consent).Update("scopes", consent.Scopes).Error
+	})
+}
+
+// approveAuthorization issues the code of an authorization request and sends the
+// user back to the client with it.
+func approveAuthorization(w http.ResponseWriter, r *http.Request, pending *models.AuthorizationRequest) {
+	code, err := helpers.GenerateRandomString(32)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		http.Redirect(w, r, oidc.RedirectWithError(pending.RedirectURI, &oidc.Error{Code: oidc.ServerError}, pending.State), http.StatusSeeOther)
+		return
+	}
+
+	codeHash := helpers.HashToken(code)
+	now := time.Now()
+
+	result := database.DB.Model(&models.AuthorizationRequest{}).
+		Where("id = ? AND approved_at IS NULL", pending.ID).
+		Updates(map[string]interface{}{"code_hash": codeHash, "approved_at": now, "expires_at": now.Add(oidc.AUTHORIZATION_CODE_EXPIRATION)})
+
+	if result.Error != nil || result.RowsAffected == 0 {
+		if result.Error != nil {
+			helpers.Error.Println(result.Error)
+		}
+
+		http.Redirect(w, r, oidc.RedirectWithError(pending.RedirectURI, &oidc.Error{Code: oidc.ServerError}, pending.State), http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, oidc.RedirectWithCode(pending.RedirectURI, code, pending.State), http.StatusSeeOther)
+}
+
+func respondOAuthError(w http.ResponseWriter, status int, err *oidc.Error) {
+	w.Header().Set("Cache-Control", "no-store")
+	helpers.RespondWithJSON(w, status, err)
+}
+
+// authenticateClient identifies the client calling the token endpoint, from HTTP
+// Basic authentication or the client_id and client_secret form fields. Public
+// clients only send their ID.
+func authenticateClient(r *http.Request) (*models.Client, bool) {
+	clientID, secret, basic := r.BasicAuth()
+
+	if basic {
+		// RFC 6749 section 2.3.1 has both form encoded before they are joined.
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	if clientID == "" {
+		return nil, false
+	}
+
+	var client models.Client
+
+	if result := database.DB.Where(models.Client{ClientID: clientID}).First(&client); result.Error != nil {
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			helpers.Error.Println(result.Error)
+		}
+
+		return nil, false
+	}
+
+	if client.Public() {
+		return &client, secret == ""
+	}
+
+	return &client, subtle.ConstantTimeCompare([]byte(helpers.HashToken(secret)), []byte(client.SecretHash)) == 1
+}
+
+// requireClient authenticates the client calling one of the endpoints for clients,
+// answering invalid_client if it can't. The form has to be parsed.
+func requireClient(w http.ResponseWriter, r *http.Request) (*models.Client, bool) {
+	client, ok := authenticateClient(r)
+
+	if !ok {
+		if _, _, basic := r.BasicAuth(); basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="zephyr"`)
+		}
+
+		respondOAuthError(w, http.StatusUnauthorized, &oidc.Error{Code: oidc.InvalidClient, Description: "client authentication failed"})
+		return nil, false
+	}
+
+	return client, true
+}
+
+// OAuthTokenHandler is the token endpoint, exchanging authorization codes for an
+// access token and ID token, and issuing service tokens to clients using the
+// client_credentials grant.
+func OAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		respondOAuthError(w, http.StatusBadRequest, &oidc.Error{Code: oidc.InvalidRequest, Description: "the request must be form encoded"})
+		return
+	}
+
+	client, ok := requireClient(w, r)
+
+	if !ok {
+		return
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+
+	switch grantType {
+	case models.AuthorizationCodeGrant, models.ClientCredentialsGrant:
+	default:
+		respondOAuthError(w, http.StatusBadRequest, &oidc.Error{Code: oidc.UnsupportedGrantType})
+		return
+	}
+
+	if !client.AllowsGrant(grantType) {
+		respondOAuthError(w, http.StatusBadRequest, &oidc.Error{Code: oidc.UnauthorizedClient, Description: "the client is not registered for the " + grantType + " grant"})
+		return
+	}
+
+	if grantType == models.ClientCredentialsGrant {
+		issueServiceToken(w, r, client)
+		return
+	}
+
+	exchangeAuthorizationCode(w, r, client)
+}
+
+// issueServiceToken answers the client_credentials grant. Services get the permissions
+// they ask for out of their client's scopes, or all of them if they don't ask. No
+// refresh token is issued, the client's secret does that job.
+func issueServiceToken(w http.ResponseWriter, r *http.Request, client *models.Client) {
+	// only confidential clients can be registered for the grant, but a public client
+	// authenticating here would be let in without a secret.
+	if client.Public() {
+		respondOAuthError(w, http.StatusBadRequest, &oidc.Error{Code: oidc.UnauthorizedClient, Description: "public clients can't use the client_credentials grant"})
+		return
+	}
+
+	scopes := strings.Fields(r.PostForm.Get("scope"))
+
+	for _, scope := range scopes {
+		if _, ok := oidc.ScopeDescriptions[scope]; ok || !client.Scopes.Has(scope) {
+			respondOAuthError(w, http.StatusBadRequest, &oidc.Error{Code: oidc.InvalidScope, Description: "scope " + scope + " is not allowed for this client"})
+			return
+		}
+	}
+
+	if len(scopes) == 0 {
+		for _, scope := range client.Scopes {
+			if _, ok := oidc.ScopeDescriptions[scope]; !ok {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	scope := strings.Join(scopes, " ")
+
+	token, _, err := helpers.GenerateTypedToken("", 0, helpers.ServiceTokenType, helpers.SERVICE_TOKEN_EXPIRATION,
+		helpers.WithClient(client.ClientID, scope), helpers.WithSubject(client.ClientID))
+
+	if err != nil {
+		helpers.Error.Println(err)
+		respondOAuthError(w, http.StatusInternalServerError, &oidc.Error{Code: oidc.ServerError})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	helpers.RespondWithJSON(w, http.StatusOK, oidc.TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(helpers.SERVICE_TOKEN_EXPIRATION.Seconds()),
+		Scope:       scope,
+	})
+}
+
+func exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client *models.Client) {
+	invalidGrant := &oidc.Error{Code: oidc.InvalidGrant, Description: "the code is invalid, expired or was issued to another client"}
+
+	var authorization models.AuthorizationRequest
+
+	now := time.Now()
+
+	// the code is used up whatever the outcome, so it can't be guessed at.
+	result := database.DB.Model(&authorization).
+		Clauses(clause.Returning{}).
+		Where("code_hash = ? AND used_at IS NULL AND expires_at > ?", helpers.HashToken(r.PostForm.Get("code")), now).
+		Update("used_at", now)
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		respondOAuthError(w, http.StatusInternalServerError, &oidc.Error{Code: oidc.ServerError})
+		return
+	}
+
+	if result.RowsAffected == 0 || authorization.ClientID != client.ID || authorization.RedirectURI != r.PostForm.Get("redirect_uri") {
+		respondOAuthError(w, http.StatusBadRequest, invalidGrant)
+		return
+	}
+
+	if !oidc.VerifyPKCE(r.PostForm.Get("code_verifier"), authorization.CodeChallenge) {
+		respondOAuthError(w, http.StatusBadRequest, &oidc.Error{Code: oidc.InvalidGrant, Description: "the code_verifier does not match the code_challenge"})
+		return
+	}
+
+	var user models.User
+
+	if result := database.DB.First(&user, authorization.UserID); result.Error != nil {
+		respondOAuthError(w, http.StatusBadRequest, invalidGrant)
+		return
+	}
+
+	// the user may have logged out between approving and the exchange.
+	if authorization.SessionID != 0 {
+		active, err := models.SessionActive(database.DB, authorization.SessionID, user.ID)
+
+		if err != nil {
+			helpers.Error.Println(err)
+			respondOAuthError(w, http.StatusInternalServerError, &oidc.Error{Code: oidc.ServerError})
+			return
+		}
+
+		if !active {
+			respondOAuthError(w, http.StatusBadRequest, invalidGrant)
+			return
+		}
+	}
+
+	scope := strings.Join(authorization.Scopes, " ")
+
+	accessToken, _, err := helpers.GenerateTypedToken(user.Username, user.TokenVersion, helpers.OAuthAccessTokenType, helpers.ACCESS_TOKEN_EXPIRATION,
+		helpers.WithClient(client.ClientID, scope), helpers.WithSubject(subject(&user)), helpers.WithSession(authorization.SessionID))
+
+	if err != nil {
+		helpers.Error.Println(err)
+		respondOAuthError(w, http.StatusInternalServerError, &oidc.Error{Code: oidc.ServerError})
+		return
+	}
+
+	idToken, err := oidc.SignIDToken(oidcProfile(&user), oidc.IDToken{
+		Issuer:      issuer(),
+		ClientID:    client.ClientID,
+		Nonce:       authorization.Nonce,
+		AuthTime:    authorization.AuthTime,
+		AccessToken: accessToken,
+		Scopes:      authorization.Scopes,
+	})
+
+	if err != nil {
+		helpers.Error.Println(err)
+		respondOAuthError(w, http.StatusInternalServerError, &oidc.Error{Code: oidc.ServerError})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	helpers.RespondWithJSON(w, http.StatusOK, oidc.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(helpers.ACCESS_TOKEN_EXPIRATION.Seconds()),
+		Scope:       scope,
+		IDToken:     idToken,
+	})
+}
+
+// respondBearerError answers a request to a resource with a bad access token, as
+// described in RFC 6750 section 3.
+func respondBearerError(w http.ResponseWriter, status int, err *oidc.Error) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="zephyr", error="`+err.Code+`"`)
+	helpers.RespondWithJSON(w, status, err)
+}
+
+// UserInfoHandler returns the claims about the user an OAuth access token was issued
+// for, limited to its scopes.
+func UserInfoHandler(w http.ResponseWriter, r *http.Request) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="zephyr"`)
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, &oidc.Error{Code: oidc.InvalidRequest, Description: "an access token is required"})
+		return
+	}
+
+	invalidToken := &oidc.Error{Code: oidc.InvalidToken}
+
+	claims, err := helpers.ParseToken(strings.TrimSpace(token), helpers.OAuthAccessTokenType)
+
+	if err != nil {
+		respondBearerError(w, http.StatusUnauthorized, invalidToken)
+		return
+	}
+
+	scopes := strings.Fields(claims.Scope)
+
+	if !models.Scopes(scopes).Has(oidc.OpenIDScope) {
+		respondBearerError(w, http.StatusForbidden, &oidc.Error{Code: oidc.InsufficientScope})
+		return
+	}
+
+	if revoked, err := denylist.Default.IsRevoked(r.Context(), claims.ID); err != nil || revoked {
+		if err != nil {
+			helpers.Error.Println(err)
+		}
+
+		respondBearerError(w, http.StatusUnauthorized, invalidToken)
+		return
+	}
+
+	var user models.User
+
+	if result := database.DB.Where(models.User{Username: claims.Username}).First(&user); result.Error != nil || user.TokenVersion != claims.Version {
+		respondBearerError(w, http.StatusUnauthorized, invalidToken)
+		return
+	}
+
+	if claims.Session != 0 {
+		if active, err := models.SessionActive(database.DB, claims.Session, user.ID); err != nil || !active {
+			respondBearerError(w, http.StatusUnauthorized, invalidToken)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	helpers.RespondWithJSON(w, http.StatusOK, oidcProfile(&user).UserInfo(scopes))
+}
@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/oidc"
+	"github.com/go-chi/chi/v5"
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// testClient is a minimal OpenID Connect client, written from the specs rather than
+// from our provider code, to check what a client would see.
+type testClient struct {
+	clientID string
+	issuer   string
+	client   *http.Client
+
+	config struct {
+		Issuer                 string   `json:"issuer"`
+		AuthorizationEndpoint  string   `json:"authorization_endpoint"`
+		TokenEndpoint          string   `json:"token_endpoint"`
+		UserInfoEndpoint       string   `json:"userinfo_endpoint"`
+		JWKSURI                string   `json:"jwks_uri"`
+		ResponseTypesSupported []string `json:"response_types_supported"`
+		SubjectTypesSupported  []string `json:"subject_types_supported"`
+		SigningAlgs            []string `json:"id_token_signing_alg_values_supported"`
+		CodeChallengeMethods   []string `json:"code_challenge_methods_supported"`
+	}
+}
+
+func (rp *testClient) getJSON(url string, v interface{}) error {
+	res, err := rp.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", url, res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// discover loads the provider configuration, checking the metadata OpenID Connect
+// Discovery 1.0 section 3 requires.
+func (rp *testClient) discover() error {
+	if err := rp.getJSON(rp.issuer+"/.well-known/openid-configuration", &rp.config); err != nil {
+		return err
+	}
+
+	if rp.config.Issuer != rp.issuer {
+		return fmt.Errorf("issuer %q does not match %q", rp.config.Issuer, rp.issuer)
+	}
+
+	for name, value := range map[string]string{
+		"authorization_endpoint": rp.config.AuthorizationEndpoint,
+		"token_endpoint":         rp.config.TokenEndpoint,
+		"jwks_uri":               rp.config.JWKSURI,
+	} {
+		if !strings.HasPrefix(value, rp.issuer+"/") {
+			return fmt.Errorf("%s %q is not on the issuer", name, value)
+		}
+	}
+
+	if len(rp.config.ResponseTypesSupported) == 0 || len(rp.config.SubjectTypesSupported) == 0 || len(rp.config.SigningAlgs) == 0 {
+		return errors.New("required metadata is missing")
+	}
+
+	return nil
+}
+
+func (rp *testClient) keys() (map[string]interface{}, error) {
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+
+	if err := rp.getJSON(rp.config.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{})
+
+	for _, jwk := range set.Keys {
+		switch jwk["kty"] {
+		case "RSA":
+			n, _ := base64.RawURLEncoding.DecodeString(jwk["n"])
+			e, _ := base64.RawURLEncoding.DecodeString(jwk["e"])
+			keys[jwk["kid"]] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "OKP":
+			x, _ := base64.RawURLEncoding.DecodeString(jwk["x"])
+			keys[jwk["kid"]] = ed25519.PublicKey(x)
+		}
+	}
+
+	return keys, nil
+}
+
+// verify checks an ID token as in OpenID Connect Core 1.0 section 3.1.3.7, and its
+// at_hash as in section 3.1.3.8.
+func (rp *testClient) verify(idToken, nonce, accessToken string) (jwt.MapClaims, error) {
+	keys, err := rp.keys()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+
+	token, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		key, ok := keys[fmt.Sprint(t.Header["kid"])]
+		if !ok {
+			return nil, errors.New("unknown kid")
+		}
+
+		return key, nil
+	}, jwt.WithValidMethods(rp.config.SigningAlgs), jwt.WithIssuer(rp.issuer), jwt.WithAudience(rp.clientID), jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if azp, ok := claims["azp"]; ok && azp != rp.clientID {
+		return nil, fmt.Errorf("azp %v is not us", azp)
+	}
+
+	if claims["nonce"] != nonce {
+		return nil, fmt.Errorf("nonce %v does not match", claims["nonce"])
+	}
+
+	sum := sha256.Sum256([]byte(accessToken))
+	half := sum[:16]
+
+	if token.Method.Alg() == "EdDSA" {
+		sum := sha512.Sum512([]byte(accessToken))
+		half = sum[:32]
+	}
+
+	if claims["at_hash"] != base64.RawURLEncoding.EncodeToString(half) {
+		return nil, errors.New("at_hash does not match the access token")
+	}
+
+	return claims, nil
+}
+
+func TestOpenIDProvider(t *testing.T) {
+	defer func(config helpers.Config, keys *helpers.KeyManager) {
+		helpers.EnvConfig = config
+		helpers.Keys = keys
+	}(helpers.EnvConfig, helpers.Keys)
+
+	router := chi.NewRouter()
+	router.Get("/.well-known/openid-configuration", OpenIDConfigurationHandler)
+	router.Get("/.well-known/jwks.json", JWKSHandler)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	helpers.EnvConfig.AppURL = server.URL + "/"
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("Should be able to generate an RSA key.", ballotX, err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("Should be able to generate an Ed25519 key.", ballotX, err)
+	}
+
+	first, _ := helpers.NewSigningKey("2024-01", rsaKey)
+	second, _ := helpers.NewSigningKey("2024-02", edKey)
+
+	helpers.Keys = helpers.NewKeyManager(time.Hour)
+	helpers.Keys.Rotate(first)
+
+	rp := &testClient{clientID: "client", issuer: server.URL, client: server.Client()}
+
+	profile := &oidc.Profile{Subject: "7", Username: "ada", FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", EmailVerified: true}
+
+	sign := func(nonce, accessToken string) string {
+		idToken, err := oidc.SignIDToken(profile, oidc.IDToken{
+			Issuer:      issuer(),
+			ClientID:    "client",
+			Nonce:       nonce,
+			AuthTime:    time.Now(),
+			AccessToken: accessToken,
+			Scopes:      []string{oidc.OpenIDScope, oidc.EmailScope},
+		})
+
+		if err != nil {
+			t.Fatal("\t\tShould be able to sign an ID token.", ballotX, err)
+		}
+
+		return idToken
+	}
+
+	t.Log("Given the need to test the provider with a relying party.")
+	{
+		t.Log("\tWhen discovering the provider.")
+		{
+			if err := rp.discover(); err != nil {
+				t.Fatal("\t\tShould find valid metadata.", ballotX, err)
+			}
+			t.Log("\t\tShould find valid metadata.", checkMark)
+
+			if len(rp.config.CodeChallengeMethods) != 1 || rp.config.CodeChallengeMethods[0] != "S256" {
+				t.Errorf("\t\tShould only offer S256 PKCE, but got %v. %v", rp.config.CodeChallengeMethods, ballotX)
+			}
+			t.Log("\t\tShould only offer S256 PKCE.", checkMark)
+		}
+
+		t.Log("\tWhen verifying an ID token.")
+		{
+			idToken := sign("nonce", "access-token")
+
+			claims, err := rp.verify(idToken, "nonce", "access-token")
+
+			if err != nil {
+				t.Fatal("\t\tShould accept the token.", ballotX, err)
+			}
+			t.Log("\t\tShould accept the token.", checkMark)
+
+			if claims["sub"] != "7" || claims["email"] != "ada@example.com" || claims["email_verified"] != true || claims["auth_time"] == nil {
+				t.Errorf("\t\tShould carry the user's claims, but got %v. %v", claims, ballotX)
+			}
+			t.Log("\t\tShould carry the user's claims.", checkMark)
+
+			if _, ok := claims["name"]; ok {
+				t.Error("\t\tShould leave out the claims of scopes that weren't granted.", ballotX)
+			}
+			t.Log("\t\tShould leave out the claims of scopes that weren't granted.", checkMark)
+
+			if _, err := rp.verify(idToken, "other nonce", "access-token"); err == nil {
+				t.Error("\t\tShould refuse it for another nonce.", ballotX)
+			}
+			t.Log("\t\tShould refuse it for another nonce.", checkMark)
+
+			if _, err := rp.verify(idToken, "nonce", "other-access-token"); err == nil {
+				t.Error("\t\tShould refuse it with another access token.", ballotX)
+			}
+			t.Log("\t\tShould refuse it with another access token.", checkMark)
+
+			other := &testClient{clientID: "other", issuer: rp.issuer, client: rp.client, config: rp.config}
+
+			if _, err := other.verify(idToken, "nonce", "access-token"); err == nil {
+				t.Error("\t\tShould refuse it for another client.", ballotX)
+			}
+			t.Log("\t\tShould refuse it for another client.", checkMark)
+		}
+
+		t.Log("\tWhen the signing key is rotated.")
+		{
+			before := sign("before", "access-token")
+
+			helpers.Keys.Rotate(second)
+
+			if err := rp.discover(); err != nil {
+				t.Fatal("\t\tShould find valid metadata.", ballotX, err)
+			}
+
+			if _, err := rp.verify(before, "before", "access-token"); err != nil {
+				t.Error("\t\tShould still accept tokens signed with the retired key.", ballotX, err)
+			}
+			t.Log("\t\tShould still accept tokens signed with the retired key.", checkMark)
+
+			if _, err := rp.verify(sign("after", "access-token"), "after", "access-token"); err != nil {
+				t.Error("\t\tShould accept tokens signed with the new key.", ballotX, err)
+			}
+			t.Log("\t\tShould accept tokens signed with the new key.", checkMark)
+		}
+
+		t.Log("\tWhen no signing keys are configured.")
+		{
+			helpers.Keys = nil
+
+			if _, err := oidc.SignIDToken(profile, oidc.IDToken{Issuer: issuer(), ClientID: "client"}); !errors.Is(err, oidc.ErrNoSigningKeys) {
+				t.Errorf("\t\tShould refuse to sign with the shared secret, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould refuse to sign with the shared secret.", checkMark)
+		}
+	}
+}
+
+func TestOAuthEndpointErrors(t *testing.T) {
+	defer func(config helpers.Config) { helpers.EnvConfig = config }(helpers.EnvConfig)
+	helpers.EnvConfig.SecretKey = "oauth test secret"
+
+	t.Log("Given the need to test the errors of the OAuth endpoints.")
+	{
+		t.Log("\tWhen calling the token endpoint without client credentials.")
+		{
+			r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(url.Values{"grant_type": {"authorization_code"}, "code": {"code"}}.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			w := httptest.NewRecorder()
+			OAuthTokenHandler(w, r)
+
+			var body oidc.Error
+
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil || w.Code != http.StatusUnauthorized || body.Code != oidc.InvalidClient {
+				t.Errorf("\t\tShould answer invalid_client, but got %d %+v. %v", w.Code, body, ballotX)
+			}
+			t.Log("\t\tShould answer invalid_client.", checkMark)
+
+			if w.Header().Get("Cache-Control") != "no-store" {
+				t.Error("\t\tShould not let the response be cached.", ballotX)
+			}
+			t.Log("\t\tShould not let the response be cached.", checkMark)
+		}
+
+		for _, endpoint := range []struct {
+			path    string
+			handler http.HandlerFunc
+		}{
+			{"/oauth/introspect", IntrospectTokenHandler},
+			{"/oauth/revoke", RevokeTokenHandler},
+		} {
+			t.Logf("\tWhen calling %s without client credentials.", endpoint.path)
+			{
+				r := httptest.NewRequest(http.MethodPost, endpoint.path, strings.NewReader(url.Values{"token": {"token"}}.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+				w := httptest.NewRecorder()
+				endpoint.handler(w, r)
+
+				var body oidc.Error
+
+				if err := json.NewDecoder(w.Body).Decode(&body); err != nil || w.Code != http.StatusUnauthorized || body.Code != oidc.InvalidClient {
+					t.Errorf("\t\tShould answer invalid_client, but got %d %+v. %v", w.Code, body, ballotX)
+				}
+				t.Log("\t\tShould answer invalid_client.", checkMark)
+			}
+		}
+
+		userInfo := func(token string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest(http.MethodGet, "/oauth/userinfo", nil)
+			if token != "" {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+
+			w := httptest.NewRecorder()
+			UserInfoHandler(w, r)
+
+			return w
+		}
+
+		t.Log("\tWhen calling the userinfo endpoint without a token.")
+		{
+			if w := userInfo(""); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("\t\tShould ask for a token, but got %d. %v", w.Code, ballotX)
+			}
+			t.Log("\t\tShould ask for a token.", checkMark)
+		}
+
+		t.Log("\tWhen calling the userinfo endpoint with a login access token.")
+		{
+			token, _, _ := helpers.GenerateToken("ade", 0, time.Minute)
+
+			if w := userInfo(token); w.Code != http.StatusUnauthorized || !strings.Contains(w.Header().Get("WWW-Authenticate"), `error="invalid_token"`) {
+				t.Errorf("\t\tShould only accept tokens issued to clients, but got %d. %v", w.Code, ballotX)
+			}
+			t.Log("\t\tShould only accept tokens issued to clients.", checkMark)
+		}
+
+		t.Log("\tWhen calling the userinfo endpoint without the openid scope.")
+		{
+			token, _, _ := helpers.GenerateTypedToken("ade", 0, helpers.OAuthAccessTokenType, time.Minute, helpers.WithClient("client", "email"))
+
+			if w := userInfo(token); w.Code != http.StatusForbidden || !strings.Contains(w.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`) {
+				t.Errorf("\t\tShould refuse the token, but got %d. %v", w.Code, ballotX)
+			}
+			t.Log("\t\tShould refuse the token.", checkMark)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/schema"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+func findMembership(organizationID, userID uint) (*models.Membership, error) {
+	var membership models.Membership
+
+	result := database.DB.Preload("Organization").
+		Where("organization_id = ? AND user_id = ?", organizationID, userID).
+		First(&membership)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &membership, nil
+}
+
+// slugify turns an organization name into a URL friendly slug.
+func slugify(name string) string {
+	var b strings.Builder
+
+	dash := false
+
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+func CreateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	data, problems, err := helpers.DecodeJSON[*schema.CreateOrganization](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	slug := slugify(data.Slug)
+	if slug == "" {
+		slug = slugify(data.Name)
+	}
+
+	if slug == "" {
+		helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: map[string]string{"Slug": "Field 'Slug' must contain letters or digits"}})
+		return
+	}
+
+	organization := models.Organization{Name: data.Name, Slug: slug}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Create(&organization); result.Error != nil {
+			return result.Error
+		}
+
+		membership := models.Membership{OrganizationID: organization.ID, UserID: principal.User.ID, Role: models.OrganizationOwnerRole}
+
+		return tx.Create(&membership).Error
+	})
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			helpers.RespondWithJSON(w, http.StatusConflict, helpers.APIResponse{Message: "organization slug is taken", Data: nil, Status: "error"})
+			return
+		}
+
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to create organization", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusCreated, helpers.APIResponse{Message: "", Data: organization, Status: "success"})
+}
+
+// ListOrganizationsHandler lists the organizations the user is a member of, along
+// with their role in each.
+func ListOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	memberships := []models.Membership{}
+
+	result := database.DB.Preload("Organization").Where("user_id = ?", principal.User.ID).Order("created_at").Find(&memberships)
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load organizations", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: memberships, Status: "success"})
+}
+
+// SwitchOrganizationHandler issues tokens scoped to another organization the user
+// is a member of. The switch stays within the current session: the refresh token
+// presented is used up and its family goes on with the new tokens.
+func SwitchOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+
+	if err != nil {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "organization does not exist", Data: nil, Status: "error"})
+		return
+	}
+
+	membership, err := findMembership(uint(id), principal.User.ID)
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// not telling members of other organizations apart from missing ones.
+			helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "organization does not exist", Data: nil, Status: "error"})
+			return
+		}
+
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load membership", Data: nil, Status: "error"})
+		return
+	}
+
+	// switching stays within the session: the presented refresh token is used up like
+	// on a refresh and the family goes on with tokens scoped to the new organization.
+	family := ""
+
+	if cookie, err := r.Cookie(REFRESH_TOKEN_COOKIE); err == nil {
+		claims, err := helpers.ParseToken(cookie.Value, helpers.RefreshTokenType)
+
+		if err == nil && claims.Username == principal.User.Username {
+			result := database.DB.Model(&models.RefreshToken{}).
+				Where("token_id = ? AND family = ? AND used_at IS NULL AND revoked_at IS NULL", claims.ID, claims.Family).
+				Update("used_at", time.Now())
+
+			if result.Error != nil {
+				helpers.Error.Println(result.Error)
+			} else if result.RowsAffected == 1 {
+				family = claims.Family
+			}
+		}
+	}
+
+	issueTokens(w, r, *principal.User, family, membership.OrganizationID)
+}
+
+func GetCurrentOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok || principal.Membership == nil {
+		helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "no organization selected", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: principal.Membership, Status: "success"})
+}
+
+func ListMembersHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok || principal.Membership == nil {
+		helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "no organization selected", Data: nil, Status: "error"})
+		return
+	}
+
+	page, size := pagination(r)
+
+	members := []models.Membership{}
+
+	result := database.DB.Preload("User").
+		Where("organization_id = ?", principal.Membership.OrganizationID).
+		Order("created_at").Offset((page - 1) * size).Limit(size).
+		Find(&members)
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load members", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: members, Status: "success"})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/password"
+	"github.com/Adedunmol/zephyr/pkg/schema"
+	"gorm.io/gorm"
+)
+
+const PASSWORD_RESET_EXPIRATION = 30 * time.Minute
+
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	data, problems, err := helpers.DecodeJSON[*schema.ForgotPassword](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	// the response is the same, and as quick, whether or not the email belongs to an
+	// account, so this endpoint can't be used to find out who is registered.
+	go sendPasswordReset(data.Email)
+
+	helpers.RespondWithJSON(w, http.StatusAccepted, helpers.APIResponse{Message: "if an account exists for this email, a password reset link has been sent", Data: nil, Status: "success"})
+}
+
+// sendPasswordReset mails a reset link to the account with email, if there is one. It
+// runs in the background, so that the time taken doesn't give the account away.
+func sendPasswordReset(email string) {
+	var foundUser models.User
+
+	result := database.DB.Where(models.User{Email: email}).First(&foundUser)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return
+	}
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		return
+	}
+
+	token, err := createUserToken(foundUser.ID, models.PasswordResetPurpose, PASSWORD_RESET_EXPIRATION)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		return
+	}
+
+	sendPasswordResetEmail(foundUser, token)
+}
+
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	data, problems, err := helpers.DecodeJSON[*schema.ResetPassword](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	// check the password against the account before the token is used up, so that a
+	// rejected password can be retried with the same link.
+	var pendingToken models.UserToken
+
+	result := database.DB.Preload("User").
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", helpers.HashToken(data.Token), models.PasswordResetPurpose, time.Now()).
+		First(&pendingToken)
+
+	if result.Error != nil {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid or expired token", Data: nil, Status: "error"})
+		return
+	}
+
+	if problems := schema.CheckPassword(map[string]string{}, "Password", data.Password, pendingToken.User.Username, pendingToken.User.Email); len(problems) != 0 {
+		helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+		return
+	}
+
+	hashedPassword, err := password.Hash(data.Password)
+
+	if err != nil {
+		helpers.Info.Println("could not hash password", err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "Unable to hash password", Data: nil, Status: "error"})
+		return
+	}
+
+	// the token is only spent if the password is changed and the sessions revoked.
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		userToken, err := consumeUserToken(tx, data.Token, models.PasswordResetPurpose)
+
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.User{}).Where("id = ?", userToken.UserID).Update("password", hashedPassword)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		return revokeAllSessions(tx, userToken.UserID)
+	})
+
+	if errors.Is(err, errInvalidUserToken) {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid or expired token", Data: nil, Status: "error"})
+		return
+	}
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to reset password", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "password has been reset", Data: nil, Status: "success"})
+}
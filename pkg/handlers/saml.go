@@ -0,0 +1,707 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/oauth"
+	"github.com/Adedunmol/zephyr/pkg/saml"
+	"github.com/Adedunmol/zephyr/pkg/schema"
+	"github.com/Adedunmol/zephyr/pkg/tenant"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SAML_REQUEST_COOKIE holds the ID of the authentication request sent to the identity
+// provider until its response comes back.
+const SAML_REQUEST_COOKIE = "saml_request"
+
+// SAML_LINK_COOKIE holds the hash of the link token relayed to the identity provider,
+// which ties its response to the browser that asked for the link.
+const SAML_LINK_COOKIE = "saml_link"
+
+const SAML_REQUEST_EXPIRATION = 10 * time.Minute
+
+var (
+	errSAMLNotConfigured = errors.New("SAML sign-in not configured")
+	errSAMLLinkRequired  = errors.New("account has to be linked by its user")
+	errIdentityLinked    = errors.New("identity linked to another account")
+)
+
+func samlPath(organization *models.Organization) string {
+	return "/saml/" + organization.Slug
+}
+
+func samlURL(organization *models.Organization, endpoint string) string {
+	return strings.TrimRight(helpers.EnvConfig.AppURL, "/") + samlPath(organization) + "/" + endpoint
+}
+
+// samlProviderName names the linked identities of users signing in with the identity
+// provider of organization. The ID is used as slugs can be taken again.
+func samlProviderName(organization *models.Organization) string {
+	return "saml:" + strconv.FormatUint(uint64(organization.ID), 10)
+}
+
+// samlOrganization returns the organization named in the URL, if SAML sign-in is on.
+func samlOrganization(r *http.Request) (*models.Organization, error) {
+	if saml.Default == nil {
+		return nil, errSAMLNotConfigured
+	}
+
+	slug := chi.URLParam(r, "slug")
+
+	if slug == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var organization models.Organization
+
+	if result := database.DB.Where(models.Organization{Slug: slug}).First(&organization); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &organization, nil
+}
+
+// samlProvider returns the organization named in the URL along with its identity
+// provider.
+func samlProvider(r *http.Request) (*models.Organization, *models.SAMLProvider, *saml.Provider, error) {
+	organization, err := samlOrganization(r)
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var config models.SAMLProvider
+
+	result := database.DB.WithContext(tenant.WithOrganization(r.Context(), organization.ID)).First(&config)
+
+	if result.Error != nil {
+		return nil, nil, nil, result.Error
+	}
+
+	provider, err := saml.Default.Provider(samlURL(organization, "metadata"), samlURL(organization, "acs"), saml.IdentityProvider{
+		EntityID:    config.EntityID,
+		SSOURL:      config.SSOURL,
+		Certificate: config.Certificate,
+	}, saml.AttributeMapping{
+		Email:     config.EmailAttribute,
+		Username:  config.UsernameAttribute,
+		FirstName: config.FirstNameAttribute,
+		LastName:  config.LastNameAttribute,
+	})
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return organization, &config, provider, nil
+}
+
+func respondSAMLProviderError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errSAMLNotConfigured) || errors.Is(err, gorm.ErrRecordNotFound) {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "organization does not use SAML sign-in", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.Error.Println(err)
+	helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to sign in with SAML", Data: nil, Status: "error"})
+}
+
+// SAMLMetadataHandler serves the service provider metadata of an organization, which
+// its identity provider is configured with. It is available before the identity
+// provider has been set up.
+func SAMLMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	organization, err := samlOrganization(r)
+
+	if err != nil {
+		respondSAMLProviderError(w, err)
+		return
+	}
+
+	metadata, err := saml.Default.Metadata(samlURL(organization, "metadata"), samlURL(organization, "acs"))
+
+	if err != nil {
+		respondSAMLProviderError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(metadata)
+}
+
+// SAMLLoginHandler sends the user to the identity provider of the organization. The ID
+// of the request stays in a cookie scoped to the organization's routes, which ties the
+// response to the browser that started the sign-in.
+func SAMLLoginHandler(w http.ResponseWriter, r *http.Request) {
+	organization, _, provider, err := samlProvider(r)
+
+	if err != nil {
+		respondSAMLProviderError(w, err)
+		return
+	}
+
+	redirect, requestID, err := provider.AuthnRequestURL("", "")
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to start sign-in", Data: nil, Status: "error"})
+		return
+	}
+
+	// the response is posted from the identity provider's site, which only carries
+	// the cookie along when it is SameSite=None.
+	http.SetCookie(w, &http.Cookie{
+		Name:     SAML_REQUEST_COOKIE,
+		Value:    requestID,
+		Path:     samlPath(organization),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(helpers.EnvConfig.AppURL, "https://"),
+		SameSite: http.SameSiteNoneMode,
+		MaxAge:   int(SAML_REQUEST_EXPIRATION.Seconds()),
+	})
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// SAMLACSHandler is the assertion consumer service of an organization. Responses to a
+// sign-in started by SAMLLoginHandler sign the user in, creating an account and a
+// membership for users signing in for the first time. Responses relaying the token of
+// StartSAMLLinkHandler link the identity to the account that asked for it instead.
+func SAMLACSHandler(w http.ResponseWriter, r *http.Request) {
+	organization, config, provider, err := samlProvider(r)
+
+	if err != nil {
+		respondSAMLProviderError(w, err)
+		return
+	}
+
+	if token := r.PostFormValue("RelayState"); token != "" {
+		finishSAMLLink(w, r, organization, config, provider, token)
+		return
+	}
+
+	cookie, err := r.Cookie(SAML_REQUEST_COOKIE)
+
+	if err != nil || cookie.Value == "" {
+		helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "sign-in was started in another browser or has expired", Data: nil, Status: "error"})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: SAML_REQUEST_COOKIE, Value: "", Path: samlPath(organization), HttpOnly: true, MaxAge: -1})
+
+	identity, ok := parseSAMLResponse(w, r, organization, config, provider, cookie.Value)
+
+	if !ok {
+		return
+	}
+
+	user, err := samlUser(organization, config, identity)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, errSAMLLinkRequired):
+			helpers.RespondWithJSON(w, http.StatusConflict, helpers.APIResponse{Message: "an account with this email exists, sign in and link it to the organization's identity provider", Data: nil, Status: "error"})
+		case errors.Is(err, errAccountEmailUnverified):
+			helpers.RespondWithJSON(w, http.StatusConflict, helpers.APIResponse{Message: "an account with this email exists, verify it before signing in with SAML", Data: nil, Status: "error"})
+		default:
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to sign in with SAML", Data: nil, Status: "error"})
+		}
+		return
+	}
+
+	if locked, retryAfter := accountLocked(user); locked {
+		respondLockedOut(w, retryAfter)
+		return
+	}
+
+	completeLogin(w, r, *user, organization.ID)
+}
+
+// parseSAMLResponse checks the response to the request with requestID, answering the
+// request itself when the response is rejected. Emails outside the verified domains of
+// the organization are rejected, as its administrators could assert anyone's.
+func parseSAMLResponse(w http.ResponseWriter, r *http.Request, organization *models.Organization, config *models.SAMLProvider, provider *saml.Provider, requestID string) (*saml.Identity, bool) {
+	identity, err := provider.ParseResponse(r, requestID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, saml.ErrMissingEmail):
+			helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "the identity provider did not send an email address", Data: nil, Status: "error"})
+		case errors.Is(err, saml.ErrTransientNameID):
+			helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "the identity provider must send a persistent name ID", Data: nil, Status: "error"})
+		default:
+			helpers.Warning.Println(organization.Slug, err)
+			helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "invalid SAML response", Data: nil, Status: "error"})
+		}
+		return nil, false
+	}
+
+	if !saml.EmailInDomains(identity.Email, config.Domains) {
+		helpers.Warning.Println(organization.Slug, "assertion for an email outside the verified domains")
+		helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "the email address is not at a verified domain of the organization", Data: nil, Status: "error"})
+		return nil, false
+	}
+
+	return identity, true
+}
+
+// samlUser returns the user identity signs in as, provisioning their account and
+// membership on their first sign-in. Existing accounts are only linked when
+// samlLinkable allows it; their users have to link them with StartSAMLLinkHandler
+// otherwise.
+func samlUser(organization *models.Organization, config *models.SAMLProvider, identity *saml.Identity) (*models.User, error) {
+	provider := samlProviderName(organization)
+
+	var linked models.LinkedIdentity
+
+	result := database.DB.Preload("User").Where("provider = ? AND subject = ?", provider, identity.Subject).First(&linked)
+
+	if result.Error == nil && linked.User.ID == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if result.Error == nil {
+		result = database.DB.Model(&linked).Updates(map[string]interface{}{"email": identity.Email, "last_login_at": time.Now()})
+
+		if result.Error != nil {
+			helpers.Error.Println(result.Error)
+		}
+
+		if err := joinSAMLOrganization(database.DB, organization, config, linked.User.ID); err != nil {
+			return nil, err
+		}
+
+		return &linked.User, nil
+	}
+
+	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, result.Error
+	}
+
+	var user models.User
+
+	provisioned := false
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where(models.User{Email: identity.Email}).First(&user)
+
+		switch {
+		case result.Error == nil:
+			if user.EmailVerifiedAt == nil {
+				return errAccountEmailUnverified
+			}
+
+			linkable, err := samlLinkable(tx, &user, organization.ID)
+
+			if err != nil {
+				return err
+			}
+
+			if !linkable {
+				return errSAMLLinkRequired
+			}
+		case errors.Is(result.Error, gorm.ErrRecordNotFound):
+			created, err := registerIdentityUser(tx, samlProfile(identity))
+
+			if err != nil {
+				return err
+			}
+
+			user = *created
+			provisioned = true
+		default:
+			return result.Error
+		}
+
+		return createSAMLIdentity(tx, organization, config, &user, identity)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// accounts provisioned here start out unverified, like those signing up with a password.
+	if provisioned {
+		token, err := createUserToken(user.ID, models.EmailVerificationPurpose, EMAIL_VERIFICATION_EXPIRATION)
+
+		if err != nil {
+			helpers.Error.Println(err)
+		} else {
+			sendVerificationEmail(user, token)
+		}
+	}
+
+	return &user, nil
+}
+
+// samlLinkable reports whether user's account may be linked to the identity provider
+// of organization without them confirming it. The organization's administrators
+// decide what its identity provider asserts, so that is only the case for accounts
+// giving access to nothing beyond the organization: without roles other than the
+// default one, and without memberships of other organizations.
+func samlLinkable(tx *gorm.DB, user *models.User, organizationID uint) (bool, error) {
+	var memberships int64
+
+	result := tx.Model(&models.Membership{}).Where("user_id = ? AND organization_id <> ?", user.ID, organizationID).Count(&memberships)
+
+	if result.Error != nil || memberships > 0 {
+		return false, result.Error
+	}
+
+	var roles int64
+
+	result = tx.Table("user_roles").
+		Joins("JOIN roles ON roles.id = user_roles.role_id AND roles.deleted_at IS NULL").
+		Where("user_roles.user_id = ? AND roles.name <> ?", user.ID, models.UserRole).
+		Count(&roles)
+
+	return roles == 0, result.Error
+}
+
+// samlProfile is the profile accounts are provisioned from. The email isn't marked
+// verified: the organization has proven it owns the domain, not that the address
+// reaches the user, and verified emails let other providers link into the account.
+func samlProfile(identity *saml.Identity) *oauth.Profile {
+	return &oauth.Profile{
+		Subject:       identity.Subject,
+		Email:         identity.Email,
+		EmailVerified: false,
+		Username:      identity.Username,
+		FirstName:     identity.FirstName,
+		LastName:      identity.LastName,
+	}
+}
+
+// createSAMLIdentity links identity to user and makes them a member of organization.
+func createSAMLIdentity(tx *gorm.DB, organization *models.Organization, config *models.SAMLProvider, user *models.User, identity *saml.Identity) error {
+	now := time.Now()
+
+	result := tx.Create(&models.LinkedIdentity{
+		UserID:      user.ID,
+		Provider:    samlProviderName(organization),
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		LastLoginAt: &now,
+	})
+
+	if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+		return errIdentityLinked
+	}
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	return joinSAMLOrganization(tx, organization, config, user.ID)
+}
+
+// joinSAMLOrganization makes the user a member of organization with the default role
+// of its identity provider. Members keep the role they have.
+func joinSAMLOrganization(tx *gorm.DB, organization *models.Organization, config *models.SAMLProvider, userID uint) error {
+	role := config.DefaultRole
+
+	if role == "" {
+		role = models.OrganizationMemberRole
+	}
+
+	membership := models.Membership{OrganizationID: organization.ID, UserID: userID, Role: role}
+
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&membership).Error
+}
+
+// samlLinkRequestID derives the ID of the authentication request linking an account
+// from the link token relayed along with it, which ties the response to the token.
+func samlLinkRequestID(token string) string {
+	return "id-" + helpers.HashToken(models.SAMLLinkPurpose+":"+token)
+}
+
+type samlLinkResponse struct {
+	RedirectURL string `json:"redirect_url"`
+}
+
+// StartSAMLLinkHandler lets a signed-in user link their account to the identity
+// provider of an organization, which accounts with more than the organization to
+// lose have to do before signing in with it. The returned URL sends them to the
+// identity provider with a single-use link token as the relay state.
+func StartSAMLLinkHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	organization, _, provider, err := samlProvider(r)
+
+	if err != nil {
+		respondSAMLProviderError(w, err)
+		return
+	}
+
+	token, err := createUserToken(principal.User.ID, models.SAMLLinkPurpose, SAML_REQUEST_EXPIRATION)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to start linking", Data: nil, Status: "error"})
+		return
+	}
+
+	redirect, _, err := provider.AuthnRequestURL(samlLinkRequestID(token), token)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to start linking", Data: nil, Status: "error"})
+		return
+	}
+
+	// without it, the redirect could be handed to someone else, whose identity would
+	// then be linked to this account.
+	http.SetCookie(w, &http.Cookie{
+		Name:     SAML_LINK_COOKIE,
+		Value:    helpers.HashToken(token),
+		Path:     samlPath(organization),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(helpers.EnvConfig.AppURL, "https://"),
+		SameSite: http.SameSiteNoneMode,
+		MaxAge:   int(SAML_REQUEST_EXPIRATION.Seconds()),
+	})
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: samlLinkResponse{RedirectURL: redirect.String()}, Status: "success"})
+}
+
+// finishSAMLLink links the identity in the response to the account the link token was
+// issued to, provided it comes back to the browser that asked for the link. The token
+// is only spent once the response has been checked.
+func finishSAMLLink(w http.ResponseWriter, r *http.Request, organization *models.Organization, config *models.SAMLProvider, provider *saml.Provider, token string) {
+	cookie, err := r.Cookie(SAML_LINK_COOKIE)
+
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(helpers.HashToken(token))) != 1 {
+		helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "linking was started in another browser or has expired", Data: nil, Status: "error"})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: SAML_LINK_COOKIE, Value: "", Path: samlPath(organization), HttpOnly: true, MaxAge: -1})
+
+	identity, ok := parseSAMLResponse(w, r, organization, config, provider, samlLinkRequestID(token))
+
+	if !ok {
+		return
+	}
+
+	userToken, err := consumeUserToken(database.DB, token, models.SAMLLinkPurpose)
+
+	if err != nil {
+		if errors.Is(err, errInvalidUserToken) {
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid or expired link", Data: nil, Status: "error"})
+			return
+		}
+
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to link identity", Data: nil, Status: "error"})
+		return
+	}
+
+	var user models.User
+
+	if result := database.DB.First(&user, userToken.UserID); result.Error != nil {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid or expired link", Data: nil, Status: "error"})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return createSAMLIdentity(tx, organization, config, &user, identity)
+	})
+
+	if err != nil {
+		if errors.Is(err, errIdentityLinked) {
+			helpers.RespondWithJSON(w, http.StatusConflict, helpers.APIResponse{Message: "this identity is linked to another account", Data: nil, Status: "error"})
+			return
+		}
+
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to link identity", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "identity linked", Data: nil, Status: "success"})
+}
+
+// GetSAMLProviderHandler returns the identity provider of the current organization.
+func GetSAMLProviderHandler(w http.ResponseWriter, r *http.Request) {
+	var config models.SAMLProvider
+
+	result := database.DB.WithContext(r.Context()).First(&config)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "SAML sign-in is not configured", Data: nil, Status: "error"})
+		return
+	}
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load SAML configuration", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: config, Status: "success"})
+}
+
+// samlResolver looks up the verification records of domains.
+var samlResolver saml.Resolver = net.DefaultResolver
+
+// verifySAMLDomains checks that the organization owns each of domains, save for the
+// verified ones it already had. The problems tell which record each unverified domain
+// has to publish.
+func verifySAMLDomains(ctx context.Context, organization uint, domains []string, verified models.Scopes) (models.Scopes, map[string]string) {
+	problems := make(map[string]string)
+
+	var checked models.Scopes
+
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+		if checked.Has(domain) {
+			continue
+		}
+
+		checked = append(checked, domain)
+
+		if verified.Has(domain) {
+			continue
+		}
+
+		challenge := saml.DomainChallenge(helpers.EnvConfig.SecretKey, organization, domain)
+
+		if err := saml.VerifyDomain(ctx, samlResolver, domain, challenge); err != nil {
+			problems[domain] = fmt.Sprintf("add a TXT record for %s%s with the value %s", saml.DOMAIN_VERIFICATION_RECORD, domain, challenge)
+		}
+	}
+
+	return checked, problems
+}
+
+// ConfigureSAMLProviderHandler sets up the identity provider of the current
+// organization, replacing the one it had. New domains are checked for their
+// verification record before they are saved.
+func ConfigureSAMLProviderHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok || principal.Membership == nil {
+		helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "no organization selected", Data: nil, Status: "error"})
+		return
+	}
+
+	data, problems, err := helpers.DecodeJSON[*schema.ConfigureSAML](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	if _, err := saml.ParseCertificate(data.Certificate); err != nil {
+		helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: map[string]string{"Certificate": "Field 'Certificate' must be a PEM encoded certificate"}})
+		return
+	}
+
+	var config models.SAMLProvider
+
+	result := database.DB.WithContext(r.Context()).First(&config)
+
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to save SAML configuration", Data: nil, Status: "error"})
+		return
+	}
+
+	domains, problems := verifySAMLDomains(r.Context(), principal.Membership.OrganizationID, data.Domains, config.Domains)
+
+	if len(problems) > 0 {
+		helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "domain ownership not verified", Data: problems})
+		return
+	}
+
+	err = database.DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&config)
+
+		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return result.Error
+		}
+
+		config.EntityID = data.EntityID
+		config.SSOURL = data.SSOURL
+		config.Certificate = data.Certificate
+		config.Domains = domains
+		config.EmailAttribute = data.EmailAttribute
+		config.UsernameAttribute = data.UsernameAttribute
+		config.FirstNameAttribute = data.FirstNameAttribute
+		config.LastNameAttribute = data.LastNameAttribute
+		config.DefaultRole = data.DefaultRole
+
+		// the organization is filled in from the request context.
+		if config.ID == 0 {
+			return tx.Create(&config).Error
+		}
+
+		return tx.Save(&config).Error
+	})
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to save SAML configuration", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "SAML configuration saved", Data: config, Status: "success"})
+}
+
+// DeleteSAMLProviderHandler turns SAML sign-in off for the current organization.
+// Accounts provisioned through it keep their other ways of signing in.
+func DeleteSAMLProviderHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok || principal.Membership == nil {
+		helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "no organization selected", Data: nil, Status: "error"})
+		return
+	}
+
+	result := database.DB.WithContext(r.Context()).
+		Where("organization_id = ?", principal.Membership.OrganizationID).
+		Delete(&models.SAMLProvider{})
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to delete SAML configuration", Data: nil, Status: "error"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "SAML sign-in is not configured", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "SAML configuration deleted", Data: nil, Status: "success"})
+}
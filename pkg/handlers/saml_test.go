@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/saml"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestSAMLEndpoints(t *testing.T) {
+	defer func(sp *saml.ServiceProvider) { saml.Default = sp }(saml.Default)
+	saml.Default = nil
+
+	t.Log("Given the need to test the SAML endpoints.")
+	{
+		for _, endpoint := range []struct {
+			method  string
+			path    string
+			handler http.HandlerFunc
+		}{
+			{http.MethodGet, "/saml/acme/metadata", SAMLMetadataHandler},
+			{http.MethodGet, "/saml/acme/login", SAMLLoginHandler},
+			{http.MethodPost, "/saml/acme/acs", SAMLACSHandler},
+		} {
+			t.Logf("\tWhen calling %s without a SAML key pair configured.", endpoint.path)
+			{
+				routeContext := chi.NewRouteContext()
+				routeContext.URLParams.Add("slug", "acme")
+
+				r := httptest.NewRequest(endpoint.method, endpoint.path, nil)
+				r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+
+				w := httptest.NewRecorder()
+				endpoint.handler(w, r)
+
+				if w.Code != http.StatusNotFound {
+					t.Errorf("\t\tShould answer 404, but got %d. %v", w.Code, ballotX)
+				}
+				t.Log("\t\tShould answer 404.", checkMark)
+			}
+		}
+
+		t.Log("\tWhen starting to link a SAML identity without being signed in.")
+		{
+			r := httptest.NewRequest(http.MethodPost, "/users/me/identities/saml/acme", nil)
+
+			w := httptest.NewRecorder()
+			StartSAMLLinkHandler(w, r)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("\t\tShould answer 401, but got %d. %v", w.Code, ballotX)
+			}
+			t.Log("\t\tShould answer 401.", checkMark)
+		}
+
+		t.Log("\tWhen deriving the request ID of a link.")
+		{
+			if samlLinkRequestID("token") != samlLinkRequestID("token") {
+				t.Errorf("\t\tShould derive the same ID from a token. %v", ballotX)
+			}
+			t.Log("\t\tShould derive the same ID from a token.", checkMark)
+
+			if samlLinkRequestID("token") == samlLinkRequestID("other") {
+				t.Errorf("\t\tShould derive different IDs from different tokens. %v", ballotX)
+			}
+			t.Log("\t\tShould derive different IDs from different tokens.", checkMark)
+		}
+	}
+}
+
+type txtRecords map[string][]string
+
+func (r txtRecords) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if records, ok := r[name]; ok {
+		return records, nil
+	}
+
+	return nil, errors.New("no such host")
+}
+
+func TestVerifySAMLDomains(t *testing.T) {
+	defer func(resolver saml.Resolver) { samlResolver = resolver }(samlResolver)
+	defer func(secret string) { helpers.EnvConfig.SecretKey = secret }(helpers.EnvConfig.SecretKey)
+	helpers.EnvConfig.SecretKey = "secret"
+
+	samlResolver = txtRecords{
+		saml.DOMAIN_VERIFICATION_RECORD + "acme.com": {saml.DomainChallenge("secret", 1, "acme.com")},
+	}
+
+	t.Log("Given the need to test verifying the domains of an identity provider.")
+	{
+		t.Log("\tWhen a new domain publishes its challenge.")
+		{
+			domains, problems := verifySAMLDomains(context.Background(), 1, []string{"ACME.com.", "acme.com"}, nil)
+
+			if len(problems) != 0 || len(domains) != 1 || domains[0] != "acme.com" {
+				t.Errorf("\t\tShould keep the domain once, in lower case, but got %v %v. %v", domains, problems, ballotX)
+			}
+			t.Log("\t\tShould keep the domain once, in lower case.", checkMark)
+		}
+
+		t.Log("\tWhen the challenge is another organization's.")
+		{
+			_, problems := verifySAMLDomains(context.Background(), 2, []string{"acme.com"}, nil)
+
+			if _, ok := problems["acme.com"]; !ok {
+				t.Errorf("\t\tShould report the record to publish. %v", ballotX)
+			}
+			t.Log("\t\tShould report the record to publish.", checkMark)
+		}
+
+		t.Log("\tWhen the domain was verified before.")
+		{
+			_, problems := verifySAMLDomains(context.Background(), 1, []string{"example.com"}, models.Scopes{"example.com"})
+
+			if len(problems) != 0 {
+				t.Errorf("\t\tShould not check it again, but got %v. %v", problems, ballotX)
+			}
+			t.Log("\t\tShould not check it again.", checkMark)
+		}
+	}
+}
+
+// newSAMLKeyPair returns a key with a self-signed certificate, as used by service and
+// identity providers alike.
+func newSAMLKeyPair(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("Should be able to generate a key.", ballotX, err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "zephyr"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Should be able to create a certificate.", ballotX, err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("Should be able to parse the certificate.", ballotX, err)
+	}
+
+	return key, certificate
+}
+
+func TestFinishSAMLLink(t *testing.T) {
+	defer func(sp *saml.ServiceProvider) { saml.Default = sp }(saml.Default)
+
+	key, certificate := newSAMLKeyPair(t)
+	saml.Default = &saml.ServiceProvider{Key: key, Certificate: certificate}
+
+	_, idpCertificate := newSAMLKeyPair(t)
+	idpPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: idpCertificate.Raw}))
+
+	const token = "link-token"
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"the response arrives without the link cookie", nil},
+		{"the link cookie is for another link", &http.Cookie{Name: SAML_LINK_COOKIE, Value: helpers.HashToken("other-token")}},
+	}
+
+	t.Log("Given the need to test tying SAML links to the browser that asked for them.")
+	{
+		for _, tt := range tests {
+			t.Logf("\tWhen %s.", tt.name)
+			{
+				mock := mockDatabase(t)
+
+				mock.ExpectQuery(`SELECT \* FROM "organizations"`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "slug"}).AddRow(1, "acme"))
+				mock.ExpectQuery(`SELECT \* FROM "saml_providers"`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "organization_id", "entity_id", "sso_url", "certificate", "domains"}).
+						AddRow(1, 1, "https://idp.example.com/metadata", "https://idp.example.com/sso", idpPEM, "acme.com"))
+
+				routeContext := chi.NewRouteContext()
+				routeContext.URLParams.Add("slug", "acme")
+
+				form := url.Values{"SAMLResponse": {"response"}, "RelayState": {token}}
+
+				r := httptest.NewRequest(http.MethodPost, "/saml/acme/acs", strings.NewReader(form.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+
+				if tt.cookie != nil {
+					r.AddCookie(tt.cookie)
+				}
+
+				w := httptest.NewRecorder()
+				SAMLACSHandler(w, r)
+
+				var payload struct {
+					Message string `json:"message"`
+				}
+
+				json.NewDecoder(w.Body).Decode(&payload)
+
+				// the response itself is rejected too, so the message tells which check failed.
+				if w.Code != http.StatusForbidden || !strings.Contains(payload.Message, "another browser") {
+					t.Errorf("\t\tShould reject the link before checking the response, but got %d %q. %v", w.Code, payload.Message, ballotX)
+				}
+				t.Log("\t\tShould reject the link before checking the response.", checkMark)
+
+				if err := mock.ExpectationsWereMet(); err != nil {
+					t.Errorf("\t\tShould not spend the link token: %v %v", err, ballotX)
+				}
+				t.Log("\t\tShould not spend the link token.", checkMark)
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+const MAX_USER_AGENT_LENGTH = 512
+
+func userAgent(r *http.Request) string {
+	agent := r.UserAgent()
+
+	if len(agent) > MAX_USER_AGENT_LENGTH {
+		return agent[:MAX_USER_AGENT_LENGTH]
+	}
+
+	return agent
+}
+
+// touchSession returns the session of a refresh token family, creating it on login.
+// newDevice is set when the user has logged in before, but never from this user
+// agent.
+func touchSession(r *http.Request, user models.User, family string) (session *models.Session, newDevice bool, err error) {
+	now := time.Now()
+	expiresAt := now.Add(helpers.REFRESH_TOKEN_EXPIRATION)
+
+	session = &models.Session{}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where(models.Session{Family: family}).First(session)
+
+		if result.Error == nil {
+			return tx.Model(session).Updates(models.Session{IPAddress: clientIP(r), LastSeenAt: now, ExpiresAt: expiresAt}).Error
+		}
+
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return result.Error
+		}
+
+		var total, known int64
+
+		if err := tx.Model(&models.Session{}).Where("user_id = ?", user.ID).Count(&total).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Session{}).Where("user_id = ? AND user_agent = ?", user.ID, userAgent(r)).Count(&known).Error; err != nil {
+			return err
+		}
+
+		newDevice = total > 0 && known == 0
+
+		*session = models.Session{
+			UserID:     user.ID,
+			Family:     family,
+			UserAgent:  userAgent(r),
+			IPAddress:  clientIP(r),
+			LastSeenAt: now,
+			ExpiresAt:  expiresAt,
+		}
+
+		return tx.Create(session).Error
+	})
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return session, newDevice, nil
+}
+
+func ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	sessions := []models.Session{}
+
+	result := database.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", principal.User.ID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions)
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load sessions", Data: nil, Status: "error"})
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == principal.Claims.Session
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: sessions, Status: "success"})
+}
+
+// RevokeSessionHandler logs one of the user's devices out. Its access token stops
+// working right away and its refresh token can't be used anymore.
+func RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+
+	if err != nil {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "session does not exist", Data: nil, Status: "error"})
+		return
+	}
+
+	var session models.Session
+
+	result := database.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, principal.User.ID).First(&session)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "session does not exist", Data: nil, Status: "error"})
+			return
+		}
+
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load session", Data: nil, Status: "error"})
+		return
+	}
+
+	if err := revokeTokenFamily(session.Family); err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to revoke session", Data: nil, Status: "error"})
+		return
+	}
+
+	if session.ID == principal.Claims.Session {
+		clearTokenCookies(w)
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "session revoked", Data: nil, Status: "success"})
+}
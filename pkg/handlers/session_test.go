@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// mockDatabase points database.DB at a mock for the rest of the test.
+func mockDatabase(t *testing.T) sqlmock.Sqlmock {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Should be able to open a mock database.", ballotX, err)
+	}
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal("Should be able to open a mock database.", ballotX, err)
+	}
+
+	previous := database.DB
+	database.DB = db
+
+	t.Cleanup(func() {
+		database.DB = previous
+		conn.Close()
+	})
+
+	return mock
+}
+
+func TestRevokeSession(t *testing.T) {
+	const userID = 7
+
+	tests := []struct {
+		name          string
+		session       int64
+		family        string
+		current       uint
+		clearsCookies bool
+	}{
+		{"revoking another session", 1, "family-1", 2, false},
+		{"revoking the current session", 2, "family-2", 2, true},
+	}
+
+	t.Log("Given the need to test ending one session.")
+	{
+		for _, tt := range tests {
+			t.Logf("\tWhen %s.", tt.name)
+			{
+				mock := mockDatabase(t)
+
+				mock.ExpectQuery(`SELECT \* FROM "sessions"`).
+					WithArgs(tt.session, userID, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "family"}).AddRow(tt.session, userID, tt.family))
+				mock.ExpectBegin()
+				mock.ExpectExec(`UPDATE "refresh_tokens" SET "revoked_at"`).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), tt.family).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(`UPDATE "sessions" SET "revoked_at"`).
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), tt.family).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				routeContext := chi.NewRouteContext()
+				routeContext.URLParams.Add("id", strconv.FormatInt(tt.session, 10))
+
+				principal := &middleware.Principal{User: &models.User{Model: gorm.Model{ID: userID}}, Claims: &helpers.Claims{Session: tt.current}}
+
+				r := httptest.NewRequest(http.MethodDelete, "/users/me/sessions/"+strconv.FormatInt(tt.session, 10), nil)
+				r = r.WithContext(context.WithValue(middleware.WithPrincipal(r.Context(), principal), chi.RouteCtxKey, routeContext))
+
+				w := httptest.NewRecorder()
+				RevokeSessionHandler(w, r)
+
+				if w.Code != http.StatusOK {
+					t.Errorf("\t\tShould answer 200, but got %d. %v", w.Code, ballotX)
+				}
+				t.Log("\t\tShould answer 200.", checkMark)
+
+				if err := mock.ExpectationsWereMet(); err != nil {
+					t.Errorf("\t\tShould only revoke the tokens of that session: %v %v", err, ballotX)
+				}
+				t.Log("\t\tShould only revoke the tokens of that session.", checkMark)
+
+				if cleared := len(w.Result().Cookies()) > 0; cleared != tt.clearsCookies {
+					t.Errorf("\t\tShould clear the cookies only when ending the current session, but got %v. %v", cleared, ballotX)
+				}
+				t.Log("\t\tShould clear the cookies only when ending the current session.", checkMark)
+			}
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const REFRESH_TOKEN_COOKIE = "token"
+
+type tokenResponse struct {
+	Token      string        `json:"token"`
+	Expiration time.Duration `json:"expiration"`
+}
+
+// issueTokens hands out a new access/refresh pair for user. An empty family starts a
+// new refresh token family (i.e. a fresh login) and with it a new session, otherwise
+// the refresh token is rotated within the given family. A non-zero organization
+// scopes both tokens to it.
+func issueTokens(w http.ResponseWriter, r *http.Request, user models.User, family string, organization uint) {
+	login := family == ""
+
+	if login {
+		var err error
+
+		family, err = helpers.GenerateRandomString(16)
+
+		if err != nil {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "Unable to generate token", Data: nil, Status: "error"})
+			return
+		}
+	}
+
+	session, newDevice, err := touchSession(r, user, family)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to update session", Data: nil, Status: "error"})
+		return
+	}
+
+	accessToken, _, err := helpers.GenerateToken(user.Username, user.TokenVersion, helpers.ACCESS_TOKEN_EXPIRATION, helpers.WithOrganization(organization), helpers.WithSession(session.ID))
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "Unable to generate token", Data: nil, Status: "error"})
+		return
+	}
+
+	refreshToken, claims, err := helpers.GenerateRefreshToken(user.Username, user.TokenVersion, family, helpers.WithOrganization(organization), helpers.WithSession(session.ID))
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "Unable to generate token", Data: nil, Status: "error"})
+		return
+	}
+
+	result := database.DB.Create(&models.RefreshToken{
+		UserID:    user.ID,
+		TokenID:   claims.ID,
+		Family:    family,
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to update refresh token", Data: nil, Status: "error"})
+		return
+	}
+
+	if login && newDevice {
+		sendNewDeviceEmail(user, *session)
+	}
+
+	accessCookie := http.Cookie{
+		Name:     helpers.ACCESS_TOKEN_COOKIE,
+		Value:    accessToken,
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   int(helpers.ACCESS_TOKEN_EXPIRATION.Seconds()),
+	}
+
+	cookie := http.Cookie{
+		Name:     REFRESH_TOKEN_COOKIE,
+		Value:    refreshToken,
+		Path:     "/users",
+		HttpOnly: true,
+		MaxAge:   int(helpers.REFRESH_TOKEN_EXPIRATION.Seconds()),
+	}
+
+	res := tokenResponse{Token: accessToken, Expiration: time.Duration(helpers.ACCESS_TOKEN_EXPIRATION.Seconds())}
+
+	http.SetCookie(w, &accessCookie)
+	http.SetCookie(w, &cookie)
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: res, Status: "success"})
+}
+
+// revokeTokenFamily revokes every refresh token rotated from the same login, ending
+// its session.
+func revokeTokenFamily(family string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		result := tx.Model(&models.RefreshToken{}).
+			Where("family = ? AND revoked_at IS NULL", family).
+			Update("revoked_at", now)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		result = tx.Model(&models.Session{}).
+			Where("family = ? AND revoked_at IS NULL", family).
+			Update("revoked_at", now)
+
+		return result.Error
+	})
+}
+
+// revokeAllSessions logs user out everywhere: tokens carrying the previous token
+// version are rejected and every session and refresh token family is revoked.
+func revokeAllSessions(db *gorm.DB, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			UpdateColumn("token_version", gorm.Expr("token_version + 1"))
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		now := time.Now()
+
+		result = tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		result = tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now)
+
+		return result.Error
+	})
+}
+
+var errInvalidUserToken = errors.New("invalid or expired token")
+
+// createUserToken issues a single-use token for purpose, replacing any unused token
+// previously issued to the user for the same purpose.
+func createUserToken(userID uint, purpose string, ttl time.Duration) (string, error) {
+	token, err := helpers.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	if err := storeUserToken(userID, purpose, token, ttl); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// storeUserToken saves the hash of token for user, replacing any unused token with
+// the same purpose.
+func storeUserToken(userID uint, purpose, token string, ttl time.Duration) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Delete(&models.UserToken{})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		result = tx.Create(&models.UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: helpers.HashToken(token),
+			ExpiresAt: time.Now().Add(ttl),
+		})
+
+		return result.Error
+	})
+}
+
+// consumeUserToken marks token as used and returns it. It fails if the token is
+// unknown, expired or has been used before.
+func consumeUserToken(db *gorm.DB, token, purpose string) (*models.UserToken, error) {
+	var userToken models.UserToken
+
+	now := time.Now()
+
+	result := db.Model(&userToken).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", helpers.HashToken(token), purpose, now).
+		Update("used_at", now)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, errInvalidUserToken
+	}
+
+	return &userToken, nil
+}
+
+func clearTokenCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: helpers.ACCESS_TOKEN_COOKIE, Value: "", Path: "/", HttpOnly: true, MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{Name: REFRESH_TOKEN_COOKIE, Value: "", Path: "/users", HttpOnly: true, MaxAge: -1})
+}
@@ -6,10 +6,12 @@ import (
 	"time"
 
 	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/denylist"
 	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
 	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/password"
 	"github.com/Adedunmol/zephyr/pkg/schema"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -30,42 +32,107 @@ func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(data.Password), 14)
+	user, err := registerUser(database.DB, data, false)
 
 	if err != nil {
-		helpers.Info.Println("could not hash password", err)
-		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "Unable to hash password", Data: nil, Status: "error"})
+		respondRegistrationError(w, err)
 		return
 	}
 
+	token, err := createUserToken(user.ID, models.EmailVerificationPurpose, EMAIL_VERIFICATION_EXPIRATION)
+
+	if err != nil {
+		helpers.Error.Println(err)
+	} else {
+		sendVerificationEmail(*user, token)
+	}
+
+	helpers.RespondWithJSON(w, http.StatusCreated, helpers.APIResponse{Message: "", Data: user, Status: "success"})
+}
+
+var errHashPassword = errors.New("unable to hash password")
+
+// registerUser creates the user described by data, which has to have been validated
+// already, with the default role. verified marks the email address as confirmed, for
+// when the user has proven they own it some other way.
+func registerUser(tx *gorm.DB, data *schema.CreateUser, verified bool) (*models.User, error) {
+	hashedPassword, err := password.Hash(data.Password)
+
+	if err != nil {
+		helpers.Info.Println("could not hash password", err)
+		return nil, errHashPassword
+	}
+
 	user := models.User{
 		FirstName: data.FirstName,
 		LastName:  data.LastName,
 		Username:  data.Username,
-		Password:  string(hashedPassword),
+		Password:  hashedPassword,
 		Email:     data.Email,
 	}
 
-	result := database.DB.Create(&user)
+	if verified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	assignDefaultRole(tx, &user)
+
+	result := tx.Create(&user)
 
 	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
-			helpers.Error.Println(result.Error)
-			helpers.RespondWithJSON(w, http.StatusConflict, helpers.APIResponse{Message: "Duplicate field sent", Data: nil, Status: "error"})
-			return
-		}
+		return nil, result.Error
 	}
 
-	helpers.RespondWithJSON(w, http.StatusCreated, helpers.APIResponse{Message: "", Data: user, Status: "success"})
+	return &user, nil
 }
 
-func LoginUserHandler(w http.ResponseWriter, r *http.Request) {
-	type Response struct {
-		Token      string        `json:"token"`
-		Expiration time.Duration `json:"expiration"`
+// assignDefaultRole gives a user about to be created the role every user starts with.
+func assignDefaultRole(tx *gorm.DB, user *models.User) {
+	var defaultRole models.Role
+
+	if result := tx.Where(models.Role{Name: models.UserRole}).First(&defaultRole); result.Error != nil {
+		helpers.Warning.Println("default role is missing", result.Error)
+	} else {
+		user.Roles = []models.Role{defaultRole}
 	}
+}
 
-	data, problems, err := helpers.DecodeJSON[*schema.CreateUser](r)
+func respondRegistrationError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errHashPassword) {
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "Unable to hash password", Data: nil, Status: "error"})
+		return
+	}
+
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusConflict, helpers.APIResponse{Message: "Duplicate field sent", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.Error.Println(err)
+	helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to create user", Data: nil, Status: "error"})
+}
+
+// rehashPassword replaces the stored hash of user with one from the current hasher.
+// It is only replaced if it hasn't changed in the meantime, e.g. by a password reset.
+func rehashPassword(user *models.User, plaintext string) error {
+	hashedPassword, err := password.Hash(plaintext)
+
+	if err != nil {
+		return err
+	}
+
+	return database.DB.Model(&models.User{}).
+		Where("id = ? AND password = ?", user.ID, user.Password).
+		UpdateColumn("password", hashedPassword).Error
+}
+
+// LoginUserHandler checks an email and password with Authenticators. Every failure,
+// whether the account exists or not, gets the same response after the same amount of
+// work, and counts towards locking out both the account and the client address.
+func LoginUserHandler(w http.ResponseWriter, r *http.Request) {
+	data, problems, err := helpers.DecodeJSON[*schema.LoginUser](r)
 
 	if err != nil {
 
@@ -81,47 +148,105 @@ func LoginUserHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	ip := clientIP(r)
+
+	if locked, retryAfter := ipFailures.locked(ip); locked {
+		respondLockedOut(w, retryAfter)
+		return
+	}
+
+	// the account is looked up ahead of the authenticators, so that locked accounts
+	// are turned away before their password is checked.
 	var foundUser models.User
 
 	result := database.DB.Where(models.User{Email: data.Email}).First(&foundUser)
 
-	if result.Error != nil {
-		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "user does not exist", Data: nil, Status: "error"})
+	known := result.Error == nil
+
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to log in", Data: nil, Status: "error"})
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(foundUser.Password), []byte(data.Password))
+	email := normalizeEmail(data.Email)
+
+	if !known {
+		if locked, retryAfter := unknownFailures.locked(email); locked {
+			respondLockedOut(w, retryAfter)
+			return
+		}
+	} else if locked, retryAfter := accountLocked(&foundUser); locked {
+		respondLockedOut(w, retryAfter)
+		return
+	}
+
+	user, err := authenticate(r.Context(), Authenticators, data.Email, data.Password)
+
+	switch {
+	case errors.Is(err, ErrInvalidCredentials):
+		if known {
+			if err := recordAccountFailure(&foundUser); err != nil {
+				helpers.Error.Println(err)
+			}
+		} else {
+			unknownFailures.fail(email, loginMaxAttempts())
+		}
+
+		ipFailures.fail(ip, loginIPMaxAttempts())
 
-	if err != nil {
 		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "Invalid credentials", Data: nil, Status: "error"})
 		return
+	case errors.Is(err, errAccountEmailUnverified):
+		helpers.RespondWithJSON(w, http.StatusConflict, helpers.APIResponse{Message: "an account with this email exists, verify it before signing in with the directory", Data: nil, Status: "error"})
+		return
+	case err != nil:
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to log in", Data: nil, Status: "error"})
+		return
+	}
+
+	if err := resetAccountFailures(user); err != nil {
+		helpers.Error.Println(err)
+	}
+
+	if helpers.EnvConfig.RequireVerifiedEmail && user.EmailVerifiedAt == nil {
+		helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "email address has not been verified", Data: nil, Status: "error"})
+		return
 	}
 
-	accessToken, err := helpers.GenerateToken(foundUser.Username, helpers.ACCESS_TOKEN_EXPIRATION)
+	completeLogin(w, r, *user, 0)
+}
+
+func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(REFRESH_TOKEN_COOKIE)
 
 	if err != nil {
-		helpers.Error.Println(err)
-		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "Unable to generate token", Data: nil, Status: "error"})
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "refresh token required", Data: nil, Status: "error"})
 		return
 	}
 
-	refreshToken, err := helpers.GenerateToken(foundUser.Username, helpers.REFRESH_TOKEN_EXPIRATION)
+	claims, err := helpers.ParseToken(cookie.Value, helpers.RefreshTokenType)
 
 	if err != nil {
-		helpers.Error.Println(err)
-		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "Unable to generate token", Data: nil, Status: "error"})
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "Invalid refresh token", Data: nil, Status: "error"})
 		return
 	}
 
-	cookie := http.Cookie{
-		Name:  "token",
-		Value: refreshToken,
-		// Expires:  time.Now().Add(util.REFRESH_TOKEN_EXPIRATION),
-		HttpOnly: true,
-		MaxAge:   1 * 60 * 60,
+	var storedToken models.RefreshToken
+
+	result := database.DB.Where(models.RefreshToken{TokenID: claims.ID}).First(&storedToken)
+
+	if result.Error != nil || storedToken.Family != claims.Family || storedToken.RevokedAt != nil {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "Invalid refresh token", Data: nil, Status: "error"})
+		return
 	}
 
-	result = database.DB.Model(&foundUser).UpdateColumn("RefreshToken", refreshToken)
+	// marking the token as used only succeeds once, so a second request presenting the
+	// same token (a replay, or a concurrent refresh) is treated as reuse.
+	result = database.DB.Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", storedToken.ID).
+		Update("used_at", time.Now())
 
 	if result.Error != nil {
 		helpers.Error.Println(result.Error)
@@ -129,8 +254,101 @@ func LoginUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res := Response{Token: accessToken, Expiration: time.Duration(helpers.ACCESS_TOKEN_EXPIRATION.Seconds())}
+	if result.RowsAffected == 0 {
+		helpers.Warning.Printf("refresh token reuse detected for user %d, revoking token family", storedToken.UserID)
+
+		if err := revokeTokenFamily(storedToken.Family); err != nil {
+			helpers.Error.Println(err)
+		}
+
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "Invalid refresh token", Data: nil, Status: "error"})
+		return
+	}
+
+	var foundUser models.User
+
+	result = database.DB.First(&foundUser, storedToken.UserID)
+
+	if result.Error != nil {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "user does not exist", Data: nil, Status: "error"})
+		return
+	}
+
+	if claims.Version != foundUser.TokenVersion {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "Invalid refresh token", Data: nil, Status: "error"})
+		return
+	}
+
+	organization := claims.Organization
+
+	// the user may have been removed from the organization since the last refresh.
+	if organization != 0 {
+		if _, err := findMembership(organization, foundUser.ID); err != nil {
+			organization = 0
+		}
+	}
+
+	issueTokens(w, r, foundUser, storedToken.Family, organization)
+}
+
+func LogoutUserHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	err := denylist.Default.Revoke(r.Context(), principal.Claims.ID, principal.Claims.ExpiresAt.Time)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to revoke token", Data: nil, Status: "error"})
+		return
+	}
+
+	// the refresh token is optional here, the access token alone is enough to end the session.
+	if cookie, err := r.Cookie(REFRESH_TOKEN_COOKIE); err == nil {
+		claims, err := helpers.ParseToken(cookie.Value, helpers.RefreshTokenType)
+
+		if err == nil && claims.Username == principal.User.Username {
+			if err := revokeTokenFamily(claims.Family); err != nil {
+				helpers.Error.Println(err)
+				helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to revoke token", Data: nil, Status: "error"})
+				return
+			}
+		}
+	}
+
+	clearTokenCookies(w)
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "logged out", Data: nil, Status: "success"})
+}
+
+func LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	if err := revokeAllSessions(database.DB, principal.User.ID); err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to revoke tokens", Data: nil, Status: "error"})
+		return
+	}
+
+	clearTokenCookies(w)
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "logged out of all devices", Data: nil, Status: "success"})
+}
+
+func GetCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
 
-	http.SetCookie(w, &cookie)
-	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: res, Status: "success"})
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: principal.User, Status: "success"})
 }
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/schema"
+	"gorm.io/gorm"
+)
+
+const EMAIL_VERIFICATION_EXPIRATION = 24 * time.Hour
+const VERIFICATION_RESEND_INTERVAL = 1 * time.Minute
+
+// resendLimiter remembers when a verification email was last requested for an
+// address. It is keyed by the requested address rather than the account so that
+// being throttled doesn't reveal whether the address is registered.
+var resendLimiter = struct {
+	sync.Mutex
+	last map[string]time.Time
+}{last: make(map[string]time.Time)}
+
+func allowResend(email string) (bool, time.Duration) {
+	resendLimiter.Lock()
+	defer resendLimiter.Unlock()
+
+	now := time.Now()
+
+	for address, last := range resendLimiter.last {
+		if now.Sub(last) >= VERIFICATION_RESEND_INTERVAL {
+			delete(resendLimiter.last, address)
+		}
+	}
+
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	if last, ok := resendLimiter.last[email]; ok {
+		return false, VERIFICATION_RESEND_INTERVAL - now.Sub(last)
+	}
+
+	resendLimiter.last[email] = now
+
+	return true, 0
+}
+
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	if token == "" {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "token is required", Data: nil, Status: "error"})
+		return
+	}
+
+	userToken, err := consumeUserToken(database.DB, token, models.EmailVerificationPurpose)
+
+	if err != nil {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid or expired token", Data: nil, Status: "error"})
+		return
+	}
+
+	result := database.DB.Model(&models.User{}).
+		Where("id = ? AND email_verified_at IS NULL", userToken.UserID).
+		Update("email_verified_at", time.Now())
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to verify email", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "email address verified", Data: nil, Status: "success"})
+}
+
+// sendVerification mails a verification link to the account with email, if there is
+// one and it isn't verified yet. It runs in the background, so that the time taken
+// doesn't give the account away.
+func sendVerification(email string) {
+	var foundUser models.User
+
+	result := database.DB.Where(models.User{Email: email}).First(&foundUser)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return
+	}
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		return
+	}
+
+	if foundUser.EmailVerifiedAt != nil {
+		return
+	}
+
+	token, err := createUserToken(foundUser.ID, models.EmailVerificationPurpose, EMAIL_VERIFICATION_EXPIRATION)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		return
+	}
+
+	sendVerificationEmail(foundUser, token)
+}
+
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	data, problems, err := helpers.DecodeJSON[*schema.ResendVerification](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	if ok, retryAfter := allowResend(data.Email); !ok {
+		w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(retryAfter.Seconds()))))
+		helpers.RespondWithJSON(w, http.StatusTooManyRequests, helpers.APIResponse{Message: "too many requests, try again later", Data: nil, Status: "error"})
+		return
+	}
+
+	// the response is the same, and as quick, whether or not the email belongs to an
+	// unverified account, so this endpoint can't be used to find out who is registered.
+	go sendVerification(data.Email)
+
+	helpers.RespondWithJSON(w, http.StatusAccepted, helpers.APIResponse{Message: "if the email belongs to an unverified account, a verification link has been sent", Data: nil, Status: "success"})
+}
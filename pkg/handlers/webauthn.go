@@ -0,0 +1,574 @@
+package handlers
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/denylist"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/schema"
+	"github.com/Adedunmol/zephyr/pkg/webauthn"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const WEBAUTHN_SESSION_EXPIRATION = 5 * time.Minute
+
+var errInvalidWebAuthnSession = errors.New("invalid or expired webauthn session")
+
+type webAuthnCeremonyResponse struct {
+	SessionID string      `json:"session_id"`
+	PublicKey interface{} `json:"public_key"`
+}
+
+// webAuthnCredentialResponse is a newly registered credential, with the recovery codes
+// issued when it is the user's first second factor.
+type webAuthnCredentialResponse struct {
+	models.Credential
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// relyingParty describes this server to authenticators. The RP ID and origins
+// default to the host and origin of APP_URL.
+func relyingParty() *webauthn.Config {
+	rpID := helpers.EnvConfig.WebAuthnRPID
+	origins := helpers.EnvConfig.WebAuthnOrigins
+
+	if rpID == "" {
+		if appURL, err := url.Parse(helpers.EnvConfig.AppURL); err == nil {
+			rpID = appURL.Hostname()
+		}
+	}
+
+	if origins == "" {
+		origins = strings.TrimRight(helpers.EnvConfig.AppURL, "/")
+	}
+
+	name := helpers.EnvConfig.AppName
+	if name == "" {
+		name = "Zephyr"
+	}
+
+	config := &webauthn.Config{RPID: rpID, RPName: name, Timeout: WEBAUTHN_SESSION_EXPIRATION}
+
+	for _, origin := range strings.Split(origins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			config.Origins = append(config.Origins, origin)
+		}
+	}
+
+	return config
+}
+
+// userHandle is the opaque user ID given to authenticators. It must not contain
+// personal information, so the database ID is used.
+func userHandle(userID uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+
+	return handle
+}
+
+func hasWebAuthnCredentials(userID uint) (bool, error) {
+	var count int64
+
+	result := database.DB.Model(&models.Credential{}).Where("user_id = ?", userID).Count(&count)
+
+	return count > 0, result.Error
+}
+
+func webAuthnCredentialIDs(userID uint) ([][]byte, error) {
+	var ids [][]byte
+
+	result := database.DB.Model(&models.Credential{}).Where("user_id = ?", userID).Pluck("credential_id", &ids)
+
+	return ids, result.Error
+}
+
+// createWebAuthnSession stores a fresh challenge for a ceremony and returns the
+// session ID the browser has to send back with its response.
+func createWebAuthnSession(userID *uint, purpose string) (string, []byte, error) {
+	now := time.Now()
+
+	result := database.DB.Unscoped().Where("expires_at <= ?", now).Delete(&models.WebAuthnSession{})
+
+	if result.Error != nil {
+		return "", nil, result.Error
+	}
+
+	sessionID, err := helpers.GenerateRandomString(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", nil, err
+	}
+
+	session := models.WebAuthnSession{SessionID: sessionID, UserID: userID, Purpose: purpose, Challenge: challenge, ExpiresAt: now.Add(WEBAUTHN_SESSION_EXPIRATION)}
+
+	result = database.DB.Create(&session)
+
+	if result.Error != nil {
+		return "", nil, result.Error
+	}
+
+	return sessionID, challenge, nil
+}
+
+// consumeWebAuthnSession marks the session as used and returns it, so that every
+// challenge can only be answered once.
+func consumeWebAuthnSession(sessionID, purpose string) (*models.WebAuthnSession, error) {
+	var session models.WebAuthnSession
+
+	now := time.Now()
+
+	result := database.DB.Model(&session).
+		Clauses(clause.Returning{}).
+		Where("session_id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", sessionID, purpose, now).
+		Update("used_at", now)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, errInvalidWebAuthnSession
+	}
+
+	return &session, nil
+}
+
+// verifyWebAuthnAssertion checks an assertion against the stored credential and
+// records the new signature counter. userID restricts the credential to a user
+// when the user is already known.
+func verifyWebAuthnAssertion(resp *webauthn.AssertionResponse, challenge []byte, userID *uint, requireUserVerification bool) (*models.Credential, error) {
+	var credential models.Credential
+
+	query := database.DB.Where("credential_id = ?", []byte(resp.RawID))
+
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+
+	result := query.First(&credential)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	// discoverable credentials tell us who they belong to.
+	if len(resp.Response.UserHandle) != 0 && string(resp.Response.UserHandle) != string(userHandle(credential.UserID)) {
+		return nil, webauthn.ErrInvalidResponse
+	}
+
+	signCount, err := relyingParty().VerifyAssertion(resp, challenge, credential.PublicKey, credential.SignCount, requireUserVerification)
+
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCount) {
+			helpers.Warning.Printf("signature counter of credential %d went backwards, it may have been cloned", credential.ID)
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+
+	// the counter check guards against the same assertion being counted twice.
+	result = database.DB.Model(&models.Credential{}).
+		Where("id = ? AND sign_count = ?", credential.ID, credential.SignCount).
+		Updates(map[string]interface{}{"sign_count": signCount, "last_used_at": now})
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, webauthn.ErrSignCount
+	}
+
+	credential.SignCount = signCount
+	credential.LastUsedAt = &now
+
+	return &credential, nil
+}
+
+func BeginWebAuthnRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	user := principal.User
+
+	existing, err := webAuthnCredentialIDs(user.ID)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load credentials", Data: nil, Status: "error"})
+		return
+	}
+
+	sessionID, challenge, err := createWebAuthnSession(&user.ID, models.WebAuthnRegistrationPurpose)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to start registration", Data: nil, Status: "error"})
+		return
+	}
+
+	entity := webauthn.UserEntity{
+		ID:          userHandle(user.ID),
+		Name:        user.Email,
+		DisplayName: strings.TrimSpace(user.FirstName + " " + user.LastName),
+	}
+
+	res := webAuthnCeremonyResponse{SessionID: sessionID, PublicKey: relyingParty().CreationOptions(challenge, entity, existing)}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: res, Status: "success"})
+}
+
+func FinishWebAuthnRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	data, problems, err := helpers.DecodeJSON[*schema.WebAuthnRegistration](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	user := principal.User
+
+	session, err := consumeWebAuthnSession(data.SessionID, models.WebAuthnRegistrationPurpose)
+
+	if err != nil || session.UserID == nil || *session.UserID != user.ID {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid or expired session", Data: nil, Status: "error"})
+		return
+	}
+
+	verified, err := relyingParty().VerifyRegistration(data.Credential, session.Challenge, false)
+
+	if err != nil {
+		helpers.Info.Println(err)
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid credential", Data: nil, Status: "error"})
+		return
+	}
+
+	name := data.Name
+	if name == "" {
+		name = "Passkey"
+	}
+
+	credential := models.Credential{UserID: user.ID, CredentialID: verified.ID, PublicKey: verified.PublicKey, SignCount: verified.SignCount, Name: name}
+
+	var codes []string
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+
+		if result := tx.Model(&models.Credential{}).Where("user_id = ?", user.ID).Count(&count); result.Error != nil {
+			return result.Error
+		}
+
+		if result := tx.Create(&credential); result.Error != nil {
+			return result.Error
+		}
+
+		// the first credential makes webauthn a second factor, so users without TOTP
+		// get the recovery codes they would otherwise lack.
+		if count > 0 || user.MFAEnabled() {
+			return nil
+		}
+
+		codes, err = generateRecoveryCodes(tx, user.ID)
+
+		return err
+	})
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			helpers.RespondWithJSON(w, http.StatusConflict, helpers.APIResponse{Message: "credential already registered", Data: nil, Status: "error"})
+			return
+		}
+
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to save credential", Data: nil, Status: "error"})
+		return
+	}
+
+	res := webAuthnCredentialResponse{Credential: credential, RecoveryCodes: codes}
+
+	helpers.RespondWithJSON(w, http.StatusCreated, helpers.APIResponse{Message: "credential registered", Data: res, Status: "success"})
+}
+
+func ListWebAuthnCredentialsHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	credentials := []models.Credential{}
+
+	result := database.DB.Where("user_id = ?", principal.User.ID).Order("created_at").Find(&credentials)
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load credentials", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: credentials, Status: "success"})
+}
+
+func DeleteWebAuthnCredentialHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "authentication required", Data: nil, Status: "error"})
+		return
+	}
+
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+
+	if err != nil {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "credential not found", Data: nil, Status: "error"})
+		return
+	}
+
+	user := principal.User
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("id = ? AND user_id = ?", id, user.ID).Delete(&models.Credential{})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		var count int64
+
+		if result := tx.Model(&models.Credential{}).Where("user_id = ?", user.ID).Count(&count); result.Error != nil {
+			return result.Error
+		}
+
+		// recovery codes outlive the last second factor only when TOTP is on.
+		if count > 0 || user.MFAEnabled() {
+			return nil
+		}
+
+		return tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		helpers.RespondWithJSON(w, http.StatusNotFound, helpers.APIResponse{Message: "credential not found", Data: nil, Status: "error"})
+		return
+	}
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to delete credential", Data: nil, Status: "error"})
+		return
+	}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "credential deleted", Data: nil, Status: "success"})
+}
+
+// BeginWebAuthnLoginHandler starts a passwordless login. No user is named: the
+// browser offers the passkeys it has for this relying party.
+func BeginWebAuthnLoginHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID, challenge, err := createWebAuthnSession(nil, models.WebAuthnLoginPurpose)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to start login", Data: nil, Status: "error"})
+		return
+	}
+
+	res := webAuthnCeremonyResponse{SessionID: sessionID, PublicKey: relyingParty().RequestOptions(challenge, nil, "required")}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: res, Status: "success"})
+}
+
+// FinishWebAuthnLoginHandler completes a passwordless login. The passkey is
+// something the user has and user verification is something they know or are, so
+// no further factor is asked for.
+func FinishWebAuthnLoginHandler(w http.ResponseWriter, r *http.Request) {
+	data, problems, err := helpers.DecodeJSON[*schema.WebAuthnLogin](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	session, err := consumeWebAuthnSession(data.SessionID, models.WebAuthnLoginPurpose)
+
+	if err != nil {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid or expired session", Data: nil, Status: "error"})
+		return
+	}
+
+	credential, err := verifyWebAuthnAssertion(data.Credential, session.Challenge, nil, true)
+
+	if err != nil {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "Invalid credential", Data: nil, Status: "error"})
+		return
+	}
+
+	var foundUser models.User
+
+	result := database.DB.First(&foundUser, credential.UserID)
+
+	if result.Error != nil {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "Invalid credential", Data: nil, Status: "error"})
+		return
+	}
+
+	if helpers.EnvConfig.RequireVerifiedEmail && foundUser.EmailVerifiedAt == nil {
+		helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "email address has not been verified", Data: nil, Status: "error"})
+		return
+	}
+
+	issueTokens(w, r, foundUser, "", 0)
+}
+
+// BeginWebAuthnMFAHandler starts using a registered credential as the second factor
+// of a password login.
+func BeginWebAuthnMFAHandler(w http.ResponseWriter, r *http.Request) {
+	data, problems, err := helpers.DecodeJSON[*schema.MFAToken](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	_, foundUser, ok := userFromMFAToken(r.Context(), data.MFAToken)
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "Invalid MFA token", Data: nil, Status: "error"})
+		return
+	}
+
+	allowed, err := webAuthnCredentialIDs(foundUser.ID)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load credentials", Data: nil, Status: "error"})
+		return
+	}
+
+	if len(allowed) == 0 {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "no security keys registered", Data: nil, Status: "error"})
+		return
+	}
+
+	sessionID, challenge, err := createWebAuthnSession(&foundUser.ID, models.WebAuthnMFAPurpose)
+
+	if err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to start verification", Data: nil, Status: "error"})
+		return
+	}
+
+	res := webAuthnCeremonyResponse{SessionID: sessionID, PublicKey: relyingParty().RequestOptions(challenge, allowed, "discouraged")}
+
+	helpers.RespondWithJSON(w, http.StatusOK, helpers.APIResponse{Message: "", Data: res, Status: "success"})
+}
+
+func FinishWebAuthnMFAHandler(w http.ResponseWriter, r *http.Request) {
+	data, problems, err := helpers.DecodeJSON[*schema.WebAuthnMFA](r)
+
+	if err != nil {
+
+		if err == helpers.ErrValidation {
+			helpers.RespondWithJSON(w, http.StatusUnprocessableEntity, helpers.APIResponse{Status: "error", Message: "error processing data", Data: problems})
+			return
+		}
+
+		if err == helpers.ErrDecode {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Status: "error", Message: "request body needed", Data: nil})
+			return
+		}
+	}
+
+	claims, foundUser, ok := userFromMFAToken(r.Context(), data.MFAToken)
+
+	if !ok {
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "Invalid MFA token", Data: nil, Status: "error"})
+		return
+	}
+
+	session, err := consumeWebAuthnSession(data.SessionID, models.WebAuthnMFAPurpose)
+
+	if err != nil || session.UserID == nil || *session.UserID != foundUser.ID {
+		helpers.RespondWithJSON(w, http.StatusBadRequest, helpers.APIResponse{Message: "Invalid or expired session", Data: nil, Status: "error"})
+		return
+	}
+
+	if _, err := verifyWebAuthnAssertion(data.Credential, session.Challenge, &foundUser.ID, false); err != nil {
+		if recordMFAFailure(claims) >= MAX_MFA_ATTEMPTS {
+			denylist.Default.Revoke(r.Context(), claims.ID, claims.ExpiresAt.Time)
+		}
+
+		helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: "Invalid credential", Data: nil, Status: "error"})
+		return
+	}
+
+	// the MFA token is single use.
+	if err := denylist.Default.Revoke(r.Context(), claims.ID, claims.ExpiresAt.Time); err != nil {
+		helpers.Error.Println(err)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to revoke token", Data: nil, Status: "error"})
+		return
+	}
+
+	issueTokens(w, r, *foundUser, "", claims.Organization)
+}
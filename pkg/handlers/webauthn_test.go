@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/webauthn"
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/gorm"
+)
+
+// newRegistration returns what a passkey for rpID answers to challenge, with "none"
+// attestation. The CBOR is written out by hand, its layout being fixed.
+func newRegistration(t *testing.T, rpID, origin string, challenge []byte) *webauthn.RegistrationResponse {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Should be able to generate a credential key.", ballotX, err)
+	}
+
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+
+	// {1: 2, 3: -7, -1: 1, -2: x, -3: y}, an ES256 key.
+	var publicKey bytes.Buffer
+	publicKey.Write([]byte{0xa5, 0x01, 0x02, 0x03, 0x26, 0x20, 0x01, 0x21, 0x58, 0x20})
+	publicKey.Write(key.X.FillBytes(make([]byte, 32)))
+	publicKey.Write([]byte{0x22, 0x58, 0x20})
+	publicKey.Write(key.Y.FillBytes(make([]byte, 32)))
+
+	rpIDHash := sha256.Sum256([]byte(rpID))
+
+	var authData bytes.Buffer
+	authData.Write(rpIDHash[:])
+	authData.WriteByte(0x45) // user present and verified, attested credential data
+	binary.Write(&authData, binary.BigEndian, uint32(0))
+	authData.Write(make([]byte, 16))
+	binary.Write(&authData, binary.BigEndian, uint16(len(credentialID)))
+	authData.Write(credentialID)
+	authData.Write(publicKey.Bytes())
+
+	// {"attStmt": {}, "authData": authData, "fmt": "none"}
+	var attestation bytes.Buffer
+	attestation.Write([]byte{0xa3, 0x67})
+	attestation.WriteString("attStmt")
+	attestation.Write([]byte{0xa0, 0x68})
+	attestation.WriteString("authData")
+	attestation.WriteByte(0x59)
+	binary.Write(&attestation, binary.BigEndian, uint16(authData.Len()))
+	attestation.Write(authData.Bytes())
+	attestation.WriteByte(0x63)
+	attestation.WriteString("fmt")
+	attestation.WriteByte(0x64)
+	attestation.WriteString("none")
+
+	clientData, _ := json.Marshal(map[string]string{
+		"type":      "webauthn.create",
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    origin,
+	})
+
+	resp := &webauthn.RegistrationResponse{ID: base64.RawURLEncoding.EncodeToString(credentialID), RawID: credentialID, Type: "public-key"}
+	resp.Response.ClientDataJSON = clientData
+	resp.Response.AttestationObject = attestation.Bytes()
+
+	return resp
+}
+
+func TestFinishWebAuthnRegistration(t *testing.T) {
+	defer func(appURL string) { helpers.EnvConfig.AppURL = appURL }(helpers.EnvConfig.AppURL)
+	helpers.EnvConfig.AppURL = "https://zephyr.example.com"
+
+	const userID = 7
+
+	enabledAt := time.Now()
+
+	tests := []struct {
+		name        string
+		user        *models.User
+		credentials int
+		issuesCodes bool
+	}{
+		{"registering the first credential", &models.User{Model: gorm.Model{ID: userID}}, 0, true},
+		{"registering another credential", &models.User{Model: gorm.Model{ID: userID}}, 1, false},
+		{"registering the first credential with TOTP on", &models.User{Model: gorm.Model{ID: userID}, TOTPEnabledAt: &enabledAt}, 0, false},
+	}
+
+	t.Log("Given the need to test issuing recovery codes along with passkeys.")
+	{
+		for _, tt := range tests {
+			t.Logf("\tWhen %s.", tt.name)
+			{
+				mock := mockDatabase(t)
+
+				challenge := []byte("registration-challenge")
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(`UPDATE "web_authn_sessions" SET`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "session_id", "user_id", "purpose", "challenge"}).
+						AddRow(1, "session", userID, models.WebAuthnRegistrationPurpose, challenge))
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectQuery(`SELECT count\(\*\) FROM "credentials"`).
+					WithArgs(userID).
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.credentials))
+				mock.ExpectQuery(`INSERT INTO "credentials"`).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+
+				if tt.issuesCodes {
+					ids := sqlmock.NewRows([]string{"id"})
+
+					for i := 0; i < RECOVERY_CODE_COUNT; i++ {
+						ids.AddRow(i + 1)
+					}
+
+					mock.ExpectExec(`DELETE FROM "recovery_codes"`).
+						WithArgs(userID).
+						WillReturnResult(sqlmock.NewResult(0, 0))
+					mock.ExpectQuery(`INSERT INTO "recovery_codes"`).
+						WillReturnRows(ids)
+				}
+
+				mock.ExpectCommit()
+
+				body, _ := json.Marshal(map[string]interface{}{
+					"session_id": "session",
+					"credential": newRegistration(t, "zephyr.example.com", "https://zephyr.example.com", challenge),
+				})
+
+				r := httptest.NewRequest(http.MethodPost, "/users/webauthn/register/finish", bytes.NewReader(body))
+				r = r.WithContext(middleware.WithPrincipal(r.Context(), &middleware.Principal{User: tt.user, Claims: &helpers.Claims{}}))
+
+				w := httptest.NewRecorder()
+				FinishWebAuthnRegistrationHandler(w, r)
+
+				if w.Code != http.StatusCreated {
+					t.Fatalf("\t\tShould answer 201, but got %d %s. %v", w.Code, w.Body, ballotX)
+				}
+				t.Log("\t\tShould answer 201.", checkMark)
+
+				var payload struct {
+					Data struct {
+						RecoveryCodes []string `json:"recovery_codes"`
+					} `json:"data"`
+				}
+
+				json.NewDecoder(w.Body).Decode(&payload)
+
+				if issued := len(payload.Data.RecoveryCodes) == RECOVERY_CODE_COUNT; issued != tt.issuesCodes {
+					t.Errorf("\t\tShould issue recovery codes: %v, but got %v. %v", tt.issuesCodes, payload.Data.RecoveryCodes, ballotX)
+				}
+				t.Logf("\t\tShould issue recovery codes: %v. %v", tt.issuesCodes, checkMark)
+
+				if err := mock.ExpectationsWereMet(); err != nil {
+					t.Errorf("\t\tShould save the credential: %v %v", err, ballotX)
+				}
+				t.Log("\t\tShould save the credential.", checkMark)
+			}
+		}
+	}
+}
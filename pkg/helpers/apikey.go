@@ -0,0 +1,50 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// API keys look like zk_<prefix>_<secret>. The prefix is stored as is to find the key,
+// the secret only as a hash.
+const API_KEY_PREFIX = "zk_"
+
+const API_KEY_LOOKUP_LENGTH = 6
+const API_KEY_SECRET_LENGTH = 32
+
+// GenerateAPIKey returns a new API key and its lookup prefix.
+func GenerateAPIKey() (key, prefix string, err error) {
+	b := make([]byte, API_KEY_LOOKUP_LENGTH)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	// hex keeps the prefix free of the underscore separating it from the secret.
+	prefix = hex.EncodeToString(b)
+
+	secret, err := GenerateRandomString(API_KEY_SECRET_LENGTH)
+	if err != nil {
+		return "", "", err
+	}
+
+	return API_KEY_PREFIX + prefix + "_" + secret, prefix, nil
+}
+
+// ParseAPIKey splits an API key into its lookup prefix and secret.
+func ParseAPIKey(key string) (prefix, secret string, ok bool) {
+	rest, found := strings.CutPrefix(key, API_KEY_PREFIX)
+
+	if !found {
+		return "", "", false
+	}
+
+	prefix, secret, found = strings.Cut(rest, "_")
+
+	if !found || len(prefix) != 2*API_KEY_LOOKUP_LENGTH || secret == "" {
+		return "", "", false
+	}
+
+	return prefix, secret, true
+}
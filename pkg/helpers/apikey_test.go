@@ -0,0 +1,47 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAPIKey(t *testing.T) {
+	t.Log("Given the need to test API keys.")
+	{
+		t.Log("\tWhen generating a key.")
+		{
+			key, prefix, err := GenerateAPIKey()
+			if err != nil {
+				t.Fatal("\t\tShould be able to generate a key.", ballotX, err)
+			}
+			t.Log("\t\tShould be able to generate a key.", checkMark)
+
+			if !strings.HasPrefix(key, API_KEY_PREFIX+prefix+"_") {
+				t.Errorf("\t\tShould start with the lookup prefix, but got %q. %v", key, ballotX)
+			}
+			t.Log("\t\tShould start with the lookup prefix.", checkMark)
+
+			parsedPrefix, secret, ok := ParseAPIKey(key)
+
+			if !ok || parsedPrefix != prefix || secret == "" {
+				t.Errorf("\t\tShould parse back into its prefix and secret, but got %q and %q. %v", parsedPrefix, secret, ballotX)
+			}
+			t.Log("\t\tShould parse back into its prefix and secret.", checkMark)
+
+			if other, _, _ := GenerateAPIKey(); other == key {
+				t.Error("\t\tShould not generate the same key twice.", ballotX)
+			}
+			t.Log("\t\tShould not generate the same key twice.", checkMark)
+		}
+
+		t.Log("\tWhen parsing malformed keys.")
+		{
+			for _, key := range []string{"", "not-a-key", "zk_", "zk_0123456789ab", "zk_0123456789ab_", "zk_short_secret", "pk_0123456789ab_secret"} {
+				if _, _, ok := ParseAPIKey(key); ok {
+					t.Errorf("\t\tShould reject %q. %v", key, ballotX)
+				}
+			}
+			t.Log("\t\tShould reject them.", checkMark)
+		}
+	}
+}
@@ -1,16 +1,62 @@
 package helpers
 
 import (
+	"time"
+
 	"github.com/spf13/viper"
 )
 
 var EnvConfig Config
 
 type Config struct {
-	DatabaseUrl     string `mapstructure:"DATABASE_URL"`
-	TestDatabaseUrl string `mapstructure:"TEST_DATABASE_URL"`
-	Environment     string `mapstructure:"ENVIRONMENT"`
-	SecretKey       string `mapstructure:"SECRET_KEY"`
+	DatabaseUrl           string        `mapstructure:"DATABASE_URL"`
+	TestDatabaseUrl       string        `mapstructure:"TEST_DATABASE_URL"`
+	Environment           string        `mapstructure:"ENVIRONMENT"`
+	SecretKey             string        `mapstructure:"SECRET_KEY"`
+	AppURL                string        `mapstructure:"APP_URL"`
+	AppName               string        `mapstructure:"APP_NAME"`
+	DenylistStore         string        `mapstructure:"DENYLIST_STORE"`
+	RequireVerifiedEmail  bool          `mapstructure:"REQUIRE_VERIFIED_EMAIL"`
+	SigningKeys           string        `mapstructure:"JWT_SIGNING_KEYS"`
+	ActiveKeyID           string        `mapstructure:"JWT_ACTIVE_KEY_ID"`
+	RetiredKeys           string        `mapstructure:"JWT_RETIRED_KEYS"`
+	MailTransport         string        `mapstructure:"MAIL_TRANSPORT"`
+	MailFrom              string        `mapstructure:"MAIL_FROM"`
+	MailDir               string        `mapstructure:"MAIL_DIR"`
+	SMTPHost              string        `mapstructure:"SMTP_HOST"`
+	SMTPPort              int           `mapstructure:"SMTP_PORT"`
+	SMTPUsername          string        `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword          string        `mapstructure:"SMTP_PASSWORD"`
+	WebAuthnRPID          string        `mapstructure:"WEBAUTHN_RP_ID"`
+	WebAuthnOrigins       string        `mapstructure:"WEBAUTHN_ORIGINS"`
+	AdminEmail            string        `mapstructure:"ADMIN_EMAIL"`
+	LoginMaxAttempts      int           `mapstructure:"LOGIN_MAX_ATTEMPTS"`
+	LoginIPMaxAttempts    int           `mapstructure:"LOGIN_IP_MAX_ATTEMPTS"`
+	LoginLockout          time.Duration `mapstructure:"LOGIN_LOCKOUT"`
+	RateLimitStore        string        `mapstructure:"RATE_LIMIT_STORE"`
+	PasswordHasher        string        `mapstructure:"PASSWORD_HASHER"`
+	Argon2Memory          uint32        `mapstructure:"ARGON2_MEMORY"`
+	Argon2Iterations      uint32        `mapstructure:"ARGON2_ITERATIONS"`
+	Argon2Parallelism     uint8         `mapstructure:"ARGON2_PARALLELISM"`
+	BcryptCost            int           `mapstructure:"BCRYPT_COST"`
+	PasswordMinLength     int           `mapstructure:"PASSWORD_MIN_LENGTH"`
+	PasswordMinScore      int           `mapstructure:"PASSWORD_MIN_SCORE"`
+	PasswordBreachedList  string        `mapstructure:"PASSWORD_BREACHED_LIST"`
+	GitHubClientID        string        `mapstructure:"GITHUB_CLIENT_ID"`
+	GitHubClientSecret    string        `mapstructure:"GITHUB_CLIENT_SECRET"`
+	GoogleClientID        string        `mapstructure:"GOOGLE_CLIENT_ID"`
+	GoogleClientSecret    string        `mapstructure:"GOOGLE_CLIENT_SECRET"`
+	LDAPURL               string        `mapstructure:"LDAP_URL"`
+	LDAPStartTLS          bool          `mapstructure:"LDAP_START_TLS"`
+	LDAPBindDN            string        `mapstructure:"LDAP_BIND_DN"`
+	LDAPBindPassword      string        `mapstructure:"LDAP_BIND_PASSWORD"`
+	LDAPBaseDN            string        `mapstructure:"LDAP_BASE_DN"`
+	LDAPUserFilter        string        `mapstructure:"LDAP_USER_FILTER"`
+	LDAPUsernameAttribute string        `mapstructure:"LDAP_USERNAME_ATTRIBUTE"`
+	LDAPIDAttribute       string        `mapstructure:"LDAP_ID_ATTRIBUTE"`
+	LDAPGroupRoles        string        `mapstructure:"LDAP_GROUP_ROLES"`
+	SAMLCertificate       string        `mapstructure:"SAML_CERTIFICATE"`
+	SAMLKey               string        `mapstructure:"SAML_KEY"`
 }
 
 func LoadConfig(path string) error {
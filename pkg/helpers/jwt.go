@@ -1,6 +1,10 @@
 package helpers
 
 import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	jwt "github.com/golang-jwt/jwt/v5"
@@ -8,20 +12,217 @@ import (
 
 const ACCESS_TOKEN_EXPIRATION = 15 * time.Minute
 const REFRESH_TOKEN_EXPIRATION = 1 * time.Hour
+const MFA_TOKEN_EXPIRATION = 5 * time.Minute
+const MAGIC_LINK_EXPIRATION = 15 * time.Minute
 
-func GenerateToken(username string, expiration time.Duration) (string, error) {
+// SERVICE_TOKEN_EXPIRATION is kept short to limit how long a leaked service token is
+// good for, and how long a revoked one stays on the denylist; services ask for a new
+// one when theirs runs out.
+const SERVICE_TOKEN_EXPIRATION = 5 * time.Minute
 
-	claims := jwt.MapClaims{
-		"username": username,
-		"exp":      time.Now().Add(expiration).Unix(),
-		"iat":      time.Now(),
+const ACCESS_TOKEN_COOKIE = "access_token"
+
+// token types, carried in the typ claim.
+const (
+	AccessTokenType  = "access"
+	RefreshTokenType = "refresh"
+	MFATokenType     = "mfa"
+	MagicTokenType   = "magic"
+	// OAuthAccessTokenType is an access token issued to an OAuth client. It is only
+	// good for the endpoints of its scopes, not for the rest of the API.
+	OAuthAccessTokenType = "oauth_access"
+	// ServiceTokenType is an access token issued to a backend service with the
+	// client_credentials grant. It acts for the client, not for a user.
+	ServiceTokenType = "service"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+type Claims struct {
+	Username string `json:"username"`
+	Type     string `json:"typ"`
+	Version  uint   `json:"ver"`
+	Family   string `json:"fam,omitempty"`
+	// Organization is the organization the user is currently acting in, if any.
+	Organization uint `json:"org,omitempty"`
+	// Session is the login the token was issued for.
+	Session uint `json:"sid,omitempty"`
+	// Nonce binds the token to the client holding the value it is the hash of.
+	Nonce string `json:"nonce,omitempty"`
+	// ClientID is the OAuth client the token was issued to.
+	ClientID string `json:"client_id,omitempty"`
+	// Scope is the space-separated list of scopes granted to the client.
+	Scope string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// ClaimOption sets an optional claim on a token being generated.
+type ClaimOption func(*Claims)
+
+// WithOrganization scopes a token to the organization the user switched to.
+func WithOrganization(id uint) ClaimOption {
+	return func(c *Claims) {
+		c.Organization = id
 	}
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(EnvConfig.SecretKey))
+// WithSession ties a token to the login it was issued for, so that ending the login
+// invalidates it.
+func WithSession(id uint) ClaimOption {
+	return func(c *Claims) {
+		c.Session = id
+	}
+}
+
+// WithNonce binds a token to a client. nonce should be a hash of the value the client
+// keeps, since the token itself may be seen by others.
+func WithNonce(nonce string) ClaimOption {
+	return func(c *Claims) {
+		c.Nonce = nonce
+	}
+}
+
+// WithClient marks a token as issued to an OAuth client, within scope.
+func WithClient(clientID, scope string) ClaimOption {
+	return func(c *Claims) {
+		c.ClientID = clientID
+		c.Scope = scope
+	}
+}
+
+// WithSubject sets the sub claim, which identifies the user to OAuth clients.
+func WithSubject(subject string) ClaimOption {
+	return func(c *Claims) {
+		c.Subject = subject
+	}
+}
+
+func newClaims(username string, version uint, tokenType string, expiration time.Duration, opts []ClaimOption) (*Claims, error) {
+	tokenID, err := GenerateRandomString(16)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	now := time.Now()
+
+	claims := &Claims{
+		Username: username,
+		Type:     tokenType,
+		Version:  version,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	for _, opt := range opts {
+		opt(claims)
+	}
+
+	return claims, nil
+}
+
+// SignClaims signs claims with the active key, e.g. for tokens that don't fit Claims.
+func SignClaims(claims jwt.Claims) (string, error) {
+	if Keys == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(EnvConfig.SecretKey))
+	}
+
+	key := Keys.Active()
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Private)
+}
+
+// verificationKey resolves the key a token has to be verified with. Once signing keys
+// are configured, only tokens naming one of them in their kid header are accepted.
+func verificationKey(t *jwt.Token) (interface{}, error) {
+	if Keys == nil {
+		return []byte(EnvConfig.SecretKey), nil
+	}
+
+	id, _ := t.Header["kid"].(string)
+
+	key, err := Keys.Lookup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("key %q does not sign with %s", id, t.Method.Alg())
+	}
+
+	return key.Public(), nil
+}
+
+func validMethods() []string {
+	if Keys == nil {
+		return []string{jwt.SigningMethodHS256.Alg()}
+	}
+
+	return Keys.Methods()
+}
+
+// GenerateToken signs an access token. version is the user's current token version;
+// bumping it on the user invalidates every token issued before.
+func GenerateToken(username string, version uint, expiration time.Duration, opts ...ClaimOption) (string, *Claims, error) {
+	return GenerateTypedToken(username, version, AccessTokenType, expiration, opts...)
+}
+
+// GenerateTypedToken signs a token of the given type, e.g. the short-lived token
+// handed out between the password and the second factor of a login.
+func GenerateTypedToken(username string, version uint, tokenType string, expiration time.Duration, opts ...ClaimOption) (string, *Claims, error) {
+	claims, err := newClaims(username, version, tokenType, expiration, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tokenString, err := SignClaims(claims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return tokenString, claims, nil
+}
+
+// GenerateRefreshToken signs a refresh token belonging to the given token family.
+// The returned claims carry the token ID that has to be persisted so the token
+// can be rotated (and detected when reused) later on.
+func GenerateRefreshToken(username string, version uint, family string, opts ...ClaimOption) (string, *Claims, error) {
+	claims, err := newClaims(username, version, RefreshTokenType, REFRESH_TOKEN_EXPIRATION, opts)
+	if err != nil {
+		return "", nil, err
+	}
+
+	claims.Family = family
+
+	tokenString, err := SignClaims(claims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return tokenString, claims, nil
+}
+
+// ParseToken verifies the signature and expiry of tokenString and makes sure it is
+// of one of the expected types, so a refresh token can't be used in place of an
+// access token.
+func ParseToken(tokenString string, tokenTypes ...string) (*Claims, error) {
+	claims := &Claims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, verificationKey, jwt.WithValidMethods(validMethods()), jwt.WithExpirationRequired())
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	if !slices.Contains(tokenTypes, claims.Type) {
+		return nil, fmt.Errorf("%w: expected %s token, got %q", ErrInvalidToken, strings.Join(tokenTypes, " or "), claims.Type)
 	}
 
-	return tokenString, nil
+	return claims, nil
 }
@@ -0,0 +1,108 @@
+package helpers
+
+import (
+	"testing"
+)
+
+func TestParseToken(t *testing.T) {
+	EnvConfig.SecretKey = "test-secret"
+
+	t.Log("Given the need to test parsing tokens.")
+	{
+		t.Log("\tWhen checking a refresh token.")
+		{
+			token, claims, err := GenerateRefreshToken("Adedunmola", 0, "family")
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to generate a refresh token.", ballotX, err)
+			}
+			t.Log("\t\tShould be able to generate a refresh token.", checkMark)
+
+			parsed, err := ParseToken(token, RefreshTokenType)
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to parse the refresh token.", ballotX, err)
+			}
+			t.Log("\t\tShould be able to parse the refresh token.", checkMark)
+
+			if parsed.ID != claims.ID || parsed.Family != "family" || parsed.Username != "Adedunmola" {
+				t.Errorf("\t\tShould keep the token claims, but got %+v. %v", parsed, ballotX)
+			}
+			t.Log("\t\tShould keep the token claims.", checkMark)
+
+			if _, err := ParseToken(token, AccessTokenType); err == nil {
+				t.Error("\t\tShould not accept a refresh token as an access token.", ballotX)
+			}
+			t.Log("\t\tShould not accept a refresh token as an access token.", checkMark)
+		}
+
+		t.Log("\tWhen checking a token scoped to an organization.")
+		{
+			token, _, err := GenerateToken("Adedunmola", 0, ACCESS_TOKEN_EXPIRATION, WithOrganization(42))
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to generate an access token.", ballotX, err)
+			}
+
+			claims, err := ParseToken(token, AccessTokenType)
+
+			if err != nil || claims.Organization != 42 {
+				t.Errorf("\t\tShould carry the organization claim, but got %+v %v. %v", claims, err, ballotX)
+			}
+			t.Log("\t\tShould carry the organization claim.", checkMark)
+		}
+
+		t.Log("\tWhen checking a token issued for a session.")
+		{
+			token, _, err := GenerateToken("Adedunmola", 0, ACCESS_TOKEN_EXPIRATION, WithSession(7))
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to generate an access token.", ballotX, err)
+			}
+
+			claims, err := ParseToken(token, AccessTokenType)
+
+			if err != nil || claims.Session != 7 {
+				t.Errorf("\t\tShould carry the session claim, but got %+v %v. %v", claims, err, ballotX)
+			}
+			t.Log("\t\tShould carry the session claim.", checkMark)
+		}
+
+		t.Log("\tWhen checking a service token.")
+		{
+			token, _, err := GenerateTypedToken("", 0, ServiceTokenType, SERVICE_TOKEN_EXPIRATION, WithClient("billing", "users:read"), WithSubject("billing"))
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to generate a service token.", ballotX, err)
+			}
+
+			claims, err := ParseToken(token, AccessTokenType, ServiceTokenType)
+
+			if err != nil || claims.Type != ServiceTokenType || claims.Subject != "billing" || claims.ClientID != "billing" {
+				t.Errorf("\t\tShould accept it where service tokens are expected, but got %+v %v. %v", claims, err, ballotX)
+			}
+			t.Log("\t\tShould accept it where service tokens are expected.", checkMark)
+
+			if _, err := ParseToken(token, AccessTokenType); err == nil {
+				t.Error("\t\tShould not accept it as a user's access token.", ballotX)
+			}
+			t.Log("\t\tShould not accept it as a user's access token.", checkMark)
+		}
+
+		t.Log("\tWhen checking a token signed with another key.")
+		{
+			token, _, err := GenerateToken("Adedunmola", 0, ACCESS_TOKEN_EXPIRATION)
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to generate an access token.", ballotX, err)
+			}
+
+			EnvConfig.SecretKey = "another-secret"
+
+			if _, err := ParseToken(token, AccessTokenType); err == nil {
+				t.Error("\t\tShould reject the token.", ballotX)
+			}
+			t.Log("\t\tShould reject the token.", checkMark)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package helpers
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// Keys signs and verifies tokens with asymmetric keys when configured. While it is
+// nil, tokens are signed with HS256 and EnvConfig.SecretKey.
+var Keys *KeyManager
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	Private   crypto.Signer
+	RetiredAt *time.Time
+}
+
+func (k *SigningKey) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// KeyManager holds the active signing key along with the retired keys that may
+// still have unexpired tokens out there.
+type KeyManager struct {
+	mu        sync.RWMutex
+	active    *SigningKey
+	keys      map[string]*SigningKey
+	retention time.Duration
+}
+
+// NewKeyManager returns an empty KeyManager. Retired keys stay usable for
+// verification for retention, which should be at least the longest token lifetime.
+func NewKeyManager(retention time.Duration) *KeyManager {
+	return &KeyManager{keys: make(map[string]*SigningKey), retention: retention}
+}
+
+// LoadKeyManager reads every PEM file in paths, using the file name (without its
+// extension) as the key ID. The key named activeID signs new tokens, the others are
+// only kept to verify tokens signed before the rotation. They were retired at the time
+// given in retiredAt, or else when their file was last modified, so that restarts
+// don't keep them trusted forever.
+func LoadKeyManager(paths []string, activeID string, retiredAt map[string]time.Time) (*KeyManager, error) {
+	m := NewKeyManager(REFRESH_TOKEN_EXPIRATION)
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+		key, err := ParseSigningKey(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		if id != activeID {
+			retired, ok := retiredAt[id]
+
+			if !ok {
+				info, err := os.Stat(path)
+				if err != nil {
+					return nil, err
+				}
+
+				retired = info.ModTime()
+			}
+
+			key.RetiredAt = &retired
+			m.Retire(key)
+			continue
+		}
+
+		m.Rotate(key)
+	}
+
+	if m.Active() == nil {
+		return nil, fmt.Errorf("active signing key %q not found", activeID)
+	}
+
+	return m, nil
+}
+
+// ParseRetiredKeys reads the times keys were retired at, written as "<key ID>=<RFC 3339
+// time>" and separated by commas.
+func ParseRetiredKeys(s string) (map[string]time.Time, error) {
+	retired := make(map[string]time.Time)
+
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+
+		if entry == "" {
+			continue
+		}
+
+		id, at, ok := strings.Cut(entry, "=")
+
+		if !ok || strings.TrimSpace(id) == "" {
+			return nil, fmt.Errorf("retired key %q has no key ID", entry)
+		}
+
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(at))
+
+		if err != nil {
+			return nil, fmt.Errorf("retired key %q: %w", entry, err)
+		}
+
+		retired[strings.TrimSpace(id)] = t
+	}
+
+	return retired, nil
+}
+
+// ParseSigningKey parses a PEM encoded RSA (RS256) or Ed25519 (EdDSA) private key.
+func ParseSigningKey(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed interface{}
+	var err error
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSigningKey(id, parsed)
+}
+
+// NewSigningKey wraps an *rsa.PrivateKey or ed25519.PrivateKey.
+func NewSigningKey(id string, private interface{}) (*SigningKey, error) {
+	switch key := private.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, Private: key}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, Private: key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+}
+
+// Rotate makes key the active signing key, retiring the previously active one.
+func (m *KeyManager) Rotate(key *SigningKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.active != nil {
+		now := time.Now()
+		m.active.RetiredAt = &now
+	}
+
+	key.RetiredAt = nil
+	m.active = key
+	m.keys[key.ID] = key
+}
+
+// Retire adds key for verification only.
+func (m *KeyManager) Retire(key *SigningKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if key.RetiredAt == nil {
+		now := time.Now()
+		key.RetiredAt = &now
+	}
+
+	m.keys[key.ID] = key
+}
+
+func (m *KeyManager) Active() *SigningKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.active
+}
+
+// Lookup returns the key with the given ID if it may still verify tokens.
+func (m *KeyManager) Lookup(id string) (*SigningKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune()
+
+	key, ok := m.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+
+	return key, nil
+}
+
+// Methods returns the algorithms of the keys in use.
+func (m *KeyManager) Methods() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var methods []string
+	seen := make(map[string]bool)
+
+	for _, key := range m.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+
+	return methods
+}
+
+// prune drops the retired keys whose tokens have all expired. Callers must hold mu.
+func (m *KeyManager) prune() {
+	for id, key := range m.keys {
+		if key.RetiredAt != nil && time.Since(*key.RetiredAt) > m.retention {
+			delete(m.keys, id)
+		}
+	}
+}
+
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public halves of every key that may still verify tokens.
+func (m *KeyManager) JWKS() JSONWebKeySet {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune()
+
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+
+	for _, key := range m.keys {
+		jwk := JSONWebKey{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+
+		switch public := key.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+
+	return set
+}
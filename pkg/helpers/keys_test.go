@@ -0,0 +1,187 @@
+package helpers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeKey(t *testing.T, dir, name string, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal("\t\tShould be able to marshal the key.", ballotX, err)
+	}
+
+	path := filepath.Join(dir, name+".pem")
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal("\t\tShould be able to write the key.", ballotX, err)
+	}
+
+	return path
+}
+
+func TestKeyManager(t *testing.T) {
+	defer func() { Keys = nil }()
+
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("Should be able to generate an RSA key.", ballotX, err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("Should be able to generate an Ed25519 key.", ballotX, err)
+	}
+
+	paths := []string{writeKey(t, dir, "2024-rsa", rsaKey), writeKey(t, dir, "2025-ed25519", edKey)}
+
+	t.Log("Given the need to test signing tokens with rotating keys.")
+	{
+		t.Log("\tWhen loading keys from PEM files.")
+		{
+			Keys, err = LoadKeyManager(paths, "2024-rsa", nil)
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to load the keys.", ballotX, err)
+			}
+			t.Log("\t\tShould be able to load the keys.", checkMark)
+
+			if jwks := Keys.JWKS(); len(jwks.Keys) != 2 || jwks.Keys[0].KeyType != "RSA" || jwks.Keys[1].Curve != "Ed25519" {
+				t.Errorf("\t\tShould publish both public keys, but got %+v. %v", jwks, ballotX)
+			}
+			t.Log("\t\tShould publish both public keys.", checkMark)
+		}
+
+		t.Log("\tWhen rotating the active key.")
+		{
+			oldToken, _, err := GenerateToken("Adedunmola", 0, ACCESS_TOKEN_EXPIRATION)
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to sign with the RSA key.", ballotX, err)
+			}
+
+			key, _ := Keys.Lookup("2025-ed25519")
+			Keys.Rotate(key)
+
+			newToken, _, err := GenerateToken("Adedunmola", 0, ACCESS_TOKEN_EXPIRATION)
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to sign with the Ed25519 key.", ballotX, err)
+			}
+
+			if _, err := ParseToken(newToken, AccessTokenType); err != nil {
+				t.Error("\t\tShould verify tokens signed with the new key.", ballotX, err)
+			}
+			t.Log("\t\tShould verify tokens signed with the new key.", checkMark)
+
+			if _, err := ParseToken(oldToken, AccessTokenType); err != nil {
+				t.Error("\t\tShould still verify tokens signed with the retired key.", ballotX, err)
+			}
+			t.Log("\t\tShould still verify tokens signed with the retired key.", checkMark)
+
+			retired, _ := Keys.Lookup("2024-rsa")
+			expired := time.Now().Add(-2 * REFRESH_TOKEN_EXPIRATION)
+			retired.RetiredAt = &expired
+
+			if _, err := ParseToken(oldToken, AccessTokenType); err == nil {
+				t.Error("\t\tShould drop the retired key once its tokens have expired.", ballotX)
+			}
+			t.Log("\t\tShould drop the retired key once its tokens have expired.", checkMark)
+
+			if jwks := Keys.JWKS(); len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != "2025-ed25519" {
+				t.Errorf("\t\tShould only publish the active key, but got %+v. %v", jwks, ballotX)
+			}
+			t.Log("\t\tShould only publish the active key.", checkMark)
+		}
+
+		t.Log("\tWhen checking an HS256 token signed with the shared secret.")
+		{
+			Keys = nil
+			EnvConfig.SecretKey = "test-secret"
+
+			token, _, err := GenerateToken("Adedunmola", 0, ACCESS_TOKEN_EXPIRATION)
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to sign with the shared secret.", ballotX, err)
+			}
+
+			Keys, _ = LoadKeyManager(paths, "2025-ed25519", nil)
+
+			if _, err := ParseToken(token, AccessTokenType); err == nil {
+				t.Error("\t\tShould reject it once signing keys are configured.", ballotX)
+			}
+			t.Log("\t\tShould reject it once signing keys are configured.", checkMark)
+		}
+
+		t.Log("\tWhen loading a key retired longer ago than tokens live.")
+		{
+			expired := time.Now().Add(-2 * REFRESH_TOKEN_EXPIRATION)
+
+			Keys, err = LoadKeyManager(paths, "2025-ed25519", map[string]time.Time{"2024-rsa": expired})
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to load the keys.", ballotX, err)
+			}
+
+			if _, err := Keys.Lookup("2024-rsa"); !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("\t\tShould drop it, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould drop it.", checkMark)
+		}
+
+		t.Log("\tWhen loading a retired key without a retirement time.")
+		{
+			modified := time.Now().Add(-2 * REFRESH_TOKEN_EXPIRATION)
+
+			if err := os.Chtimes(paths[0], modified, modified); err != nil {
+				t.Fatal("\t\tShould be able to change the file's times.", ballotX, err)
+			}
+
+			Keys, err = LoadKeyManager(paths, "2025-ed25519", nil)
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to load the keys.", ballotX, err)
+			}
+
+			if _, err := Keys.Lookup("2024-rsa"); !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("\t\tShould take the time from the file and drop it, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould take the time from the file and drop it.", checkMark)
+		}
+	}
+}
+
+func TestParseRetiredKeys(t *testing.T) {
+	t.Log("Given the need to test reading the times keys were retired at.")
+	{
+		t.Log("\tWhen the setting is well formed.")
+		{
+			retired, err := ParseRetiredKeys("2024-rsa=2025-01-31T00:00:00Z, 2023-rsa=2024-01-31T00:00:00Z")
+
+			if err != nil || len(retired) != 2 || !retired["2024-rsa"].Equal(time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("\t\tShould read every key, but got %v %v. %v", retired, err, ballotX)
+			}
+			t.Log("\t\tShould read every key.", checkMark)
+		}
+
+		for _, setting := range []string{"2024-rsa", "=2025-01-31T00:00:00Z", "2024-rsa=yesterday"} {
+			t.Logf("\tWhen the setting is %q.", setting)
+			{
+				if _, err := ParseRetiredKeys(setting); err == nil {
+					t.Errorf("\t\tShould fail. %v", ballotX)
+				}
+				t.Log("\t\tShould fail.", checkMark)
+			}
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package mailer
+
+import (
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+)
+
+// InitMailer sets up Default with the transport picked by MAIL_TRANSPORT: "smtp",
+// "memory" or, by default, "file".
+func InitMailer() {
+	var m Mailer
+
+	switch helpers.EnvConfig.MailTransport {
+	case "smtp":
+		m = NewSMTPMailer(helpers.EnvConfig.SMTPHost, helpers.EnvConfig.SMTPPort, helpers.EnvConfig.SMTPUsername, helpers.EnvConfig.SMTPPassword)
+	case "memory":
+		m = NewMemoryMailer()
+	default:
+		dir := helpers.EnvConfig.MailDir
+		if dir == "" {
+			dir = "tmp/mail"
+		}
+
+		m = NewFileMailer(dir)
+	}
+
+	Default = NewQueue(m, QueueConfig{From: helpers.EnvConfig.MailFrom})
+}
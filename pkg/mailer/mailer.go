@@ -0,0 +1,17 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrNoRecipients = errors.New("message has no recipients")
+
+// Mailer delivers a single message.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Default is the queue used by the handlers to send mail in the background. It is
+// set up on startup from the mail configuration.
+var Default *Queue
@@ -0,0 +1,310 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const checkMark = "\u2713"
+const ballotX = "\u2717"
+
+// fakeSMTPServer speaks just enough SMTP to accept messages from net/smtp.
+type fakeSMTPServer struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	from     string
+	rcpts    []string
+	messages []string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Should be able to start the fake SMTP server.", ballotX, err)
+	}
+
+	s := &fakeSMTPServer{listener: listener}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost fake SMTP")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.TrimSpace(line))
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from = strings.TrimSpace(line[len("MAIL FROM:"):])
+			s.mu.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, strings.TrimSpace(line[len("RCPT TO:"):]))
+			s.mu.Unlock()
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+
+			var data strings.Builder
+
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+
+			s.mu.Lock()
+			s.messages = append(s.messages, data.String())
+			s.mu.Unlock()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+type flakyMailer struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	sent     chan *Message
+}
+
+func (m *flakyMailer) Send(ctx context.Context, msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.attempts++
+
+	if m.attempts <= m.failures {
+		return errors.New("mail server unavailable")
+	}
+
+	m.sent <- msg
+
+	return nil
+}
+
+func TestRender(t *testing.T) {
+	data := struct{ Name, Link, ExpiresIn string }{"Adedunmola", "https://example.com/reset?token=<abc>", "30 minutes"}
+
+	t.Log("Given the need to test rendering templates.")
+	{
+		t.Log("\tWhen rendering the password reset template.")
+		{
+			msg, err := Render(PasswordResetTemplate, "ade@example.com", data)
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to render the template.", ballotX, err)
+			}
+			t.Log("\t\tShould be able to render the template.", checkMark)
+
+			if msg.Subject != "Reset your password" {
+				t.Errorf("\t\tShould have the subject, but got %q. %v", msg.Subject, ballotX)
+			}
+			t.Log("\t\tShould have the subject.", checkMark)
+
+			if !strings.Contains(msg.Text, data.Link) {
+				t.Errorf("\t\tShould have the link in the text body. %v", ballotX)
+			}
+			t.Log("\t\tShould have the link in the text body.", checkMark)
+
+			if !strings.Contains(msg.HTML, "token=%3cabc%3e") {
+				t.Errorf("\t\tShould escape the link in the html body, but got %s. %v", msg.HTML, ballotX)
+			}
+			t.Log("\t\tShould escape the link in the html body.", checkMark)
+		}
+
+		t.Log("\tWhen rendering the invitation template.")
+		{
+			invitation := struct{ Organization, InvitedBy, Role, Link, ExpiresIn string }{"Acme", "Adedunmola", "member", "https://example.com/invitations/accept?token=abc", "7 days"}
+
+			msg, err := Render(InvitationTemplate, "ade@example.com", invitation)
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to render the template.", ballotX, err)
+			}
+			t.Log("\t\tShould be able to render the template.", checkMark)
+
+			if msg.Subject != "You have been invited to join Acme" || !strings.Contains(msg.Text, invitation.Link) {
+				t.Errorf("\t\tShould name the organization and link to the invitation, but got %q. %v", msg.Subject, ballotX)
+			}
+			t.Log("\t\tShould name the organization and link to the invitation.", checkMark)
+		}
+
+		t.Log("\tWhen rendering the magic link template.")
+		{
+			msg, err := Render(MagicLinkTemplate, "ade@example.com", data)
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to render the template.", ballotX, err)
+			}
+			t.Log("\t\tShould be able to render the template.", checkMark)
+
+			if msg.Subject != "Your login link" || !strings.Contains(msg.Text, data.Link) {
+				t.Errorf("\t\tShould have the subject and the link, but got %q. %v", msg.Subject, ballotX)
+			}
+			t.Log("\t\tShould have the subject and the link.", checkMark)
+		}
+
+		t.Log("\tWhen rendering the new device template.")
+		{
+			device := struct{ Name, UserAgent, IPAddress, Time string }{"Adedunmola", "<script>", "192.0.2.1", "2 Jan 2006 15:04 UTC"}
+
+			msg, err := Render(NewDeviceTemplate, "ade@example.com", device)
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to render the template.", ballotX, err)
+			}
+			t.Log("\t\tShould be able to render the template.", checkMark)
+
+			if !strings.Contains(msg.Text, device.IPAddress) || strings.Contains(msg.HTML, device.UserAgent) {
+				t.Errorf("\t\tShould name the address and escape the user agent, but got %s. %v", msg.HTML, ballotX)
+			}
+			t.Log("\t\tShould name the address and escape the user agent.", checkMark)
+		}
+
+		t.Log("\tWhen rendering an unknown template version.")
+		{
+			if _, err := Render(Template{Name: "password_reset", Version: 99}, "ade@example.com", data); err == nil {
+				t.Error("\t\tShould fail to render.", ballotX)
+			}
+			t.Log("\t\tShould fail to render.", checkMark)
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	defer server.listener.Close()
+
+	addr := server.listener.Addr().(*net.TCPAddr)
+	m := NewSMTPMailer("127.0.0.1", addr.Port, "", "")
+
+	t.Log("Given the need to test sending mail over SMTP.")
+	{
+		t.Log("\tWhen sending a message.")
+		{
+			msg := &Message{From: "Zephyr <no-reply@example.com>", To: []string{"ade@example.com"}, Subject: "Hello", Text: "Hello there", HTML: "<p>Hello there</p>"}
+
+			if err := m.Send(context.Background(), msg); err != nil {
+				t.Fatal("\t\tShould be able to send the message.", ballotX, err)
+			}
+			t.Log("\t\tShould be able to send the message.", checkMark)
+
+			server.mu.Lock()
+			defer server.mu.Unlock()
+
+			if server.from != "<no-reply@example.com>" || len(server.rcpts) != 1 || server.rcpts[0] != "<ade@example.com>" {
+				t.Errorf("\t\tShould use the bare addresses on the envelope, but got %s %v. %v", server.from, server.rcpts, ballotX)
+			}
+			t.Log("\t\tShould use the bare addresses on the envelope.", checkMark)
+
+			if len(server.messages) != 1 || !strings.Contains(server.messages[0], "Subject: Hello") || !strings.Contains(server.messages[0], "multipart/alternative") {
+				t.Errorf("\t\tShould deliver a multipart message, but got %v. %v", server.messages, ballotX)
+			}
+			t.Log("\t\tShould deliver a multipart message.", checkMark)
+		}
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := NewFileMailer(dir)
+
+	t.Log("Given the need to test dropping mail in a directory.")
+	{
+		t.Log("\tWhen sending a message.")
+		{
+			if err := m.Send(context.Background(), &Message{From: "no-reply@example.com", To: []string{"ade@example.com"}, Subject: "Hello", Text: "Hello there"}); err != nil {
+				t.Fatal("\t\tShould be able to send the message.", ballotX, err)
+			}
+
+			entries, _ := os.ReadDir(dir)
+
+			if len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), ".eml") {
+				t.Errorf("\t\tShould write a single .eml file, but got %v. %v", entries, ballotX)
+			}
+			t.Log("\t\tShould write a single .eml file.", checkMark)
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	t.Log("Given the need to test sending mail in the background.")
+	{
+		t.Log("\tWhen the mail server fails a couple of times.")
+		{
+			m := &flakyMailer{failures: 2, sent: make(chan *Message, 1)}
+			q := NewQueue(m, QueueConfig{From: "no-reply@example.com", Workers: 1, Backoff: time.Millisecond})
+			defer q.Close()
+
+			if err := q.Enqueue(&Message{To: []string{"ade@example.com"}, Subject: "Hello"}); err != nil {
+				t.Fatal("\t\tShould be able to queue the message.", ballotX, err)
+			}
+
+			select {
+			case msg := <-m.sent:
+				if msg.From != "no-reply@example.com" {
+					t.Errorf("\t\tShould use the default sender, but got %q. %v", msg.From, ballotX)
+				}
+				t.Log("\t\tShould deliver the message after retrying.", checkMark)
+			case <-time.After(time.Second):
+				t.Fatal("\t\tShould deliver the message after retrying.", ballotX)
+			}
+		}
+
+		t.Log("\tWhen the queue has been closed.")
+		{
+			q := NewQueue(NewMemoryMailer(), QueueConfig{})
+			q.Close()
+
+			if err := q.Enqueue(&Message{To: []string{"ade@example.com"}}); err != ErrQueueClosed {
+				t.Errorf("\t\tShould refuse new messages, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould refuse new messages.", checkMark)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+)
+
+var ErrQueueFull = errors.New("mail queue is full")
+var ErrQueueClosed = errors.New("mail queue is closed")
+
+type QueueConfig struct {
+	// From is used for messages that don't set their own sender.
+	From    string
+	Workers int
+	Size    int
+	// MaxAttempts is how many times a message is tried before it is dropped.
+	MaxAttempts int
+	// Backoff is the delay before the first retry; it doubles on every attempt.
+	Backoff time.Duration
+}
+
+// Queue sends messages in the background, retrying failed deliveries, so that a slow
+// or unavailable mail server never holds up a request.
+type Queue struct {
+	mailer Mailer
+	config QueueConfig
+	jobs   chan *Message
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewQueue(m Mailer, config QueueConfig) *Queue {
+	if config.Workers <= 0 {
+		config.Workers = 2
+	}
+	if config.Size <= 0 {
+		config.Size = 100
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = 2 * time.Second
+	}
+
+	q := &Queue{
+		mailer: m,
+		config: config,
+		jobs:   make(chan *Message, config.Size),
+		stop:   make(chan struct{}),
+	}
+
+	for i := 0; i < config.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+
+	return q
+}
+
+// Enqueue schedules msg for delivery without waiting for it to be sent.
+func (q *Queue) Enqueue(msg *Message) error {
+	if msg.From == "" {
+		msg.From = q.config.From
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.jobs <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting messages and waits for the queued ones to be tried. Messages
+// waiting for a retry are dropped.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.jobs)
+	close(q.stop)
+	q.mu.Unlock()
+
+	q.wg.Wait()
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	for msg := range q.jobs {
+		q.deliver(msg)
+	}
+}
+
+func (q *Queue) deliver(msg *Message) {
+	backoff := q.config.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err := q.mailer.Send(context.Background(), msg)
+
+		if err == nil {
+			return
+		}
+
+		if attempt == q.config.MaxAttempts {
+			helpers.Error.Printf("giving up on mail %q to %v after %d attempts: %v", msg.Subject, msg.To, attempt, err)
+			return
+		}
+
+		helpers.Warning.Printf("sending mail %q to %v failed (attempt %d), retrying in %s: %v", msg.Subject, msg.To, attempt, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-q.stop:
+			helpers.Error.Printf("dropping mail %q to %v on shutdown: %v", msg.Subject, msg.To, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// Template identifies a versioned email template. Every version lives in
+// templates/<name>/v<version>.{txt,html}; the text template also defines the subject.
+// Old versions are kept around so a message can be re-rendered exactly as it was sent.
+type Template struct {
+	Name    string
+	Version int
+}
+
+var (
+	PasswordResetTemplate     = Template{Name: "password_reset", Version: 1}
+	EmailVerificationTemplate = Template{Name: "email_verification", Version: 1}
+	InvitationTemplate        = Template{Name: "invitation", Version: 1}
+	MagicLinkTemplate         = Template{Name: "magic_link", Version: 1}
+	NewDeviceTemplate         = Template{Name: "new_device", Version: 1}
+)
+
+func (t Template) path(ext string) string {
+	return fmt.Sprintf("templates/%s/v%d.%s", t.Name, t.Version, ext)
+}
+
+// Render builds a message addressed to to from the text and html versions of t.
+func Render(t Template, to string, data interface{}) (*Message, error) {
+	text, err := texttemplate.ParseFS(templateFS, t.path("txt"))
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{To: []string{to}}
+
+	var buf bytes.Buffer
+
+	if err := text.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return nil, err
+	}
+	msg.Subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+
+	if err := text.ExecuteTemplate(&buf, "body", data); err != nil {
+		return nil, err
+	}
+	msg.Text = strings.TrimSpace(buf.String())
+
+	// the html version is optional.
+	if _, err := fs.Stat(templateFS, t.path("html")); err != nil {
+		return msg, nil
+	}
+
+	html, err := htmltemplate.ParseFS(templateFS, t.path("html"))
+	if err != nil {
+		return nil, err
+	}
+
+	buf.Reset()
+
+	if err := html.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	msg.HTML = buf.String()
+
+	return msg, nil
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"gorm.io/gorm"
+)
+
+// API_KEY_LAST_USED_INTERVAL is how stale the last use of a key may get before it is
+// written back, so that busy keys don't cause a write per request.
+const API_KEY_LAST_USED_INTERVAL = time.Minute
+
+// methodScope is the scope an API key needs for a request. Write access includes read
+// access.
+func methodScope(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return models.ReadScope
+	default:
+		return models.WriteScope
+	}
+}
+
+// authenticateAPIKey is Authenticate for requests presenting an API key. The claims
+// of the principal only carry the user and the key's organization.
+func authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, key string) {
+	prefix, secret, ok := helpers.ParseAPIKey(key)
+
+	if !ok {
+		unauthorized(w, "Invalid API key")
+		return
+	}
+
+	var apiKey models.APIKey
+
+	result := database.DB.Preload("User.Roles.Permissions").Where(models.APIKey{Prefix: prefix}).First(&apiKey)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		unauthorized(w, "Invalid API key")
+		return
+	}
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to verify API key", Data: nil, Status: "error"})
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(helpers.HashToken(secret)), []byte(apiKey.SecretHash)) != 1 || !apiKey.Active() {
+		unauthorized(w, "Invalid API key")
+		return
+	}
+
+	scope := methodScope(r.Method)
+
+	if !apiKey.Scopes.Has(scope) && !apiKey.Scopes.Has(models.WriteScope) {
+		helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: fmt.Sprintf("API key lacks the %s scope", scope), Data: nil, Status: "error"})
+		return
+	}
+
+	now := time.Now()
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= API_KEY_LAST_USED_INTERVAL {
+		if err := database.DB.Model(&apiKey).UpdateColumn("last_used_at", now).Error; err != nil {
+			helpers.Error.Println(err)
+		}
+	}
+
+	claims := &helpers.Claims{Username: apiKey.User.Username, Version: apiKey.User.TokenVersion}
+
+	if apiKey.OrganizationID != nil {
+		claims.Organization = *apiKey.OrganizationID
+	}
+
+	ctx := WithPrincipal(r.Context(), &Principal{User: &apiKey.User, Claims: claims, APIKey: &apiKey})
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RequireSession only lets through users who logged in, not API keys or services. It
+// guards the endpoints that manage logins and credentials. It has to run after
+// Authenticate.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := GetPrincipal(r.Context())
+
+		if !ok {
+			unauthorized(w, "authentication required")
+			return
+		}
+
+		if principal.Service() {
+			helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "not available to services", Data: nil, Status: "error"})
+			return
+		}
+
+		if principal.APIKey != nil {
+			helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "not available to API keys", Data: nil, Status: "error"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/denylist"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+)
+
+type principalKey struct{}
+
+// Principal is the authenticated caller of a request. Membership is only set by
+// RequireOrganization, APIKey only when the caller authenticated with one. Services
+// calling with a client_credentials token have a Client instead of a User.
+type Principal struct {
+	User       *models.User
+	Claims     *helpers.Claims
+	Membership *models.Membership
+	APIKey     *models.APIKey
+	Client     *models.Client
+}
+
+// Service reports whether the principal is a backend service rather than a user.
+func (p *Principal) Service() bool {
+	return p.Client != nil
+}
+
+// HasPermission reports whether the principal may act with permission. Users need a
+// role granting it, which their API key has to have as a scope as well. Services need
+// it both in the scope of their token and in the current scopes of their client.
+func (p *Principal) HasPermission(permission string) bool {
+	if p.Service() {
+		return p.Client.Scopes.Has(permission) && p.Claims != nil && slices.Contains(strings.Fields(p.Claims.Scope), permission)
+	}
+
+	return p.User.HasPermission(permission) && (p.APIKey == nil || p.APIKey.Scopes.Has(permission))
+}
+
+// GetPrincipal returns the principal stored on ctx by Authenticate.
+func GetPrincipal(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+
+	return principal, ok
+}
+
+// WithPrincipal returns a copy of ctx carrying principal.
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// Authenticate rejects requests without a valid access token, service token or API key
+// and puts the authenticated principal on the request context. Routes that only make
+// sense for users have to add RequireUser.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString := tokenFromRequest(r)
+
+		if tokenString == "" {
+			unauthorized(w, "authentication required")
+			return
+		}
+
+		if strings.HasPrefix(tokenString, helpers.API_KEY_PREFIX) {
+			authenticateAPIKey(w, r, next, tokenString)
+			return
+		}
+
+		claims, err := helpers.ParseToken(tokenString, helpers.AccessTokenType, helpers.ServiceTokenType)
+
+		if err != nil {
+			unauthorized(w, "Invalid token")
+			return
+		}
+
+		revoked, err := denylist.Default.IsRevoked(r.Context(), claims.ID)
+
+		if err != nil {
+			helpers.Error.Println(err)
+			helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to verify token", Data: nil, Status: "error"})
+			return
+		}
+
+		if revoked {
+			unauthorized(w, "token has been revoked")
+			return
+		}
+
+		if claims.Type == helpers.ServiceTokenType {
+			authenticateService(w, r, next, claims)
+			return
+		}
+
+		var user models.User
+
+		result := database.DB.Preload("Roles.Permissions").Where(models.User{Username: claims.Username}).First(&user)
+
+		if result.Error != nil {
+			unauthorized(w, "Invalid token")
+			return
+		}
+
+		if claims.Version != user.TokenVersion {
+			unauthorized(w, "token has been revoked")
+			return
+		}
+
+		// sessions can be ended from another device, which has to take effect before the
+		// access token expires.
+		if claims.Session != 0 {
+			active, err := models.SessionActive(database.DB, claims.Session, user.ID)
+
+			if err != nil {
+				helpers.Error.Println(err)
+				helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to verify token", Data: nil, Status: "error"})
+				return
+			}
+
+			if !active {
+				unauthorized(w, "session has been revoked")
+				return
+			}
+		}
+
+		ctx := WithPrincipal(r.Context(), &Principal{User: &user, Claims: claims})
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// tokenFromRequest reads the access token from the Authorization header, falling
+// back to the access token cookie set on login.
+func tokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			return ""
+		}
+
+		return strings.TrimSpace(token)
+	}
+
+	if cookie, err := r.Cookie(helpers.ACCESS_TOKEN_COOKIE); err == nil {
+		return cookie.Value
+	}
+
+	return ""
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="zephyr"`)
+	helpers.RespondWithJSON(w, http.StatusUnauthorized, helpers.APIResponse{Message: message, Data: nil, Status: "error"})
+}
+
+// RequireVerifiedEmail only lets through users who have confirmed their email
+// address. It has to run after Authenticate.
+func RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := GetPrincipal(r.Context())
+
+		if !ok {
+			unauthorized(w, "authentication required")
+			return
+		}
+
+		if principal.Service() || principal.User.EmailVerifiedAt == nil {
+			helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "email address has not been verified", Data: nil, Status: "error"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission only lets through principals holding every one of permissions, see
+// Principal.HasPermission. It has to run after Authenticate.
+func RequirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := GetPrincipal(r.Context())
+
+			if !ok {
+				unauthorized(w, "authentication required")
+				return
+			}
+
+			for _, permission := range permissions {
+				if !principal.HasPermission(permission) {
+					helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "insufficient permissions", Data: nil, Status: "error"})
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
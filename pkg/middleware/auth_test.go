@@ -0,0 +1,479 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/denylist"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/DATA-DOG/go-sqlmock"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const checkMark = "\u2713"
+const ballotX = "\u2717"
+
+func TestAuthenticateRejectsBadTokens(t *testing.T) {
+	helpers.EnvConfig.SecretKey = "test-secret"
+
+	refreshToken, _, err := helpers.GenerateRefreshToken("Adedunmola", 0, "family")
+	if err != nil {
+		t.Fatal("Should be able to generate a refresh token.", ballotX, err)
+	}
+
+	expiredToken, _, err := helpers.GenerateToken("Adedunmola", 0, -time.Minute)
+	if err != nil {
+		t.Fatal("Should be able to generate an access token.", ballotX, err)
+	}
+
+	noneToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"username": "Adedunmola",
+		"typ":      helpers.AccessTokenType,
+		"exp":      time.Now().Add(time.Minute).Unix(),
+	}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal("Should be able to generate an unsigned token.", ballotX, err)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"a missing token", ""},
+		{"a non bearer scheme", "Basic Zm9vOmJhcg=="},
+		{"a malformed token", "Bearer not-a-token"},
+		{"a refresh token", "Bearer " + refreshToken},
+		{"an expired token", "Bearer " + expiredToken},
+		{"an unsigned token", "Bearer " + noneToken},
+		{"a malformed API key", "Bearer zk_not-a-key"},
+	}
+
+	handler := Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("\t\tShould not reach the protected handler.", ballotX)
+	}))
+
+	t.Log("Given the need to test rejecting bad tokens.")
+	{
+		for _, tt := range tests {
+			t.Logf("\tWhen checking %s.", tt.name)
+			{
+				req := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+				if tt.header != "" {
+					req.Header.Set("Authorization", tt.header)
+				}
+
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, req)
+
+				if rw.Code != http.StatusUnauthorized {
+					t.Errorf("\t\tShould receive a %d status code, but got %v. %v", http.StatusUnauthorized, rw.Code, ballotX)
+				}
+				t.Logf("\t\tShould receive a %d status code. %v", http.StatusUnauthorized, checkMark)
+
+				var payload helpers.APIResponse
+
+				if err := json.NewDecoder(rw.Body).Decode(&payload); err != nil || payload.Status != "error" {
+					t.Errorf("\t\tShould receive an error response, but got %+v. %v", payload, ballotX)
+				}
+				t.Log("\t\tShould receive an error response.", checkMark)
+			}
+		}
+	}
+}
+
+func TestAuthenticateRejectsRevokedTokens(t *testing.T) {
+	helpers.EnvConfig.SecretKey = "test-secret"
+	denylist.Default = denylist.NewMemoryStore()
+
+	token, claims, err := helpers.GenerateToken("Adedunmola", 0, helpers.ACCESS_TOKEN_EXPIRATION)
+	if err != nil {
+		t.Fatal("Should be able to generate an access token.", ballotX, err)
+	}
+
+	denylist.Default.Revoke(context.Background(), claims.ID, claims.ExpiresAt.Time)
+
+	handler := Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("\t\tShould not reach the protected handler.", ballotX)
+	}))
+
+	t.Log("Given the need to test rejecting revoked tokens.")
+	{
+		t.Log("\tWhen checking a token on the denylist.")
+		{
+			req := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+			req.AddCookie(&http.Cookie{Name: helpers.ACCESS_TOKEN_COOKIE, Value: token})
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != http.StatusUnauthorized {
+				t.Errorf("\t\tShould receive a %d status code, but got %v. %v", http.StatusUnauthorized, rw.Code, ballotX)
+			}
+			t.Logf("\t\tShould receive a %d status code. %v", http.StatusUnauthorized, checkMark)
+		}
+	}
+}
+
+// mockDatabase points database.DB at a mock for the rest of the test.
+func mockDatabase(t *testing.T) sqlmock.Sqlmock {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("Should be able to open a mock database.", ballotX, err)
+	}
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal("Should be able to open a mock database.", ballotX, err)
+	}
+
+	previous := database.DB
+	database.DB = db
+
+	t.Cleanup(func() {
+		database.DB = previous
+		conn.Close()
+	})
+
+	return mock
+}
+
+func TestAuthenticateChecksSession(t *testing.T) {
+	helpers.EnvConfig.SecretKey = "test-secret"
+	denylist.Default = denylist.NewMemoryStore()
+
+	const userID = 7
+
+	// the user has logged in twice, and has revoked the first login from the second.
+	active := map[uint]bool{1: false, 2: true}
+
+	tests := []struct {
+		name       string
+		session    uint
+		statusCode int
+	}{
+		{"a token of the revoked session", 1, http.StatusUnauthorized},
+		{"a token of the other session", 2, http.StatusOK},
+		{"a token issued without a session", 0, http.StatusOK},
+	}
+
+	handler := Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Log("Given the need to test ending sessions from another device.")
+	{
+		for _, tt := range tests {
+			t.Logf("\tWhen checking %s.", tt.name)
+			{
+				mock := mockDatabase(t)
+
+				mock.ExpectQuery(`SELECT \* FROM "users"`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "token_version"}).AddRow(userID, "Adedunmola", 0))
+				mock.ExpectQuery(`SELECT \* FROM "user_roles"`).
+					WillReturnRows(sqlmock.NewRows([]string{"user_id", "role_id"}))
+
+				if tt.session != 0 {
+					count := 0
+
+					if active[tt.session] {
+						count = 1
+					}
+
+					mock.ExpectQuery(`SELECT count\(\*\) FROM "sessions"`).
+						WithArgs(tt.session, userID).
+						WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+				}
+
+				token, _, err := helpers.GenerateToken("Adedunmola", 0, helpers.ACCESS_TOKEN_EXPIRATION, helpers.WithSession(tt.session))
+				if err != nil {
+					t.Fatal("\t\tShould be able to generate an access token.", ballotX, err)
+				}
+
+				req := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+				req.Header.Set("Authorization", "Bearer "+token)
+
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, req)
+
+				if rw.Code != tt.statusCode {
+					t.Errorf("\t\tShould receive a %d status code, but got %v. %v", tt.statusCode, rw.Code, ballotX)
+				}
+				t.Logf("\t\tShould receive a %d status code. %v", tt.statusCode, checkMark)
+
+				if err := mock.ExpectationsWereMet(); err != nil {
+					t.Errorf("\t\tShould only check the session the token belongs to: %v %v", err, ballotX)
+				}
+				t.Log("\t\tShould only check the session the token belongs to.", checkMark)
+			}
+		}
+	}
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	verifiedAt := time.Now()
+
+	tests := []struct {
+		name       string
+		user       *models.User
+		statusCode int
+	}{
+		{"an unverified user", &models.User{}, http.StatusForbidden},
+		{"a verified user", &models.User{EmailVerifiedAt: &verifiedAt}, http.StatusOK},
+	}
+
+	handler := RequireVerifiedEmail(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Log("Given the need to test requiring a verified email.")
+	{
+		for _, tt := range tests {
+			t.Logf("\tWhen checking %s.", tt.name)
+			{
+				req := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+				req = req.WithContext(WithPrincipal(req.Context(), &Principal{User: tt.user}))
+
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, req)
+
+				if rw.Code != tt.statusCode {
+					t.Errorf("\t\tShould receive a %d status code, but got %v. %v", tt.statusCode, rw.Code, ballotX)
+				}
+				t.Logf("\t\tShould receive a %d status code. %v", tt.statusCode, checkMark)
+			}
+		}
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	admin := &models.User{Roles: []models.Role{{
+		Name:        models.AdminRole,
+		Permissions: []models.Permission{{Name: models.UsersReadPermission}, {Name: models.RolesWritePermission}},
+	}}}
+
+	tests := []struct {
+		name       string
+		user       *models.User
+		statusCode int
+	}{
+		{"a user without roles", &models.User{}, http.StatusForbidden},
+		{"a user with a role lacking the permission", &models.User{Roles: []models.Role{{Name: models.UserRole}}}, http.StatusForbidden},
+		{"a user with a role granting the permission", admin, http.StatusOK},
+	}
+
+	handler := RequirePermission(models.UsersReadPermission)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Log("Given the need to test requiring permissions.")
+	{
+		for _, tt := range tests {
+			t.Logf("\tWhen checking %s.", tt.name)
+			{
+				req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+				req = req.WithContext(WithPrincipal(req.Context(), &Principal{User: tt.user}))
+
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, req)
+
+				if rw.Code != tt.statusCode {
+					t.Errorf("\t\tShould receive a %d status code, but got %v. %v", tt.statusCode, rw.Code, ballotX)
+				}
+				t.Logf("\t\tShould receive a %d status code. %v", tt.statusCode, checkMark)
+			}
+		}
+
+		t.Log("\tWhen checking a request without a principal.")
+		{
+			req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != http.StatusUnauthorized {
+				t.Errorf("\t\tShould receive a %d status code, but got %v. %v", http.StatusUnauthorized, rw.Code, ballotX)
+			}
+			t.Logf("\t\tShould receive a %d status code. %v", http.StatusUnauthorized, checkMark)
+		}
+
+		t.Log("\tWhen requiring several permissions.")
+		{
+			handler := RequirePermission(models.UsersReadPermission, models.UsersWritePermission)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+			req = req.WithContext(WithPrincipal(req.Context(), &Principal{User: admin}))
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != http.StatusForbidden {
+				t.Errorf("\t\tShould need all of them, but got %v. %v", rw.Code, ballotX)
+			}
+			t.Log("\t\tShould need all of them.", checkMark)
+		}
+	}
+}
+
+func TestRequirePermissionWithAPIKey(t *testing.T) {
+	admin := &models.User{Roles: []models.Role{{
+		Name:        models.AdminRole,
+		Permissions: []models.Permission{{Name: models.UsersReadPermission}},
+	}}}
+
+	tests := []struct {
+		name       string
+		scopes     models.Scopes
+		statusCode int
+	}{
+		{"a key without the permission as a scope", models.Scopes{models.ReadScope}, http.StatusForbidden},
+		{"a key with the permission as a scope", models.Scopes{models.ReadScope, models.UsersReadPermission}, http.StatusOK},
+	}
+
+	handler := RequirePermission(models.UsersReadPermission)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Log("Given the need to test requiring permissions of API keys.")
+	{
+		for _, tt := range tests {
+			t.Logf("\tWhen checking %s.", tt.name)
+			{
+				req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+				req = req.WithContext(WithPrincipal(req.Context(), &Principal{User: admin, APIKey: &models.APIKey{Scopes: tt.scopes}}))
+
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, req)
+
+				if rw.Code != tt.statusCode {
+					t.Errorf("\t\tShould receive a %d status code, but got %v. %v", tt.statusCode, rw.Code, ballotX)
+				}
+				t.Logf("\t\tShould receive a %d status code. %v", tt.statusCode, checkMark)
+			}
+		}
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		principal  *Principal
+		statusCode int
+	}{
+		{"a request without a principal", nil, http.StatusUnauthorized},
+		{"a request made with an API key", &Principal{User: &models.User{}, APIKey: &models.APIKey{}}, http.StatusForbidden},
+		{"a request made by a service", &Principal{Client: &models.Client{}, Claims: &helpers.Claims{}}, http.StatusForbidden},
+		{"a request made with a session", &Principal{User: &models.User{}}, http.StatusOK},
+	}
+
+	handler := RequireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Log("Given the need to test requiring a session.")
+	{
+		for _, tt := range tests {
+			t.Logf("\tWhen checking %s.", tt.name)
+			{
+				req := httptest.NewRequest(http.MethodGet, "/users/me/sessions", nil)
+				if tt.principal != nil {
+					req = req.WithContext(WithPrincipal(req.Context(), tt.principal))
+				}
+
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, req)
+
+				if rw.Code != tt.statusCode {
+					t.Errorf("\t\tShould receive a %d status code, but got %v. %v", tt.statusCode, rw.Code, ballotX)
+				}
+				t.Logf("\t\tShould receive a %d status code. %v", tt.statusCode, checkMark)
+			}
+		}
+	}
+}
+
+func TestRequirePermissionForServices(t *testing.T) {
+	client := &models.Client{Scopes: models.Scopes{models.UsersReadPermission}}
+
+	tests := []struct {
+		name       string
+		client     *models.Client
+		scope      string
+		statusCode int
+	}{
+		{"a token without the permission as a scope", client, models.RolesReadPermission, http.StatusForbidden},
+		{"a token whose client lost the permission", &models.Client{}, models.UsersReadPermission, http.StatusForbidden},
+		{"a token with the permission as a scope", client, models.UsersReadPermission + " " + models.RolesReadPermission, http.StatusOK},
+	}
+
+	handler := RequirePermission(models.UsersReadPermission)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Log("Given the need to test requiring permissions of services.")
+	{
+		for _, tt := range tests {
+			t.Logf("\tWhen checking %s.", tt.name)
+			{
+				req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+				req = req.WithContext(WithPrincipal(req.Context(), &Principal{Client: tt.client, Claims: &helpers.Claims{Type: helpers.ServiceTokenType, Scope: tt.scope}}))
+
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, req)
+
+				if rw.Code != tt.statusCode {
+					t.Errorf("\t\tShould receive a %d status code, but got %v. %v", tt.statusCode, rw.Code, ballotX)
+				}
+				t.Logf("\t\tShould receive a %d status code. %v", tt.statusCode, checkMark)
+			}
+		}
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	tests := []struct {
+		name       string
+		principal  *Principal
+		statusCode int
+	}{
+		{"a request without a principal", nil, http.StatusUnauthorized},
+		{"a request made by a service", &Principal{Client: &models.Client{}, Claims: &helpers.Claims{}}, http.StatusForbidden},
+		{"a request made with an API key", &Principal{User: &models.User{}, APIKey: &models.APIKey{}}, http.StatusOK},
+		{"a request made by a user", &Principal{User: &models.User{}}, http.StatusOK},
+	}
+
+	handler := RequireUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Log("Given the need to test requiring a user.")
+	{
+		for _, tt := range tests {
+			t.Logf("\tWhen checking %s.", tt.name)
+			{
+				req := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+				if tt.principal != nil {
+					req = req.WithContext(WithPrincipal(req.Context(), tt.principal))
+				}
+
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, req)
+
+				if rw.Code != tt.statusCode {
+					t.Errorf("\t\tShould receive a %d status code, but got %v. %v", tt.statusCode, rw.Code, ballotX)
+				}
+				t.Logf("\t\tShould receive a %d status code. %v", tt.statusCode, checkMark)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/tenant"
+	"gorm.io/gorm"
+)
+
+// RequireOrganization only lets through users acting in an organization they are
+// still a member of. It puts the membership on the principal and scopes the request
+// context to the organization, so that tenant-owned tables queried with it only
+// return that organization's rows. It has to run after Authenticate.
+func RequireOrganization(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := GetPrincipal(r.Context())
+
+		if !ok {
+			unauthorized(w, "authentication required")
+			return
+		}
+
+		if principal.Membership == nil {
+			if principal.Claims == nil || principal.Claims.Organization == 0 {
+				helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "no organization selected", Data: nil, Status: "error"})
+				return
+			}
+
+			var membership models.Membership
+
+			result := database.DB.Preload("Organization").
+				Where("organization_id = ? AND user_id = ?", principal.Claims.Organization, principal.User.ID).
+				First(&membership)
+
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "not a member of this organization", Data: nil, Status: "error"})
+				return
+			}
+
+			if result.Error != nil {
+				helpers.Error.Println(result.Error)
+				helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to load membership", Data: nil, Status: "error"})
+				return
+			}
+
+			principal = &Principal{User: principal.User, Claims: principal.Claims, Membership: &membership, APIKey: principal.APIKey}
+		}
+
+		ctx := WithPrincipal(r.Context(), principal)
+		ctx = tenant.WithOrganization(ctx, principal.Membership.OrganizationID)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireOrganizationRole only lets through members holding one of roles in the
+// active organization. It has to run after RequireOrganization.
+func RequireOrganizationRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := GetPrincipal(r.Context())
+
+			if !ok {
+				unauthorized(w, "authentication required")
+				return
+			}
+
+			if principal.Membership == nil {
+				helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "no organization selected", Data: nil, Status: "error"})
+				return
+			}
+
+			for _, role := range roles {
+				if principal.Membership.Role == role {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "insufficient permissions", Data: nil, Status: "error"})
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/Adedunmol/zephyr/pkg/tenant"
+)
+
+func TestRequireOrganization(t *testing.T) {
+	user := &models.User{Username: "Adedunmola"}
+
+	t.Log("Given the need to test requiring an active organization.")
+	{
+		t.Log("\tWhen the token is not scoped to an organization.")
+		{
+			handler := RequireOrganization(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("\t\tShould not reach the protected handler.", ballotX)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/orgs/current", nil)
+			req = req.WithContext(WithPrincipal(req.Context(), &Principal{User: user, Claims: &helpers.Claims{}}))
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != http.StatusForbidden {
+				t.Errorf("\t\tShould receive a %d status code, but got %v. %v", http.StatusForbidden, rw.Code, ballotX)
+			}
+			t.Logf("\t\tShould receive a %d status code. %v", http.StatusForbidden, checkMark)
+		}
+
+		t.Log("\tWhen the member's organization is known.")
+		{
+			membership := &models.Membership{OrganizationID: 7, UserID: 1, Role: models.OrganizationMemberRole}
+
+			var organization uint
+
+			handler := RequireOrganization(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				organization, _ = tenant.FromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/orgs/current", nil)
+			req = req.WithContext(WithPrincipal(req.Context(), &Principal{User: user, Claims: &helpers.Claims{Organization: 7}, Membership: membership}))
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != http.StatusOK || organization != 7 {
+				t.Errorf("\t\tShould scope the request to the organization, but got %v %d. %v", rw.Code, organization, ballotX)
+			}
+			t.Log("\t\tShould scope the request to the organization.", checkMark)
+		}
+	}
+}
+
+func TestRequireOrganizationRole(t *testing.T) {
+	tests := []struct {
+		name       string
+		membership *models.Membership
+		statusCode int
+	}{
+		{"a request without an organization", nil, http.StatusForbidden},
+		{"a member", &models.Membership{Role: models.OrganizationMemberRole}, http.StatusForbidden},
+		{"an owner", &models.Membership{Role: models.OrganizationOwnerRole}, http.StatusOK},
+	}
+
+	handler := RequireOrganizationRole(models.OrganizationOwnerRole, models.OrganizationAdminRole)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Log("Given the need to test requiring an organization role.")
+	{
+		for _, tt := range tests {
+			t.Logf("\tWhen checking %s.", tt.name)
+			{
+				req := httptest.NewRequest(http.MethodGet, "/orgs/current/members", nil)
+				req = req.WithContext(WithPrincipal(req.Context(), &Principal{User: &models.User{}, Membership: tt.membership}))
+
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, req)
+
+				if rw.Code != tt.statusCode {
+					t.Errorf("\t\tShould receive a %d status code, but got %v. %v", tt.statusCode, rw.Code, ballotX)
+				}
+				t.Logf("\t\tShould receive a %d status code. %v", tt.statusCode, checkMark)
+			}
+		}
+	}
+}
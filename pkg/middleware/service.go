@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Adedunmol/zephyr/pkg/database"
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"gorm.io/gorm"
+)
+
+// authenticateService is Authenticate for requests presenting a service token. The
+// client is looked up again so that deleting it, or taking the grant away, cuts off
+// its tokens straight away.
+func authenticateService(w http.ResponseWriter, r *http.Request, next http.Handler, claims *helpers.Claims) {
+	if claims.ClientID == "" {
+		unauthorized(w, "Invalid token")
+		return
+	}
+
+	var client models.Client
+
+	result := database.DB.Where(models.Client{ClientID: claims.ClientID}).First(&client)
+
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		unauthorized(w, "Invalid token")
+		return
+	}
+
+	if result.Error != nil {
+		helpers.Error.Println(result.Error)
+		helpers.RespondWithJSON(w, http.StatusInternalServerError, helpers.APIResponse{Message: "unable to verify token", Data: nil, Status: "error"})
+		return
+	}
+
+	if client.Public() || !client.AllowsGrant(models.ClientCredentialsGrant) {
+		unauthorized(w, "Invalid token")
+		return
+	}
+
+	ctx := WithPrincipal(r.Context(), &Principal{Client: &client, Claims: claims})
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RequireUser only lets through users, not services. It guards the endpoints acting
+// on the caller's own account. It has to run after Authenticate.
+func RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := GetPrincipal(r.Context())
+
+		if !ok {
+			unauthorized(w, "authentication required")
+			return
+		}
+
+		if principal.Service() {
+			helpers.RespondWithJSON(w, http.StatusForbidden, helpers.APIResponse{Message: "not available to services", Data: nil, Status: "error"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
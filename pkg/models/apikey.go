@@ -0,0 +1,75 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// scopes of API keys for endpoints that need no permission. Keys can also be given
+// any permission their owner holds.
+const (
+	ReadScope  = "read"
+	WriteScope = "write"
+)
+
+// Scopes is a set of scopes, stored space-separated.
+type Scopes []string
+
+func (s Scopes) Has(scope string) bool {
+	for _, granted := range s {
+		if granted == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, " "), nil
+}
+
+func (s *Scopes) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		*s = strings.Fields(v)
+	case []byte:
+		*s = strings.Fields(string(v))
+	case nil:
+		*s = nil
+	default:
+		return fmt.Errorf("cannot scan %T into Scopes", value)
+	}
+
+	return nil
+}
+
+func (Scopes) GormDataType() string {
+	return "text"
+}
+
+// APIKey lets a machine client act as the user who created it, within its scopes.
+// Only a hash of the secret part of the key is stored.
+type APIKey struct {
+	gorm.Model
+	UserID uint `json:"-" gorm:"index"`
+	User   User `json:"-"`
+	// OrganizationID is the organization the key acts in, if any.
+	OrganizationID *uint      `json:"organization_id"`
+	Name           string     `json:"name"`
+	Prefix         string     `json:"prefix" gorm:"uniqueIndex"`
+	SecretHash     string     `json:"-"`
+	Scopes         Scopes     `json:"scopes"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	RevokedAt      *time.Time `json:"-"`
+}
+
+// Active reports whether the key can still be used.
+func (k *APIKey) Active() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || k.ExpiresAt.After(time.Now()))
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// grant types a client can be registered for.
+const (
+	AuthorizationCodeGrant = "authorization_code"
+	ClientCredentialsGrant = "client_credentials"
+)
+
+// Client is an application registered to sign its users in through us, or a backend
+// service calling the API on its own behalf. Public clients, such as single page and
+// mobile apps, can't keep a secret and have none.
+type Client struct {
+	gorm.Model
+	ClientID   string `json:"client_id" gorm:"uniqueIndex"`
+	SecretHash string `json:"-"`
+	Name       string `json:"name"`
+	// RedirectURIs are stored space-separated like scopes, which URIs can't contain.
+	RedirectURIs Scopes `json:"redirect_uris"`
+	// Scopes are the scopes the client may ask for: OpenID Connect scopes to sign
+	// users in, permissions to call the API as a service.
+	Scopes Scopes `json:"scopes"`
+	// GrantTypes are the grants the client may use at the token endpoint.
+	GrantTypes Scopes `json:"grant_types" gorm:"default:authorization_code"`
+}
+
+func (c *Client) Public() bool {
+	return c.SecretHash == ""
+}
+
+func (c *Client) AllowsGrant(grantType string) bool {
+	return c.GrantTypes.Has(grantType)
+}
+
+// AuthorizationRequest is a request of a client to sign a user in. It waits for the
+// user's consent under RequestHash, then holds the authorization code under CodeHash
+// until the client exchanges it.
+type AuthorizationRequest struct {
+	gorm.Model
+	RequestHash   string  `gorm:"uniqueIndex"`
+	CodeHash      *string `gorm:"uniqueIndex"`
+	ClientID      uint    `gorm:"index"`
+	Client        Client
+	UserID        uint `gorm:"index"`
+	User          User
+	SessionID     uint
+	RedirectURI   string
+	Scopes        Scopes
+	State         string
+	Nonce         string
+	CodeChallenge string
+	AuthTime      time.Time
+	ExpiresAt     time.Time `gorm:"index"`
+	ApprovedAt    *time.Time
+	UsedAt        *time.Time
+}
+
+// Consent remembers the scopes a user granted to a client, so that they aren't asked
+// again every time.
+type Consent struct {
+	gorm.Model
+	UserID   uint   `json:"-" gorm:"uniqueIndex:idx_consent_user_client"`
+	ClientID uint   `json:"-" gorm:"uniqueIndex:idx_consent_user_client"`
+	Client   Client `json:"client"`
+	Scopes   Scopes `json:"scopes"`
+}
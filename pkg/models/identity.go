@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LinkedIdentity is an account at an OAuth provider the user can sign in with.
+// Subject is the provider's ID for the account, which unlike the email never changes.
+type LinkedIdentity struct {
+	gorm.Model
+	UserID      uint       `json:"-" gorm:"index"`
+	User        User       `json:"-"`
+	Provider    string     `json:"provider" gorm:"uniqueIndex:idx_linked_identity_subject"`
+	Subject     string     `json:"-" gorm:"uniqueIndex:idx_linked_identity_subject"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
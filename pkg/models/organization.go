@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/tenant"
+	"gorm.io/gorm"
+)
+
+// roles a user can have within an organization.
+const (
+	OrganizationOwnerRole  = "owner"
+	OrganizationAdminRole  = "admin"
+	OrganizationMemberRole = "member"
+)
+
+type Organization struct {
+	gorm.Model
+	Name string `json:"name"`
+	Slug string `json:"slug" gorm:"uniqueIndex"`
+}
+
+// Membership links a user to an organization with a role in that organization.
+type Membership struct {
+	gorm.Model
+	OrganizationID uint          `json:"organization_id" gorm:"uniqueIndex:idx_membership"`
+	Organization   *Organization `json:"organization,omitempty"`
+	UserID         uint          `json:"user_id" gorm:"uniqueIndex:idx_membership"`
+	User           *User         `json:"user,omitempty"`
+	Role           string        `json:"role"`
+}
+
+// Invitation asks someone to join an organization with the given role. Only the hash
+// of the token sent by email is stored.
+type Invitation struct {
+	gorm.Model
+	tenant.Owned
+	Organization *Organization `json:"organization,omitempty"`
+	Email        string        `json:"email" gorm:"index"`
+	Role         string        `json:"role"`
+	TokenHash    string        `json:"-" gorm:"uniqueIndex"`
+	InvitedByID  uint          `json:"invited_by_id"`
+	InvitedBy    *User         `json:"invited_by,omitempty"`
+	ExpiresAt    time.Time     `json:"expires_at"`
+	AcceptedAt   *time.Time    `json:"accepted_at"`
+	DeclinedAt   *time.Time    `json:"declined_at"`
+	RevokedAt    *time.Time    `json:"revoked_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// RateLimitCounter counts the requests made under Key in the window starting at
+// WindowStart. Counters are dropped once they no longer affect any window.
+type RateLimitCounter struct {
+	Key         string    `gorm:"primaryKey"`
+	WindowStart time.Time `gorm:"primaryKey"`
+	Count       int64     `gorm:"not null;default:0"`
+	ExpiresAt   time.Time `gorm:"index"`
+}
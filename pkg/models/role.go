@@ -0,0 +1,59 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+const (
+	AdminRole = "admin"
+	UserRole  = "user"
+)
+
+const (
+	UsersReadPermission    = "users:read"
+	UsersWritePermission   = "users:write"
+	RolesReadPermission    = "roles:read"
+	RolesWritePermission   = "roles:write"
+	ClientsReadPermission  = "clients:read"
+	ClientsWritePermission = "clients:write"
+)
+
+// Permission is a single action, named "<resource>:<action>".
+type Permission struct {
+	gorm.Model
+	Name        string `json:"name" gorm:"uniqueIndex"`
+	Description string `json:"description"`
+}
+
+type Role struct {
+	gorm.Model
+	Name        string       `json:"name" gorm:"uniqueIndex"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions,omitempty" gorm:"many2many:role_permissions"`
+}
+
+// HasPermission reports whether any of the user's roles grants permission. The
+// roles and their permissions have to be preloaded.
+func (u *User) HasPermission(permission string) bool {
+	for _, role := range u.Roles {
+		for _, p := range role.Permissions {
+			if p.Name == permission {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// HasRole reports whether the user has been given the role. The roles have to be
+// preloaded.
+func (u *User) HasRole(name string) bool {
+	for _, role := range u.Roles {
+		if role.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"github.com/Adedunmol/zephyr/pkg/tenant"
+	"gorm.io/gorm"
+)
+
+// SAMLProvider is the identity provider the members of an organization sign in with.
+// The attributes name the assertion attributes users are provisioned from, empty ones
+// meaning the defaults. Only emails at the verified Domains are accepted from it.
+type SAMLProvider struct {
+	gorm.Model
+	tenant.Owned
+	Organization       *Organization `json:"organization,omitempty"`
+	EntityID           string        `json:"entity_id"`
+	SSOURL             string        `json:"sso_url"`
+	Certificate        string        `json:"certificate"`
+	Domains            Scopes        `json:"domains"`
+	EmailAttribute     string        `json:"email_attribute"`
+	UsernameAttribute  string        `json:"username_attribute"`
+	FirstNameAttribute string        `json:"first_name_attribute"`
+	LastNameAttribute  string        `json:"last_name_attribute"`
+	// DefaultRole is the role in the organization of users signing in for the first
+	// time.
+	DefaultRole string `json:"default_role"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session is a login on one device. It lives as long as its refresh token family:
+// rotating the refresh token keeps the session, revoking the family ends it.
+type Session struct {
+	gorm.Model
+	UserID     uint       `json:"-" gorm:"index"`
+	User       User       `json:"-"`
+	Family     string     `json:"-" gorm:"uniqueIndex"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	// Current marks the session the request was made with.
+	Current bool `json:"current" gorm:"-"`
+}
+
+// SessionActive reports whether the session with id, belonging to userID, has not been
+// ended. Tokens tied to a session are only good while it is.
+func SessionActive(db *gorm.DB, id, userID uint) (bool, error) {
+	var active int64
+
+	result := db.Model(&Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Count(&active)
+
+	return active != 0, result.Error
+}
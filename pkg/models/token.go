@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken tracks an issued refresh token. Tokens rotated from the same login
+// share a Family so that the whole chain can be revoked when an old one is replayed.
+type RefreshToken struct {
+	gorm.Model
+	UserID    uint       `json:"user_id" gorm:"index"`
+	User      User       `json:"-"`
+	TokenID   string     `json:"-" gorm:"uniqueIndex"`
+	Family    string     `json:"-" gorm:"index"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+const (
+	PasswordResetPurpose     = "password_reset"
+	EmailVerificationPurpose = "email_verification"
+	MagicLinkPurpose         = "magic_link"
+	SAMLLinkPurpose          = "saml_link"
+)
+
+// UserToken is a single-use token sent to a user out of band. Only the hash of the
+// token is stored.
+type UserToken struct {
+	gorm.Model
+	UserID    uint       `json:"user_id" gorm:"index"`
+	User      User       `json:"-"`
+	Purpose   string     `json:"purpose" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// RevokedToken is a denylisted access token ID, kept until the token would have
+// expired anyway.
+type RevokedToken struct {
+	TokenID   string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
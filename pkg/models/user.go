@@ -1,12 +1,28 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Username  string `json:"username" gorm:"unique"`
-	Password  string `json:"password"`
-	Email     string `json:"email" gorm:"unique"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Username        string     `json:"username" gorm:"unique"`
+	Password        string     `json:"-"`
+	Email           string     `json:"email" gorm:"unique"`
+	TokenVersion    uint       `json:"-" gorm:"not null;default:0"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	TOTPSecret      string     `json:"-"`
+	TOTPEnabledAt   *time.Time `json:"totp_enabled_at"`
+	TOTPLastStep    int64      `json:"-"`
+	FailedLogins    int        `json:"-" gorm:"not null;default:0"`
+	LockedUntil     *time.Time `json:"locked_until"`
+	Roles           []Role     `json:"roles,omitempty" gorm:"many2many:user_roles"`
+}
+
+func (u *User) MFAEnabled() bool {
+	return u.TOTPEnabledAt != nil
 }
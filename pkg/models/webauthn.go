@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Credential is a WebAuthn credential (passkey or security key) registered by a user.
+type Credential struct {
+	gorm.Model
+	UserID       uint       `json:"-" gorm:"index"`
+	User         User       `json:"-"`
+	CredentialID []byte     `json:"-" gorm:"uniqueIndex"`
+	PublicKey    []byte     `json:"-"`
+	SignCount    uint32     `json:"-"`
+	Name         string     `json:"name"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+}
+
+const (
+	WebAuthnRegistrationPurpose = "webauthn_registration"
+	WebAuthnLoginPurpose        = "webauthn_login"
+	WebAuthnMFAPurpose          = "webauthn_mfa"
+)
+
+// WebAuthnSession holds the challenge issued for a ceremony until the browser
+// answers it. UserID is nil for passwordless logins, where the user is only known
+// once the credential has been picked.
+type WebAuthnSession struct {
+	gorm.Model
+	SessionID string `gorm:"uniqueIndex"`
+	UserID    *uint  `gorm:"index"`
+	Purpose   string `gorm:"index"`
+	Challenge []byte
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+}
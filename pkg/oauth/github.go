@@ -0,0 +1,82 @@
+package oauth
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+var GitHubEndpoint = Endpoint{
+	AuthURL:  "https://github.com/login/oauth/authorize",
+	TokenURL: "https://github.com/login/oauth/access_token",
+}
+
+const GitHubAPIURL = "https://api.github.com"
+
+type GitHub struct {
+	Config
+	APIURL string
+}
+
+func NewGitHub(clientID, clientSecret string) *GitHub {
+	return &GitHub{
+		Config: Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     GitHubEndpoint,
+			Scopes:       []string{"read:user", "user:email"},
+		},
+		APIURL: GitHubAPIURL,
+	}
+}
+
+func (g *GitHub) Name() string {
+	return "github"
+}
+
+type githubUser struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+	Name  string `json:"name"`
+}
+
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// Profile fetches the user and their primary email. The email on the user itself
+// is whichever one they chose to make public, and says nothing about verification.
+func (g *GitHub) Profile(ctx context.Context, token *Token) (*Profile, error) {
+	apiURL := strings.TrimRight(g.APIURL, "/")
+
+	var user githubUser
+
+	if err := g.getJSON(ctx, token, apiURL+"/user", &user); err != nil {
+		return nil, err
+	}
+
+	if user.ID == 0 {
+		return nil, ErrProfileResponse
+	}
+
+	var emails []githubEmail
+
+	if err := g.getJSON(ctx, token, apiURL+"/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	profile := &Profile{Subject: strconv.FormatInt(user.ID, 10), Username: user.Login}
+	profile.FirstName, profile.LastName = splitName(user.Name)
+
+	for _, email := range emails {
+		if email.Primary {
+			profile.Email = email.Email
+			profile.EmailVerified = email.Verified
+			break
+		}
+	}
+
+	return profile, nil
+}
@@ -0,0 +1,65 @@
+package oauth
+
+import (
+	"context"
+	"strings"
+)
+
+var GoogleEndpoint = Endpoint{
+	AuthURL:  "https://accounts.google.com/o/oauth2/v2/auth",
+	TokenURL: "https://oauth2.googleapis.com/token",
+}
+
+const GoogleUserInfoURL = "https://openidconnect.googleapis.com/v1/userinfo"
+
+type Google struct {
+	Config
+	UserInfoURL string
+}
+
+func NewGoogle(clientID, clientSecret string) *Google {
+	return &Google{
+		Config: Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     GoogleEndpoint,
+			Scopes:       []string{"openid", "email", "profile"},
+		},
+		UserInfoURL: GoogleUserInfoURL,
+	}
+}
+
+func (g *Google) Name() string {
+	return "google"
+}
+
+type googleUserInfo struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+}
+
+func (g *Google) Profile(ctx context.Context, token *Token) (*Profile, error) {
+	var info googleUserInfo
+
+	if err := g.getJSON(ctx, token, g.UserInfoURL, &info); err != nil {
+		return nil, err
+	}
+
+	if info.Subject == "" {
+		return nil, ErrProfileResponse
+	}
+
+	username, _, _ := strings.Cut(info.Email, "@")
+
+	return &Profile{
+		Subject:       info.Subject,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+		Username:      username,
+		FirstName:     info.GivenName,
+		LastName:      info.FamilyName,
+	}, nil
+}
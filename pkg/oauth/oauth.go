@@ -0,0 +1,244 @@
+// Package oauth implements the client side of the OAuth 2.0 authorization code flow
+// with PKCE (RFC 7636), used to sign users in with third-party accounts.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTokenResponse   = errors.New("invalid token response")
+	ErrProfileResponse = errors.New("invalid profile response")
+)
+
+// Error is an error response of the authorization server.
+type Error struct {
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return "oauth: " + e.Code
+	}
+
+	return "oauth: " + e.Code + ": " + e.Description
+}
+
+// Token is the result of exchanging an authorization code.
+type Token struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	Expiry       time.Time
+}
+
+// Profile is what we learn about the user from the provider. Subject identifies the
+// account at the provider and never changes, unlike the email address.
+type Profile struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	FirstName     string
+	LastName      string
+}
+
+// Provider is an identity provider users can sign in with.
+type Provider interface {
+	// Name identifies the provider in routes and linked identities, e.g. "github".
+	Name() string
+	// AuthCodeURL is where the user is sent to approve the login.
+	AuthCodeURL(state, challenge, redirectURI string) string
+	// Exchange trades the code the user came back with for a token.
+	Exchange(ctx context.Context, code, verifier, redirectURI string) (*Token, error)
+	// Profile fetches the user the token was issued for.
+	Profile(ctx context.Context, token *Token) (*Profile, error)
+}
+
+var providers = map[string]Provider{}
+
+// Register makes provider available for logins. It is meant to be called on
+// startup, for each configured provider.
+func Register(provider Provider) {
+	providers[provider.Name()] = provider
+}
+
+// Lookup returns the registered provider called name.
+func Lookup(name string) (Provider, bool) {
+	provider, ok := providers[name]
+
+	return provider, ok
+}
+
+// Endpoint holds the URLs of an authorization server.
+type Endpoint struct {
+	AuthURL  string
+	TokenURL string
+}
+
+// Config is the part of a Provider shared by every authorization server: building
+// the authorization URL and exchanging the code.
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	Endpoint     Endpoint
+	Scopes       []string
+	// Client makes the requests to the provider, a client with a 10 second timeout
+	// is used when it is nil.
+	Client *http.Client
+}
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+func (c *Config) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+
+	return defaultClient
+}
+
+func (c *Config) AuthCodeURL(state, challenge, redirectURI string) string {
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.ClientID},
+		"redirect_uri":          {redirectURI},
+		"state":                 {state},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	if len(c.Scopes) != 0 {
+		params.Set("scope", strings.Join(c.Scopes, " "))
+	}
+
+	separator := "?"
+	if strings.Contains(c.Endpoint.AuthURL, "?") {
+		separator = "&"
+	}
+
+	return c.Endpoint.AuthURL + separator + params.Encode()
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (c *Config) Exchange(ctx context.Context, code, verifier, redirectURI string) (*Token, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+		"client_id":     {c.ClientID},
+		"client_secret": {c.ClientSecret},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// GitHub answers with a form encoded body unless asked otherwise.
+	req.Header.Set("Accept", "application/json")
+
+	res, err := c.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var body tokenResponse
+
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenResponse, err)
+	}
+
+	// some servers report errors with a 200 status, so the body is checked first.
+	if body.Error != "" {
+		return nil, &Error{Code: body.Error, Description: body.ErrorDescription}
+	}
+
+	if res.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return nil, fmt.Errorf("%w: status %d", ErrTokenResponse, res.StatusCode)
+	}
+
+	token := &Token{AccessToken: body.AccessToken, TokenType: body.TokenType, RefreshToken: body.RefreshToken}
+
+	if body.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
+
+// getJSON fetches url with token and decodes the JSON response into v.
+func (c *Config) getJSON(ctx context.Context, token *Token, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/json")
+
+	res, err := c.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: status %d from %s", ErrProfileResponse, res.StatusCode, url)
+	}
+
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrProfileResponse, err)
+	}
+
+	return nil
+}
+
+// GenerateVerifier returns a new PKCE code verifier.
+func GenerateVerifier() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// S256Challenge returns the code challenge sent in place of verifier.
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// splitName splits a display name into first and last names, as well as a single
+// field can be split.
+func splitName(name string) (first, last string) {
+	first, last, _ = strings.Cut(strings.TrimSpace(name), " ")
+
+	return first, strings.TrimSpace(last)
+}
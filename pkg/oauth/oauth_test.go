@@ -0,0 +1,235 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+const checkMark = "\u2713"
+const ballotX = "\u2717"
+
+// fakeServer is an authorization server that approves every authorization request
+// and serves the GitHub and Google profile endpoints.
+type fakeServer struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	codes map[string]url.Values
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	s := &fakeServer{codes: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+
+		s.mu.Lock()
+		s.codes["code-"+params.Get("state")] = params
+		s.mu.Unlock()
+
+		redirect := params.Get("redirect_uri") + "?" + url.Values{"code": {"code-" + params.Get("state")}, "state": {params.Get("state")}}.Encode()
+		http.Redirect(w, r, redirect, http.StatusFound)
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		s.mu.Lock()
+		params, ok := s.codes[r.PostForm.Get("code")]
+		delete(s.codes, r.PostForm.Get("code"))
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.PostForm.Get("client_id") != "client" || r.PostForm.Get("client_secret") != "secret":
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		case !ok || r.PostForm.Get("redirect_uri") != params.Get("redirect_uri"):
+			// GitHub reports a bad code with a 200 status.
+			json.NewEncoder(w).Encode(map[string]string{"error": "bad_verification_code", "error_description": "The code passed is incorrect or expired."})
+		case S256Challenge(r.PostForm.Get("code_verifier")) != params.Get("code_challenge"):
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access-token", "token_type": "bearer", "expires_in": 3600})
+		}
+	})
+
+	profile := func(body interface{}) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer access-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			json.NewEncoder(w).Encode(body)
+		}
+	}
+
+	mux.HandleFunc("/user", profile(map[string]interface{}{"id": 42, "login": "ada", "name": "Ada Lovelace", "email": "public@example.com"}))
+	mux.HandleFunc("/user/emails", profile([]map[string]interface{}{
+		{"email": "old@example.com", "primary": false, "verified": true},
+		{"email": "ada@example.com", "primary": true, "verified": true},
+	}))
+	mux.HandleFunc("/userinfo", profile(map[string]interface{}{"sub": "1098", "email": "ada@example.com", "email_verified": true, "given_name": "Ada", "family_name": "Lovelace"}))
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// authorize follows the authorization URL like a browser would, up to the redirect
+// back to us, and returns the code and state it carries.
+func authorize(t *testing.T, authURL string) (code, state string) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal("\t\tShould be able to authorize.", ballotX, err)
+	}
+	res.Body.Close()
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal("\t\tShould be redirected back.", ballotX, err)
+	}
+
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeServer(t)
+
+	const redirectURI = "https://zephyr.example.com/users/oauth/github/callback"
+
+	github := NewGitHub("client", "secret")
+	github.Endpoint = Endpoint{AuthURL: server.URL + "/authorize", TokenURL: server.URL + "/token"}
+	github.APIURL = server.URL
+	github.Client = server.Client()
+
+	google := NewGoogle("client", "secret")
+	google.Endpoint = github.Endpoint
+	google.UserInfoURL = server.URL + "/userinfo"
+	google.Client = server.Client()
+
+	t.Log("Given the need to test signing in with a provider.")
+	{
+		for _, tt := range []struct {
+			provider Provider
+			subject  string
+		}{
+			{github, "42"},
+			{google, "1098"},
+		} {
+			t.Logf("\tWhen signing in with %s.", tt.provider.Name())
+			{
+				verifier, err := GenerateVerifier()
+				if err != nil {
+					t.Fatal("\t\tShould be able to generate a verifier.", ballotX, err)
+				}
+
+				code, state := authorize(t, tt.provider.AuthCodeURL("state-"+tt.provider.Name(), S256Challenge(verifier), redirectURI))
+
+				if state != "state-"+tt.provider.Name() {
+					t.Errorf("\t\tShould get the state back, but got %q. %v", state, ballotX)
+				}
+				t.Log("\t\tShould get the state back.", checkMark)
+
+				token, err := tt.provider.Exchange(ctx, code, verifier, redirectURI)
+
+				if err != nil || token.AccessToken != "access-token" || token.Expiry.IsZero() {
+					t.Fatalf("\t\tShould exchange the code for a token, but got %+v and %v. %v", token, err, ballotX)
+				}
+				t.Log("\t\tShould exchange the code for a token.", checkMark)
+
+				profile, err := tt.provider.Profile(ctx, token)
+
+				if err != nil {
+					t.Fatal("\t\tShould fetch the profile.", ballotX, err)
+				}
+				t.Log("\t\tShould fetch the profile.", checkMark)
+
+				if profile.Subject != tt.subject || profile.Email != "ada@example.com" || !profile.EmailVerified || profile.FirstName != "Ada" || profile.LastName != "Lovelace" {
+					t.Errorf("\t\tShould read the user from the profile, but got %+v. %v", profile, ballotX)
+				}
+				t.Log("\t\tShould read the user from the profile.", checkMark)
+			}
+		}
+
+		t.Log("\tWhen exchanging with the wrong verifier.")
+		{
+			verifier, _ := GenerateVerifier()
+			code, _ := authorize(t, github.AuthCodeURL("wrong-verifier", S256Challenge(verifier), redirectURI))
+
+			other, _ := GenerateVerifier()
+
+			var oauthErr *Error
+
+			if _, err := github.Exchange(ctx, code, other, redirectURI); !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_grant" {
+				t.Errorf("\t\tShould be refused, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould be refused.", checkMark)
+		}
+
+		t.Log("\tWhen exchanging a code twice.")
+		{
+			verifier, _ := GenerateVerifier()
+			code, _ := authorize(t, github.AuthCodeURL("reused", S256Challenge(verifier), redirectURI))
+
+			github.Exchange(ctx, code, verifier, redirectURI)
+
+			var oauthErr *Error
+
+			if _, err := github.Exchange(ctx, code, verifier, redirectURI); !errors.As(err, &oauthErr) || oauthErr.Code != "bad_verification_code" {
+				t.Errorf("\t\tShould report the error sent with a 200 status, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould report the error sent with a 200 status.", checkMark)
+		}
+
+		t.Log("\tWhen the client credentials are wrong.")
+		{
+			wrong := *github
+			wrong.ClientSecret = "wrong"
+
+			verifier, _ := GenerateVerifier()
+			code, _ := authorize(t, wrong.AuthCodeURL("wrong-secret", S256Challenge(verifier), redirectURI))
+
+			if _, err := wrong.Exchange(ctx, code, verifier, redirectURI); err == nil {
+				t.Error("\t\tShould be refused.", ballotX)
+			}
+			t.Log("\t\tShould be refused.", checkMark)
+		}
+
+		t.Log("\tWhen the token is not accepted by the profile endpoints.")
+		{
+			if _, err := github.Profile(ctx, &Token{AccessToken: "stolen"}); !errors.Is(err, ErrProfileResponse) {
+				t.Errorf("\t\tShould fail to fetch the profile, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould fail to fetch the profile.", checkMark)
+		}
+	}
+}
+
+func TestS256Challenge(t *testing.T) {
+	t.Log("Given the need to test PKCE challenges.")
+	{
+		t.Log("\tWhen deriving the challenge of the RFC 7636 example verifier.")
+		{
+			if challenge := S256Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); challenge != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+				t.Errorf("\t\tShould match the RFC, but got %q. %v", challenge, ballotX)
+			}
+			t.Log("\t\tShould match the RFC.", checkMark)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package oidc
+
+import (
+	"embed"
+	"html/template"
+	"io"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var consentTemplate = template.Must(template.ParseFS(templateFS, "templates/consent.html"))
+
+// Consent is what the consent screen shows. RequestID identifies the pending
+// authorization request the user decides on.
+type Consent struct {
+	Name       string
+	ClientName string
+	Scopes     []string
+	RequestID  string
+	Action     string
+}
+
+// NewConsent describes scopes in words the user can decide on.
+func NewConsent(name, clientName string, scopes []string, requestID, action string) Consent {
+	consent := Consent{Name: name, ClientName: clientName, RequestID: requestID, Action: action}
+
+	for _, scope := range scopes {
+		if description, ok := ScopeDescriptions[scope]; ok {
+			consent.Scopes = append(consent.Scopes, description)
+		}
+	}
+
+	return consent
+}
+
+func RenderConsent(w io.Writer, consent Consent) error {
+	return consentTemplate.Execute(w, consent)
+}
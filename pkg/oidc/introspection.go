@@ -0,0 +1,30 @@
+package oidc
+
+import (
+	"time"
+)
+
+// Introspection is the response of the introspection endpoint, described in RFC 7662
+// section 2.2. Tokens that aren't active get nothing but active=false, so that
+// nothing is given away about tokens that were revoked, expired or never issued.
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Expiry    int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	TokenID   string `json:"jti,omitempty"`
+}
+
+// SetTimes sets exp and iat, leaving exp out for tokens that don't expire.
+func (i *Introspection) SetTimes(issuedAt time.Time, expiresAt *time.Time) {
+	i.IssuedAt = issuedAt.Unix()
+
+	if expiresAt != nil {
+		i.Expiry = expiresAt.Unix()
+	}
+}
@@ -0,0 +1,51 @@
+package oidc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestIntrospection(t *testing.T) {
+	t.Log("Given the need to test introspection responses.")
+	{
+		t.Log("\tWhen describing a token that isn't active.")
+		{
+			body, err := json.Marshal(Introspection{})
+
+			if err != nil || string(body) != `{"active":false}` {
+				t.Errorf("\t\tShould only say it isn't active, but got %s %v. %v", body, err, ballotX)
+			}
+			t.Log("\t\tShould only say it isn't active.", checkMark)
+		}
+
+		t.Log("\tWhen describing a token that doesn't expire.")
+		{
+			issuedAt := time.Unix(1700000000, 0)
+
+			introspection := Introspection{Active: true, Subject: "7"}
+			introspection.SetTimes(issuedAt, nil)
+
+			var body map[string]interface{}
+
+			raw, _ := json.Marshal(introspection)
+
+			if err := json.Unmarshal(raw, &body); err != nil {
+				t.Fatal("\t\tShould marshal the response.", ballotX, err)
+			}
+
+			if _, ok := body["exp"]; ok || body["iat"] != float64(1700000000) || body["active"] != true {
+				t.Errorf("\t\tShould leave out exp, but got %s. %v", raw, ballotX)
+			}
+			t.Log("\t\tShould leave out exp.", checkMark)
+
+			expiresAt := issuedAt.Add(time.Hour)
+			introspection.SetTimes(issuedAt, &expiresAt)
+
+			if introspection.Expiry != expiresAt.Unix() {
+				t.Errorf("\t\tShould set exp when the token expires, but got %d. %v", introspection.Expiry, ballotX)
+			}
+			t.Log("\t\tShould set exp when the token expires.", checkMark)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+// Package oidc implements the protocol side of acting as an OpenID Connect provider:
+// the discovery document, authorization request validation, PKCE and ID tokens.
+// Storing clients, codes and consents is left to the caller.
+package oidc
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+const ID_TOKEN_EXPIRATION = 1 * time.Hour
+const AUTHORIZATION_CODE_EXPIRATION = 1 * time.Minute
+
+// scopes defined by OpenID Connect.
+const (
+	OpenIDScope  = "openid"
+	ProfileScope = "profile"
+	EmailScope   = "email"
+)
+
+// ScopeDescriptions are shown on the consent screen.
+var ScopeDescriptions = map[string]string{
+	OpenIDScope:  "Sign you in with your account",
+	ProfileScope: "See your name and username",
+	EmailScope:   "See your email address",
+}
+
+var ErrNoSigningKeys = errors.New("ID tokens need asymmetric signing keys")
+
+// Error is an OAuth 2.0 error response (RFC 6749 section 4.1.2.1 and 5.2).
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// error codes of RFC 6749 and OpenID Connect.
+const (
+	InvalidRequest          = "invalid_request"
+	InvalidClient           = "invalid_client"
+	InvalidGrant            = "invalid_grant"
+	InvalidScope            = "invalid_scope"
+	UnauthorizedClient      = "unauthorized_client"
+	UnsupportedGrantType    = "unsupported_grant_type"
+	UnsupportedResponseType = "unsupported_response_type"
+	AccessDenied            = "access_denied"
+	ServerError             = "server_error"
+	ConsentRequired         = "consent_required"
+	InvalidToken            = "invalid_token"
+	InsufficientScope       = "insufficient_scope"
+)
+
+// TokenResponse is the successful response of the token endpoint.
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+	IDToken     string `json:"id_token,omitempty"`
+}
+
+// Discovery is the OpenID Provider metadata served at
+// /.well-known/openid-configuration.
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	ResponseModesSupported            []string `json:"response_modes_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	// IntrospectionEndpointAuthMethodsSupported leaves out none, since only confidential
+	// clients may introspect tokens.
+	IntrospectionEndpointAuthMethodsSupported []string `json:"introspection_endpoint_auth_methods_supported"`
+	RevocationEndpointAuthMethodsSupported    []string `json:"revocation_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported             []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                           []string `json:"claims_supported"`
+}
+
+// NewDiscovery describes the provider at issuer, signing ID tokens with algs.
+func NewDiscovery(issuer string, algs []string) Discovery {
+	issuer = strings.TrimRight(issuer, "/")
+
+	if algs == nil {
+		algs = []string{}
+	}
+
+	return Discovery{
+		Issuer:                                    issuer,
+		AuthorizationEndpoint:                     issuer + "/oauth/authorize",
+		TokenEndpoint:                             issuer + "/oauth/token",
+		UserInfoEndpoint:                          issuer + "/oauth/userinfo",
+		IntrospectionEndpoint:                     issuer + "/oauth/introspect",
+		RevocationEndpoint:                        issuer + "/oauth/revoke",
+		JWKSURI:                                   issuer + "/.well-known/jwks.json",
+		ScopesSupported:                           []string{OpenIDScope, ProfileScope, EmailScope},
+		ResponseTypesSupported:                    []string{"code"},
+		ResponseModesSupported:                    []string{"query"},
+		GrantTypesSupported:                       []string{"authorization_code", "client_credentials"},
+		SubjectTypesSupported:                     []string{"public"},
+		IDTokenSigningAlgValuesSupported:          algs,
+		TokenEndpointAuthMethodsSupported:         []string{"client_secret_basic", "client_secret_post", "none"},
+		IntrospectionEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
+		RevocationEndpointAuthMethodsSupported:    []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:             []string{"S256"},
+		ClaimsSupported:                           []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "at_hash", "azp", "name", "given_name", "family_name", "preferred_username", "email", "email_verified"},
+	}
+}
+
+// AuthorizationRequest holds the parameters of a request to /authorize.
+type AuthorizationRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scopes              []string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Prompt              string
+}
+
+func ParseAuthorizationRequest(query url.Values) *AuthorizationRequest {
+	return &AuthorizationRequest{
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		ResponseType:        query.Get("response_type"),
+		Scopes:              strings.Fields(query.Get("scope")),
+		State:               query.Get("state"),
+		Nonce:               query.Get("nonce"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+		Prompt:              query.Get("prompt"),
+	}
+}
+
+// Validate checks the request against what the client was registered with. The
+// client and redirect URI are checked by the caller first, since errors can only be
+// sent back to a redirect URI known to belong to the client.
+func (a *AuthorizationRequest) Validate(allowedScopes []string) *Error {
+	if a.ResponseType != "code" {
+		return &Error{Code: UnsupportedResponseType, Description: "only the authorization code flow is supported"}
+	}
+
+	if !contains(a.Scopes, OpenIDScope) {
+		return &Error{Code: InvalidScope, Description: "the openid scope is required"}
+	}
+
+	for _, scope := range a.Scopes {
+		if !contains(allowedScopes, scope) {
+			return &Error{Code: InvalidScope, Description: "scope " + scope + " is not allowed for this client"}
+		}
+	}
+
+	// PKCE is required of every client, confidential ones included (RFC 9700).
+	if a.CodeChallenge == "" || a.CodeChallengeMethod != "S256" {
+		return &Error{Code: InvalidRequest, Description: "a code_challenge with the S256 method is required"}
+	}
+
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RedirectURIAllowed reports whether uri is one of the registered URIs. They have to
+// match exactly.
+func RedirectURIAllowed(registered []string, uri string) bool {
+	return uri != "" && contains(registered, uri)
+}
+
+// RedirectWithCode returns where to send the user with the authorization code.
+func RedirectWithCode(redirectURI, code, state string) string {
+	params := url.Values{"code": {code}}
+
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	return appendQuery(redirectURI, params)
+}
+
+// RedirectWithError returns where to send the user with an error response.
+func RedirectWithError(redirectURI string, err *Error, state string) string {
+	params := url.Values{"error": {err.Code}}
+
+	if err.Description != "" {
+		params.Set("error_description", err.Description)
+	}
+
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	return appendQuery(redirectURI, params)
+}
+
+func appendQuery(uri string, params url.Values) string {
+	if strings.Contains(uri, "?") {
+		return uri + "&" + params.Encode()
+	}
+
+	return uri + "?" + params.Encode()
+}
+
+// VerifyPKCE checks verifier against the S256 challenge it was sent with.
+func VerifyPKCE(verifier, challenge string) bool {
+	// RFC 7636 section 4.1 verifiers are 43 to 128 characters long.
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+// IDTokenClaims are the claims of an ID token. The profile and email claims are only
+// set when their scope was granted.
+type IDTokenClaims struct {
+	Nonce             string `json:"nonce,omitempty"`
+	AuthTime          int64  `json:"auth_time,omitempty"`
+	AccessTokenHash   string `json:"at_hash,omitempty"`
+	AuthorizedParty   string `json:"azp,omitempty"`
+	Name              string `json:"name,omitempty"`
+	GivenName         string `json:"given_name,omitempty"`
+	FamilyName        string `json:"family_name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// UserInfo holds the claims about a user, as served by the userinfo endpoint.
+type UserInfo struct {
+	Subject           string `json:"sub"`
+	Name              string `json:"name,omitempty"`
+	GivenName         string `json:"given_name,omitempty"`
+	FamilyName        string `json:"family_name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+}
+
+// Profile is the user as seen by clients.
+type Profile struct {
+	Subject       string
+	Username      string
+	FirstName     string
+	LastName      string
+	Email         string
+	EmailVerified bool
+}
+
+// UserInfo returns the claims about profile that scopes give access to.
+func (p *Profile) UserInfo(scopes []string) UserInfo {
+	info := UserInfo{Subject: p.Subject}
+
+	if contains(scopes, ProfileScope) {
+		info.Name = strings.TrimSpace(p.FirstName + " " + p.LastName)
+		info.GivenName = p.FirstName
+		info.FamilyName = p.LastName
+		info.PreferredUsername = p.Username
+	}
+
+	if contains(scopes, EmailScope) {
+		verified := p.EmailVerified
+		info.Email = p.Email
+		info.EmailVerified = &verified
+	}
+
+	return info
+}
+
+// IDToken holds what goes into an ID token besides the user.
+type IDToken struct {
+	Issuer      string
+	ClientID    string
+	Nonce       string
+	AuthTime    time.Time
+	AccessToken string
+	Scopes      []string
+}
+
+// SignIDToken signs an ID token for profile. Clients verify it with the published
+// JWKS, so it can't be signed with the shared secret used without signing keys.
+func SignIDToken(profile *Profile, t IDToken) (string, error) {
+	if helpers.Keys == nil {
+		return "", ErrNoSigningKeys
+	}
+
+	now := time.Now()
+	info := profile.UserInfo(t.Scopes)
+
+	claims := &IDTokenClaims{
+		Nonce:             t.Nonce,
+		AuthorizedParty:   t.ClientID,
+		Name:              info.Name,
+		GivenName:         info.GivenName,
+		FamilyName:        info.FamilyName,
+		PreferredUsername: info.PreferredUsername,
+		Email:             info.Email,
+		EmailVerified:     info.EmailVerified,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    strings.TrimRight(t.Issuer, "/"),
+			Subject:   profile.Subject,
+			Audience:  jwt.ClaimStrings{t.ClientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ID_TOKEN_EXPIRATION)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	if !t.AuthTime.IsZero() {
+		claims.AuthTime = t.AuthTime.Unix()
+	}
+
+	if t.AccessToken != "" {
+		claims.AccessTokenHash = TokenHash(t.AccessToken, helpers.Keys.Active().Method.Alg())
+	}
+
+	return helpers.SignClaims(claims)
+}
+
+// TokenHash is the at_hash of token: the left half of its hash, using the hash of
+// the ID token's signing algorithm.
+func TokenHash(token, alg string) string {
+	var h hash.Hash
+
+	switch alg {
+	case "EdDSA", "RS512", "ES512", "PS512":
+		h = sha512.New()
+	case "RS384", "ES384", "PS384":
+		h = sha512.New384()
+	default:
+		h = sha256.New()
+	}
+
+	h.Write([]byte(token))
+	sum := h.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
@@ -0,0 +1,180 @@
+package oidc
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const checkMark = "\u2713"
+const ballotX = "\u2717"
+
+func TestAuthorizationRequest(t *testing.T) {
+	valid := url.Values{
+		"client_id":             {"client"},
+		"redirect_uri":          {"https://app.example.com/callback"},
+		"response_type":         {"code"},
+		"scope":                 {"openid email"},
+		"state":                 {"state"},
+		"code_challenge":        {"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"},
+		"code_challenge_method": {"S256"},
+	}
+
+	allowed := []string{OpenIDScope, ProfileScope, EmailScope}
+
+	with := func(key, value string) url.Values {
+		query := url.Values{}
+		for k, v := range valid {
+			query[k] = v
+		}
+
+		if value == "" {
+			query.Del(key)
+		} else {
+			query.Set(key, value)
+		}
+
+		return query
+	}
+
+	tests := []struct {
+		name  string
+		query url.Values
+		code  string
+	}{
+		{"an implicit flow request", with("response_type", "token"), UnsupportedResponseType},
+		{"a request without the openid scope", with("scope", "email"), InvalidScope},
+		{"a request for a scope the client can't have", with("scope", "openid admin"), InvalidScope},
+		{"a request without a code challenge", with("code_challenge", ""), InvalidRequest},
+		{"a request with a plain code challenge", with("code_challenge_method", "plain"), InvalidRequest},
+	}
+
+	t.Log("Given the need to test validating authorization requests.")
+	{
+		t.Log("\tWhen checking a valid request.")
+		{
+			if err := ParseAuthorizationRequest(valid).Validate(allowed); err != nil {
+				t.Errorf("\t\tShould accept it, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould accept it.", checkMark)
+		}
+
+		for _, tt := range tests {
+			t.Logf("\tWhen checking %s.", tt.name)
+			{
+				if err := ParseAuthorizationRequest(tt.query).Validate(allowed); err == nil || err.Code != tt.code {
+					t.Errorf("\t\tShould refuse it with %s, but got %v. %v", tt.code, err, ballotX)
+				}
+				t.Logf("\t\tShould refuse it with %s. %v", tt.code, checkMark)
+			}
+		}
+
+		t.Log("\tWhen matching redirect URIs.")
+		{
+			registered := []string{"https://app.example.com/callback"}
+
+			if !RedirectURIAllowed(registered, "https://app.example.com/callback") {
+				t.Error("\t\tShould accept a registered URI.", ballotX)
+			}
+			t.Log("\t\tShould accept a registered URI.", checkMark)
+
+			for _, uri := range []string{"", "https://app.example.com/callback/", "https://app.example.com/callback?next=/", "https://evil.example.com/callback"} {
+				if RedirectURIAllowed(registered, uri) {
+					t.Errorf("\t\tShould refuse %q. %v", uri, ballotX)
+				}
+			}
+			t.Log("\t\tShould refuse anything but an exact match.", checkMark)
+		}
+
+		t.Log("\tWhen redirecting back to the client.")
+		{
+			if uri := RedirectWithCode("https://app.example.com/callback?tenant=1", "code", "state"); uri != "https://app.example.com/callback?tenant=1&code=code&state=state" {
+				t.Errorf("\t\tShould keep the query of the redirect URI, but got %q. %v", uri, ballotX)
+			}
+			t.Log("\t\tShould keep the query of the redirect URI.", checkMark)
+
+			if uri := RedirectWithError("https://app.example.com/callback", &Error{Code: AccessDenied}, "state"); uri != "https://app.example.com/callback?error=access_denied&state=state" {
+				t.Errorf("\t\tShould send the error and state, but got %q. %v", uri, ballotX)
+			}
+			t.Log("\t\tShould send the error and state.", checkMark)
+		}
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	t.Log("Given the need to test PKCE verification.")
+	{
+		t.Log("\tWhen checking the RFC 7636 example.")
+		{
+			if !VerifyPKCE(verifier, challenge) {
+				t.Error("\t\tShould accept the verifier.", ballotX)
+			}
+			t.Log("\t\tShould accept the verifier.", checkMark)
+
+			if VerifyPKCE(strings.Replace(verifier, "d", "e", 1), challenge) {
+				t.Error("\t\tShould refuse another verifier.", ballotX)
+			}
+			t.Log("\t\tShould refuse another verifier.", checkMark)
+
+			if VerifyPKCE(challenge[:10], challenge) || VerifyPKCE("", "") {
+				t.Error("\t\tShould refuse verifiers that are too short.", ballotX)
+			}
+			t.Log("\t\tShould refuse verifiers that are too short.", checkMark)
+		}
+	}
+}
+
+func TestUserInfo(t *testing.T) {
+	profile := &Profile{Subject: "7", Username: "ada", FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", EmailVerified: true}
+
+	t.Log("Given the need to test the claims given to clients.")
+	{
+		t.Log("\tWhen only the openid scope was granted.")
+		{
+			if info := profile.UserInfo([]string{OpenIDScope}); info != (UserInfo{Subject: "7"}) {
+				t.Errorf("\t\tShould only give the subject, but got %+v. %v", info, ballotX)
+			}
+			t.Log("\t\tShould only give the subject.", checkMark)
+		}
+
+		t.Log("\tWhen the profile and email scopes were granted.")
+		{
+			info := profile.UserInfo([]string{OpenIDScope, ProfileScope, EmailScope})
+
+			if info.Name != "Ada Lovelace" || info.PreferredUsername != "ada" || info.Email != "ada@example.com" || info.EmailVerified == nil || !*info.EmailVerified {
+				t.Errorf("\t\tShould give the profile and email, but got %+v. %v", info, ballotX)
+			}
+			t.Log("\t\tShould give the profile and email.", checkMark)
+		}
+	}
+}
+
+func TestRenderConsent(t *testing.T) {
+	t.Log("Given the need to test the consent screen.")
+	{
+		t.Log("\tWhen the client name contains markup.")
+		{
+			var buf bytes.Buffer
+
+			if err := RenderConsent(&buf, NewConsent("Ada", "<script>alert(1)</script>", []string{OpenIDScope, EmailScope, "unknown"}, "request-id", "/oauth/authorize")); err != nil {
+				t.Fatal("\t\tShould render the page.", ballotX, err)
+			}
+
+			page := buf.String()
+
+			if strings.Contains(page, "<script>") {
+				t.Error("\t\tShould escape the client name.", ballotX)
+			}
+			t.Log("\t\tShould escape the client name.", checkMark)
+
+			if !strings.Contains(page, ScopeDescriptions[EmailScope]) || !strings.Contains(page, `value="request-id"`) {
+				t.Errorf("\t\tShould describe the scopes and carry the request ID, but got %s. %v", page, ballotX)
+			}
+			t.Log("\t\tShould describe the scopes and carry the request ID.", checkMark)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// defaults for the ARGON2_* settings, the second recommended option of RFC 9106
+// with less parallelism.
+const DEFAULT_ARGON2_MEMORY = 64 * 1024
+const DEFAULT_ARGON2_ITERATIONS = 3
+const DEFAULT_ARGON2_PARALLELISM = 2
+
+const ARGON2_SALT_LENGTH = 16
+const ARGON2_KEY_LENGTH = 32
+
+const argon2idPrefix = "$argon2id$"
+
+// Argon2id hashes passwords with argon2id, encoded in the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>.
+type Argon2id struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+func DefaultArgon2id() *Argon2id {
+	return &Argon2id{Memory: DEFAULT_ARGON2_MEMORY, Iterations: DEFAULT_ARGON2_ITERATIONS, Parallelism: DEFAULT_ARGON2_PARALLELISM}
+}
+
+type argon2Hash struct {
+	Argon2id
+	salt []byte
+	key  []byte
+}
+
+func decodeArgon2id(encoded string) (*argon2Hash, error) {
+	parts := strings.Split(encoded, "$")
+
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrUnknownHash
+	}
+
+	var version int
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	var hash argon2Hash
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.Memory, &hash.Iterations, &hash.Parallelism); err != nil {
+		return nil, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+
+	var err error
+
+	if hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, err
+	}
+
+	if hash.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, err
+	}
+
+	if hash.Memory == 0 || hash.Iterations == 0 || hash.Parallelism == 0 || len(hash.key) == 0 {
+		return nil, fmt.Errorf("invalid argon2 parameters %q", parts[3])
+	}
+
+	return &hash, nil
+}
+
+func (h *Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, ARGON2_SALT_LENGTH)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, ARGON2_KEY_LENGTH)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify uses the parameters stored in encoded rather than the hasher's own.
+func (h *Argon2id) Verify(password, encoded string) (bool, error) {
+	hash, err := decodeArgon2id(encoded)
+
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey([]byte(password), hash.salt, hash.Iterations, hash.Memory, hash.Parallelism, uint32(len(hash.key)))
+
+	return subtle.ConstantTimeCompare(key, hash.key) == 1, nil
+}
+
+func (h *Argon2id) Handles(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+func (h *Argon2id) NeedsRehash(encoded string) bool {
+	hash, err := decodeArgon2id(encoded)
+
+	if err != nil {
+		return true
+	}
+
+	return hash.Argon2id != *h || len(hash.salt) != ARGON2_SALT_LENGTH || len(hash.key) != ARGON2_KEY_LENGTH
+}
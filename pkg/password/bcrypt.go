@@ -0,0 +1,56 @@
+package password
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const DEFAULT_BCRYPT_COST = 12
+
+// Bcrypt hashes passwords with bcrypt. bcrypt predates the PHC string format and
+// keeps its own $2b$<cost>$ encoding, which the format allows for.
+type Bcrypt struct {
+	Cost int
+}
+
+func DefaultBcrypt() *Bcrypt {
+	return &Bcrypt{Cost: DEFAULT_BCRYPT_COST}
+}
+
+func (h *Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (h *Bcrypt) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (h *Bcrypt) Handles(encoded string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(encoded, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *Bcrypt) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+
+	return err != nil || cost != h.Cost
+}
@@ -0,0 +1,93 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+//go:embed breached.txt
+var defaultBreached []byte
+
+// BreachedList is a set of passwords known from data breaches, held as SHA-1 hashes.
+type BreachedList struct {
+	hashes [][sha1.Size]byte
+}
+
+// ReadBreachedList reads a list of hex SHA-1 hashes, one per line, in any case and
+// order. Anything after a colon is ignored, so the Pwned Passwords downloads can be
+// used as they are. Empty lines and lines starting with # are skipped.
+func ReadBreachedList(r io.Reader) (*BreachedList, error) {
+	list := &BreachedList{}
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		text, _, _ = strings.Cut(text, ":")
+
+		var hash [sha1.Size]byte
+
+		if n, err := hex.Decode(hash[:], []byte(text)); err != nil || n != sha1.Size {
+			return nil, fmt.Errorf("breached password list: invalid hash on line %d", line)
+		}
+
+		list.hashes = append(list.hashes, hash)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list.hashes, func(i, j int) bool {
+		return bytes.Compare(list.hashes[i][:], list.hashes[j][:]) < 0
+	})
+
+	return list, nil
+}
+
+// OpenBreachedList reads the list at path, see ReadBreachedList.
+func OpenBreachedList(path string) (*BreachedList, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return ReadBreachedList(file)
+}
+
+// DefaultBreachedList returns the list of common passwords built into the binary.
+func DefaultBreachedList() *BreachedList {
+	list, err := ReadBreachedList(bytes.NewReader(defaultBreached))
+
+	if err != nil {
+		panic(err)
+	}
+
+	return list
+}
+
+// Contains reports whether password is on the list.
+func (l *BreachedList) Contains(password string) bool {
+	hash := sha1.Sum([]byte(password))
+
+	i := sort.Search(len(l.hashes), func(i int) bool {
+		return bytes.Compare(l.hashes[i][:], hash[:]) >= 0
+	})
+
+	return i < len(l.hashes) && l.hashes[i] == hash
+}
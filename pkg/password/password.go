@@ -0,0 +1,95 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+)
+
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Hasher hashes passwords with one algorithm and set of parameters.
+type Hasher interface {
+	// Hash returns the encoded hash of password, including its salt and parameters.
+	Hash(password string) (string, error)
+	// Verify reports whether password matches the encoded hash.
+	Verify(password, encoded string) (bool, error)
+	// Handles reports whether encoded was made with this hasher's algorithm.
+	Handles(encoded string) bool
+	// NeedsRehash reports whether encoded was made with other parameters than the
+	// hasher's own.
+	NeedsRehash(encoded string) bool
+}
+
+// hashers are every algorithm Verify accepts, whatever Default is.
+var hashers = []Hasher{DefaultArgon2id(), DefaultBcrypt()}
+
+// Default is the hasher new hashes are made with. It is replaced on startup from the
+// configuration.
+var Default Hasher = DefaultArgon2id()
+
+// Hash hashes password with Default.
+func Hash(password string) (string, error) {
+	return Default.Hash(password)
+}
+
+// Verify checks password against encoded, whichever supported algorithm made it.
+// rehash is set when the password matched but encoded should be replaced by a hash
+// from Default.
+func Verify(password, encoded string) (ok bool, rehash bool, err error) {
+	for _, hasher := range append([]Hasher{Default}, hashers...) {
+		if !hasher.Handles(encoded) {
+			continue
+		}
+
+		ok, err := hasher.Verify(password, encoded)
+
+		if err != nil || !ok {
+			return false, false, err
+		}
+
+		return true, !Default.Handles(encoded) || Default.NeedsRehash(encoded), nil
+	}
+
+	return false, false, ErrUnknownHash
+}
+
+// defaults for the PASSWORD_* settings.
+const DEFAULT_PASSWORD_HASHER = "argon2id"
+
+// FromConfig returns the hasher described by the PASSWORD_* settings, using the
+// defaults for anything left unset.
+func FromConfig() (Hasher, error) {
+	config := helpers.EnvConfig
+
+	switch strings.ToLower(config.PasswordHasher) {
+	case "", DEFAULT_PASSWORD_HASHER:
+		hasher := DefaultArgon2id()
+
+		if config.Argon2Memory > 0 {
+			hasher.Memory = config.Argon2Memory
+		}
+
+		if config.Argon2Iterations > 0 {
+			hasher.Iterations = config.Argon2Iterations
+		}
+
+		if config.Argon2Parallelism > 0 {
+			hasher.Parallelism = config.Argon2Parallelism
+		}
+
+		return hasher, nil
+	case "bcrypt":
+		hasher := DefaultBcrypt()
+
+		if config.BcryptCost > 0 {
+			hasher.Cost = config.BcryptCost
+		}
+
+		return hasher, nil
+	default:
+		return nil, fmt.Errorf("unknown password hasher %q", config.PasswordHasher)
+	}
+}
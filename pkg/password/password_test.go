@@ -0,0 +1,131 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const checkMark = "\u2713"
+const ballotX = "\u2717"
+
+func TestVerify(t *testing.T) {
+	hasher := &Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+	defer func(hasher Hasher) { Default = hasher }(Default)
+	Default = hasher
+
+	t.Log("Given the need to test hashing passwords.")
+	{
+		t.Log("\tWhen hashing with argon2id.")
+		{
+			encoded, err := Hash("correct horse")
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to hash the password.", ballotX, err)
+			}
+			t.Log("\t\tShould be able to hash the password.", checkMark)
+
+			if !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$") {
+				t.Errorf("\t\tShould encode it as a PHC string, but got %s. %v", encoded, ballotX)
+			}
+			t.Log("\t\tShould encode it as a PHC string.", checkMark)
+
+			if ok, rehash, err := Verify("correct horse", encoded); !ok || rehash || err != nil {
+				t.Errorf("\t\tShould accept the password without rehashing, but got %v, %v, %v. %v", ok, rehash, err, ballotX)
+			}
+			t.Log("\t\tShould accept the password without rehashing.", checkMark)
+
+			if ok, _, _ := Verify("battery staple", encoded); ok {
+				t.Error("\t\tShould reject another password.", ballotX)
+			}
+			t.Log("\t\tShould reject another password.", checkMark)
+		}
+
+		t.Log("\tWhen the parameters have changed.")
+		{
+			encoded, _ := Hash("correct horse")
+
+			Default = &Argon2id{Memory: 2048, Iterations: 1, Parallelism: 1}
+
+			if ok, rehash, _ := Verify("correct horse", encoded); !ok || !rehash {
+				t.Errorf("\t\tShould accept the password and ask for a rehash, but got %v, %v. %v", ok, rehash, ballotX)
+			}
+			t.Log("\t\tShould accept the password and ask for a rehash.", checkMark)
+
+			Default = hasher
+		}
+
+		t.Log("\tWhen checking a bcrypt hash.")
+		{
+			legacy, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+
+			if ok, rehash, _ := Verify("correct horse", string(legacy)); !ok || !rehash {
+				t.Errorf("\t\tShould accept the password and ask for a rehash, but got %v, %v. %v", ok, rehash, ballotX)
+			}
+			t.Log("\t\tShould accept the password and ask for a rehash.", checkMark)
+
+			if ok, _, _ := Verify("battery staple", string(legacy)); ok {
+				t.Error("\t\tShould reject another password.", ballotX)
+			}
+			t.Log("\t\tShould reject another password.", checkMark)
+		}
+
+		t.Log("\tWhen checking a hash in an unknown format.")
+		{
+			if _, _, err := Verify("correct horse", "$md5$abc"); !errors.Is(err, ErrUnknownHash) {
+				t.Errorf("\t\tShould fail with ErrUnknownHash, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould fail with ErrUnknownHash.", checkMark)
+
+			if _, _, err := Verify("correct horse", "$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5"); err == nil {
+				t.Error("\t\tShould reject invalid argon2 parameters.", ballotX)
+			}
+			t.Log("\t\tShould reject invalid argon2 parameters.", checkMark)
+		}
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	defer func(config helpers.Config) { helpers.EnvConfig = config }(helpers.EnvConfig)
+
+	t.Log("Given the need to test configuring the hasher.")
+	{
+		t.Log("\tWhen nothing is configured.")
+		{
+			helpers.EnvConfig = helpers.Config{}
+
+			hasher, err := FromConfig()
+
+			if err != nil || *hasher.(*Argon2id) != *DefaultArgon2id() {
+				t.Errorf("\t\tShould use argon2id with the default parameters, but got %v, %v. %v", hasher, err, ballotX)
+			}
+			t.Log("\t\tShould use argon2id with the default parameters.", checkMark)
+		}
+
+		t.Log("\tWhen bcrypt is configured.")
+		{
+			helpers.EnvConfig = helpers.Config{PasswordHasher: "bcrypt", BcryptCost: 13}
+
+			hasher, err := FromConfig()
+
+			if err != nil || hasher.(*Bcrypt).Cost != 13 {
+				t.Errorf("\t\tShould use bcrypt with the configured cost, but got %v, %v. %v", hasher, err, ballotX)
+			}
+			t.Log("\t\tShould use bcrypt with the configured cost.", checkMark)
+		}
+
+		t.Log("\tWhen an unknown hasher is configured.")
+		{
+			helpers.EnvConfig = helpers.Config{PasswordHasher: "md5"}
+
+			if _, err := FromConfig(); err == nil {
+				t.Error("\t\tShould fail.", ballotX)
+			}
+			t.Log("\t\tShould fail.", checkMark)
+		}
+	}
+}
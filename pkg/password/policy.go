@@ -0,0 +1,123 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/nbutton23/zxcvbn-go"
+)
+
+var (
+	ErrTooShort = errors.New("is too short")
+	ErrTooLong  = errors.New("is too long")
+	ErrTooWeak  = errors.New("is too easy to guess")
+	ErrPersonal = errors.New("must not contain the username or email")
+	ErrBreached = errors.New("has appeared in a data breach")
+)
+
+// defaults for the PASSWORD_* policy settings.
+const DEFAULT_PASSWORD_MIN_LENGTH = 8
+const DEFAULT_PASSWORD_MIN_SCORE = 2
+
+// MAX_PASSWORD_LENGTH keeps hashing and strength estimation cheap.
+const MAX_PASSWORD_LENGTH = 128
+
+// Policy are the rules new passwords have to follow.
+type Policy struct {
+	MinLength int
+	// MinScore is the lowest zxcvbn score accepted, from 0 to 4.
+	MinScore int
+	// Breached is checked when set.
+	Breached *BreachedList
+}
+
+// DefaultPolicy is the policy CheckPolicy applies. It is replaced on startup from the
+// configuration.
+var DefaultPolicy = &Policy{MinLength: DEFAULT_PASSWORD_MIN_LENGTH, MinScore: DEFAULT_PASSWORD_MIN_SCORE, Breached: DefaultBreachedList()}
+
+// CheckPolicy checks password against DefaultPolicy.
+func CheckPolicy(password string, userInputs ...string) error {
+	return DefaultPolicy.Check(password, userInputs...)
+}
+
+// Check returns the first rule password breaks, or nil. userInputs are the account's
+// username and email, which the password may not contain.
+func (p *Policy) Check(password string, userInputs ...string) error {
+	length := utf8.RuneCountInString(password)
+
+	if length < p.MinLength {
+		return fmt.Errorf("%w, use at least %d characters", ErrTooShort, p.MinLength)
+	}
+
+	if length > MAX_PASSWORD_LENGTH {
+		return fmt.Errorf("%w, use at most %d characters", ErrTooLong, MAX_PASSWORD_LENGTH)
+	}
+
+	lower := strings.ToLower(password)
+	inputs := make([]string, 0, len(userInputs)*2)
+
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+
+		// the local part of an email is what people reuse.
+		if local, _, ok := strings.Cut(input, "@"); ok {
+			inputs = append(inputs, local)
+		}
+
+		inputs = append(inputs, input)
+	}
+
+	for _, input := range inputs {
+		if len(input) >= 3 && strings.Contains(lower, input) {
+			return ErrPersonal
+		}
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		return ErrBreached
+	}
+
+	if zxcvbn.PasswordStrength(password, inputs).Score < p.MinScore {
+		return ErrTooWeak
+	}
+
+	return nil
+}
+
+// PolicyFromConfig returns the policy described by the PASSWORD_* settings, using the
+// defaults for anything left unset. PASSWORD_BREACHED_LIST replaces the built-in list
+// of common passwords.
+func PolicyFromConfig() (*Policy, error) {
+	config := helpers.EnvConfig
+	policy := &Policy{MinLength: DEFAULT_PASSWORD_MIN_LENGTH, MinScore: DEFAULT_PASSWORD_MIN_SCORE}
+
+	if config.PasswordMinLength > 0 {
+		policy.MinLength = config.PasswordMinLength
+	}
+
+	if config.PasswordMinScore > 0 {
+		policy.MinScore = config.PasswordMinScore
+	}
+
+	if policy.MinScore > 4 {
+		return nil, fmt.Errorf("password score must be between 0 and 4, got %d", policy.MinScore)
+	}
+
+	if config.PasswordBreachedList == "" {
+		policy.Breached = DefaultBreachedList()
+		return policy, nil
+	}
+
+	breached, err := OpenBreachedList(config.PasswordBreachedList)
+
+	if err != nil {
+		return nil, err
+	}
+
+	policy.Breached = breached
+
+	return policy, nil
+}
@@ -0,0 +1,79 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	policy := &Policy{MinLength: 8, MinScore: 2, Breached: DefaultBreachedList()}
+
+	t.Log("Given the need to test the password policy.")
+	{
+		tests := []struct {
+			name     string
+			password string
+			err      error
+		}{
+			{"a short password", "Xk9#", ErrTooShort},
+			{"a very long password", strings.Repeat("x", MAX_PASSWORD_LENGTH+1), ErrTooLong},
+			{"a password containing the username", "Adedunmol-Rocks!", ErrPersonal},
+			{"a password containing the email", "ade.smith#2024x", ErrPersonal},
+			{"a breached password", "password123", ErrBreached},
+			{"a guessable password", "aaaaaaaaaa", ErrTooWeak},
+		}
+
+		for _, tt := range tests {
+			t.Logf("\tWhen checking %s.", tt.name)
+			{
+				if err := policy.Check(tt.password, "adedunmol", "ade.smith@example.com"); !errors.Is(err, tt.err) {
+					t.Errorf("\t\tShould fail with %v, but got %v. %v", tt.err, err, ballotX)
+				}
+				t.Logf("\t\tShould fail with %v. %v", tt.err, checkMark)
+			}
+		}
+
+		t.Log("\tWhen checking a strong password.")
+		{
+			if err := policy.Check("correct horse battery staple", "adedunmol", "ade.smith@example.com"); err != nil {
+				t.Errorf("\t\tShould accept it, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould accept it.", checkMark)
+		}
+	}
+}
+
+func TestBreachedList(t *testing.T) {
+	t.Log("Given the need to test reading breached password lists.")
+	{
+		t.Log("\tWhen reading a Pwned Passwords download.")
+		{
+			// SHA-1 of "hunter2" and "letmein".
+			list, err := ReadBreachedList(strings.NewReader("F3BBBD66A63D4BF1747940578EC3D0103530E21D:17043\nb7a875fc1ea228b9061041b7cec4bd3c52ab3ce3:54\n"))
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to read the list.", ballotX, err)
+			}
+			t.Log("\t\tShould be able to read the list.", checkMark)
+
+			if !list.Contains("hunter2") || !list.Contains("letmein") {
+				t.Error("\t\tShould contain the listed passwords.", ballotX)
+			}
+			t.Log("\t\tShould contain the listed passwords.", checkMark)
+
+			if list.Contains("hunter3") {
+				t.Error("\t\tShould not contain other passwords.", ballotX)
+			}
+			t.Log("\t\tShould not contain other passwords.", checkMark)
+		}
+
+		t.Log("\tWhen reading a malformed list.")
+		{
+			if _, err := ReadBreachedList(strings.NewReader("not a hash\n")); err == nil {
+				t.Error("\t\tShould fail.", ballotX)
+			}
+			t.Log("\t\tShould fail.", checkMark)
+		}
+	}
+}
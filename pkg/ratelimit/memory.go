@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type counterKey struct {
+	key    string
+	window int64
+}
+
+type counter struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// MemoryStore is a Store local to the running process.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[counterKey]*counter
+	pruned   time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[counterKey]*counter)}
+}
+
+func (s *MemoryStore) Increment(ctx context.Context, key string, window time.Time, size time.Duration) (int64, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	// drop the counters of windows that have fully slid by, at most once a minute.
+	if now.Sub(s.pruned) >= time.Minute {
+		for k, c := range s.counters {
+			if !c.expiresAt.After(now) {
+				delete(s.counters, k)
+			}
+		}
+
+		s.pruned = now
+	}
+
+	current, ok := s.counters[counterKey{key, window.UnixNano()}]
+
+	if !ok {
+		current = &counter{expiresAt: window.Add(2 * size)}
+		s.counters[counterKey{key, window.UnixNano()}] = current
+	}
+
+	current.count++
+
+	var previous int64
+
+	if c, ok := s.counters[counterKey{key, window.Add(-size).UnixNano()}]; ok {
+		previous = c.count
+	}
+
+	return current.count, previous, nil
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PostgresStore is a Store shared by every instance using the same database.
+type PostgresStore struct {
+	db *gorm.DB
+
+	mu     sync.Mutex
+	pruned time.Time
+}
+
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Increment(ctx context.Context, key string, window time.Time, size time.Duration) (int64, int64, error) {
+	db := s.db.WithContext(ctx)
+
+	if err := s.prune(db); err != nil {
+		return 0, 0, err
+	}
+
+	counter := models.RateLimitCounter{Key: key, WindowStart: window, Count: 1, ExpiresAt: window.Add(2 * size)}
+
+	result := db.Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}, {Name: "window_start"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr("rate_limit_counters.count + 1")}),
+		},
+		clause.Returning{Columns: []clause.Column{{Name: "count"}}},
+	).Create(&counter)
+
+	if result.Error != nil {
+		return 0, 0, result.Error
+	}
+
+	var previous []int64
+
+	result = db.Model(&models.RateLimitCounter{}).
+		Where("key = ? AND window_start = ?", key, window.Add(-size)).
+		Pluck("count", &previous)
+
+	if result.Error != nil {
+		return 0, 0, result.Error
+	}
+
+	if len(previous) == 0 {
+		return counter.Count, 0, nil
+	}
+
+	return counter.Count, previous[0], nil
+}
+
+// prune drops the counters of windows that have fully slid by, at most once a minute
+// per instance.
+func (s *PostgresStore) prune(db *gorm.DB) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(s.pruned) < time.Minute {
+		return nil
+	}
+
+	if err := db.Where("expires_at <= ?", now).Delete(&models.RateLimitCounter{}).Error; err != nil {
+		return err
+	}
+
+	s.pruned = now
+
+	return nil
+}
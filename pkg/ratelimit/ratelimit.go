@@ -0,0 +1,188 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+)
+
+// Store keeps the request counters of fixed windows.
+type Store interface {
+	// Increment counts a request under key in the window starting at window, and
+	// returns the count of that window and of the one before it.
+	Increment(ctx context.Context, key string, window time.Time, size time.Duration) (current int64, previous int64, err error)
+}
+
+// Default is the store used by limiters without one of their own. It is replaced on
+// startup when a shared store is configured.
+var Default Store = NewMemoryStore()
+
+// KeyFunc returns the key a request is counted under.
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP counts requests per client address.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// KeyByUser counts requests per authenticated user, so it belongs behind
+// middleware.Authenticate. Requests made with an API key are counted per key, those
+// of services per client, and anonymous requests per address.
+func KeyByUser(r *http.Request) string {
+	principal, ok := middleware.GetPrincipal(r.Context())
+
+	if !ok {
+		return KeyByIP(r)
+	}
+
+	if principal.APIKey != nil {
+		return "key:" + principal.APIKey.Prefix
+	}
+
+	if principal.Service() {
+		return "client:" + principal.Client.ClientID
+	}
+
+	return "user:" + strconv.FormatUint(uint64(principal.User.ID), 10)
+}
+
+// KeyByAPIKey counts requests per API key, by the key's lookup prefix so that the
+// secret isn't kept around. Requests without one are counted per address.
+func KeyByAPIKey(r *http.Request) string {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+
+	if !strings.EqualFold(scheme, "Bearer") {
+		return KeyByIP(r)
+	}
+
+	prefix, _, ok := helpers.ParseAPIKey(strings.TrimSpace(token))
+
+	if !ok {
+		return KeyByIP(r)
+	}
+
+	return "key:" + prefix
+}
+
+// Result is the outcome of counting a request.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Limiter allows Limit requests per Window for each key, using a sliding window: the
+// previous window's count is weighted by how much of it still overlaps.
+type Limiter struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	Key    KeyFunc
+	// Store holds the counters, Default is used when it is nil.
+	Store Store
+
+	now func() time.Time
+}
+
+func New(name string, limit int, window time.Duration, key KeyFunc) *Limiter {
+	return &Limiter{Name: name, Limit: limit, Window: window, Key: key, now: time.Now}
+}
+
+func (l *Limiter) store() Store {
+	if l.Store != nil {
+		return l.Store
+	}
+
+	return Default
+}
+
+// Allow counts a request under key. Rejected requests are counted as well, so
+// clients that keep retrying stay limited.
+func (l *Limiter) Allow(ctx context.Context, key string) (Result, error) {
+	now := l.now()
+	window := now.Truncate(l.Window)
+	elapsed := now.Sub(window)
+
+	current, previous, err := l.store().Increment(ctx, l.Name+":"+key, window, l.Window)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	weight := float64(l.Window-elapsed) / float64(l.Window)
+	estimate := int64(float64(previous)*weight) + current
+
+	result := Result{
+		Allowed: estimate <= int64(l.Limit),
+		Limit:   l.Limit,
+		Reset:   l.Window - elapsed,
+	}
+
+	if result.Allowed {
+		result.Remaining = l.Limit - int(estimate)
+		return result, nil
+	}
+
+	// find when the next request would fit again.
+	room := float64(l.Limit - 1)
+
+	if current > int64(l.Limit-1) {
+		// this window is full on its own, so wait for it to become the previous one.
+		result.RetryAfter = l.Window - elapsed + time.Duration(float64(l.Window)*(1-room/float64(current)))
+	} else {
+		result.RetryAfter = time.Duration(float64(l.Window)*(1-(room-float64(current))/float64(previous))) - elapsed
+	}
+
+	if result.RetryAfter < 0 {
+		result.RetryAfter = 0
+	}
+
+	return result, nil
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// Handler limits the requests passed on to next, answering with 429 once a key is
+// over the limit. Requests are let through when the store fails, so that an outage
+// of the store doesn't take the endpoints down with it.
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err := l.Allow(r.Context(), l.Key(r))
+
+		if err != nil {
+			helpers.Error.Println("rate limit", l.Name, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", seconds(result.Reset))
+		w.Header().Set("RateLimit-Policy", strconv.Itoa(l.Limit)+";w="+seconds(l.Window))
+
+		if !result.Allowed {
+			w.Header().Set("Retry-After", seconds(result.RetryAfter))
+			helpers.RespondWithJSON(w, http.StatusTooManyRequests, helpers.APIResponse{Message: "too many requests, try again later", Data: nil, Status: "error"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const checkMark = "\u2713"
+const ballotX = "\u2717"
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	window := time.Now().Truncate(time.Minute)
+
+	t.Log("Given the need to test the in-memory counters.")
+	{
+		t.Log("\tWhen counting requests across two windows.")
+		{
+			store.Increment(ctx, "key", window, time.Minute)
+			store.Increment(ctx, "key", window, time.Minute)
+
+			current, previous, _ := store.Increment(ctx, "key", window.Add(time.Minute), time.Minute)
+
+			if current != 1 || previous != 2 {
+				t.Errorf("\t\tShould return the counts of both windows, but got %d and %d. %v", current, previous, ballotX)
+			}
+			t.Log("\t\tShould return the counts of both windows.", checkMark)
+
+			if current, _, _ := store.Increment(ctx, "other", window, time.Minute); current != 1 {
+				t.Errorf("\t\tShould count other keys separately, but got %d. %v", current, ballotX)
+			}
+			t.Log("\t\tShould count other keys separately.", checkMark)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now().Truncate(time.Minute)
+	now := start
+
+	limiter := New("test", 3, time.Minute, KeyByIP)
+	limiter.Store = NewMemoryStore()
+	limiter.now = func() time.Time { return now }
+
+	t.Log("Given the need to test the sliding window.")
+	{
+		t.Log("\tWhen staying within the limit.")
+		{
+			for i := 2; i >= 0; i-- {
+				result, err := limiter.Allow(ctx, "key")
+
+				if err != nil || !result.Allowed || result.Remaining != i {
+					t.Fatalf("\t\tShould allow the request with %d remaining, but got %+v. %v", i, result, ballotX)
+				}
+			}
+			t.Log("\t\tShould allow the requests.", checkMark)
+		}
+
+		t.Log("\tWhen going over the limit.")
+		{
+			result, _ := limiter.Allow(ctx, "key")
+
+			if result.Allowed {
+				t.Error("\t\tShould reject the request.", ballotX)
+			}
+			t.Log("\t\tShould reject the request.", checkMark)
+
+			if result.RetryAfter <= 0 {
+				t.Errorf("\t\tShould say when to retry, but got %s. %v", result.RetryAfter, ballotX)
+			}
+			t.Log("\t\tShould say when to retry.", checkMark)
+		}
+
+		t.Log("\tWhen the previous window still overlaps.")
+		{
+			now = start.Add(time.Minute + 10*time.Second)
+
+			if result, _ := limiter.Allow(ctx, "key"); result.Allowed {
+				t.Error("\t\tShould still count the previous window.", ballotX)
+			}
+			t.Log("\t\tShould still count the previous window.", checkMark)
+		}
+
+		t.Log("\tWhen the previous window has slid by.")
+		{
+			now = start.Add(3 * time.Minute)
+
+			if result, _ := limiter.Allow(ctx, "key"); !result.Allowed {
+				t.Error("\t\tShould allow the request again.", ballotX)
+			}
+			t.Log("\t\tShould allow the request again.", checkMark)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	limiter := New("test", 1, time.Minute, KeyByIP)
+	limiter.Store = NewMemoryStore()
+
+	handler := limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(addr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/users/login", nil)
+		r.RemoteAddr = addr
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		return w
+	}
+
+	t.Log("Given the need to test the rate limiting middleware.")
+	{
+		t.Log("\tWhen a request is allowed.")
+		{
+			w := request("192.0.2.1:1234")
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t\tShould pass the request on, but got %d. %v", w.Code, ballotX)
+			}
+			t.Log("\t\tShould pass the request on.", checkMark)
+
+			if w.Header().Get("RateLimit-Limit") != "1" || w.Header().Get("RateLimit-Remaining") != "0" || w.Header().Get("RateLimit-Reset") == "" {
+				t.Errorf("\t\tShould send the RateLimit headers, but got %v. %v", w.Header(), ballotX)
+			}
+			t.Log("\t\tShould send the RateLimit headers.", checkMark)
+		}
+
+		t.Log("\tWhen a request is over the limit.")
+		{
+			w := request("192.0.2.1:5678")
+
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("\t\tShould answer with 429, but got %d. %v", w.Code, ballotX)
+			}
+			t.Log("\t\tShould answer with 429.", checkMark)
+
+			if w.Header().Get("Retry-After") == "" {
+				t.Error("\t\tShould send Retry-After.", ballotX)
+			}
+			t.Log("\t\tShould send Retry-After.", checkMark)
+		}
+
+		t.Log("\tWhen a request comes from another address.")
+		{
+			if w := request("192.0.2.2:1234"); w.Code != http.StatusOK {
+				t.Errorf("\t\tShould count it separately, but got %d. %v", w.Code, ballotX)
+			}
+			t.Log("\t\tShould count it separately.", checkMark)
+		}
+	}
+}
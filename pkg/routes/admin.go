@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"github.com/Adedunmol/zephyr/pkg/handlers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/go-chi/chi/v5"
+)
+
+func SetupAdminRoutes(m *chi.Mux, limits RateLimits) {
+
+	adminRouter := chi.NewRouter()
+
+	adminRouter.Use(middleware.Authenticate)
+	adminRouter.Use(limits.User)
+
+	adminRouter.With(middleware.RequirePermission(models.RolesReadPermission)).Get("/roles", handlers.ListRolesHandler)
+
+	adminRouter.With(middleware.RequirePermission(models.UsersReadPermission)).Get("/users", handlers.ListUsersHandler)
+	adminRouter.With(middleware.RequirePermission(models.UsersWritePermission)).Post("/users/{id}/unlock", handlers.UnlockUserHandler)
+	adminRouter.With(middleware.RequirePermission(models.RolesReadPermission)).Get("/users/{id}/roles", handlers.GetUserRolesHandler)
+	adminRouter.With(middleware.RequirePermission(models.RolesWritePermission)).Post("/users/{id}/roles", handlers.AssignRoleHandler)
+	adminRouter.With(middleware.RequirePermission(models.RolesWritePermission)).Delete("/users/{id}/roles/{role}", handlers.RemoveRoleHandler)
+
+	adminRouter.With(middleware.RequirePermission(models.ClientsReadPermission)).Get("/clients", handlers.ListClientsHandler)
+	adminRouter.With(middleware.RequirePermission(models.ClientsWritePermission)).Post("/clients", handlers.CreateClientHandler)
+	adminRouter.With(middleware.RequirePermission(models.ClientsWritePermission)).Delete("/clients/{id}", handlers.DeleteClientHandler)
+
+	m.Mount("/admin", adminRouter)
+}
@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"github.com/Adedunmol/zephyr/pkg/handlers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+func SetupOAuthRoutes(m *chi.Mux, limits RateLimits) {
+
+	oauthRouter := chi.NewRouter()
+
+	// the user signs in to clients with their login, not with an API key.
+	oauthRouter.Group(func(r chi.Router) {
+		r.Use(middleware.Authenticate)
+		r.Use(middleware.RequireSession)
+		r.Use(limits.User)
+
+		r.Get("/authorize", handlers.AuthorizeHandler)
+		r.Post("/authorize", handlers.AuthorizeDecisionHandler)
+	})
+
+	oauthRouter.Group(func(r chi.Router) {
+		r.Use(limits.Client)
+
+		r.Post("/token", handlers.OAuthTokenHandler)
+		r.Post("/introspect", handlers.IntrospectTokenHandler)
+		r.Post("/revoke", handlers.RevokeTokenHandler)
+		r.Get("/userinfo", handlers.UserInfoHandler)
+		r.Post("/userinfo", handlers.UserInfoHandler)
+	})
+
+	m.Mount("/oauth", oauthRouter)
+}
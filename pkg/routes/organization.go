@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"github.com/Adedunmol/zephyr/pkg/handlers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/go-chi/chi/v5"
+)
+
+func SetupOrganizationRoutes(m *chi.Mux, limits RateLimits) {
+
+	organizationRouter := chi.NewRouter()
+
+	organizationRouter.Use(middleware.Authenticate)
+	organizationRouter.Use(middleware.RequireUser)
+	organizationRouter.Use(verifiedEmail())
+	organizationRouter.Use(limits.User)
+
+	organizationRouter.Post("/", handlers.CreateOrganizationHandler)
+	organizationRouter.Get("/", handlers.ListOrganizationsHandler)
+	organizationRouter.With(middleware.RequireSession).Post("/{id}/switch", handlers.SwitchOrganizationHandler)
+
+	organizationRouter.Group(func(r chi.Router) {
+		r.Use(middleware.RequireOrganization)
+
+		r.Get("/current", handlers.GetCurrentOrganizationHandler)
+		r.Get("/current/members", handlers.ListMembersHandler)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireOrganizationRole(models.OrganizationOwnerRole, models.OrganizationAdminRole))
+
+			r.Post("/current/invitations", handlers.CreateInvitationHandler)
+			r.Get("/current/invitations", handlers.ListInvitationsHandler)
+			r.Delete("/current/invitations/{id}", handlers.RevokeInvitationHandler)
+
+			r.Get("/current/saml", handlers.GetSAMLProviderHandler)
+			r.Put("/current/saml", handlers.ConfigureSAMLProviderHandler)
+			r.Delete("/current/saml", handlers.DeleteSAMLProviderHandler)
+		})
+	})
+
+	m.Mount("/orgs", organizationRouter)
+}
+
+func SetupInvitationRoutes(m *chi.Mux, limits RateLimits) {
+
+	invitationRouter := chi.NewRouter()
+
+	invitationRouter.Use(limits.Auth)
+
+	invitationRouter.Post("/accept", handlers.AcceptInvitationHandler)
+	invitationRouter.Post("/decline", handlers.DeclineInvitationHandler)
+
+	m.Mount("/invitations", invitationRouter)
+}
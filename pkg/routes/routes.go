@@ -1,11 +1,55 @@
 package routes
 
-import "github.com/go-chi/chi/v5"
+import (
+	"net/http"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
+	"github.com/Adedunmol/zephyr/pkg/ratelimit"
+	"github.com/go-chi/chi/v5"
+)
+
+// RateLimits are the limits applied to each group of routes.
+type RateLimits struct {
+	// Auth covers the public endpoints that check credentials or tokens.
+	Auth func(http.Handler) http.Handler
+	// Mail covers the public endpoints that send emails.
+	Mail func(http.Handler) http.Handler
+	// User covers the authenticated endpoints.
+	User func(http.Handler) http.Handler
+	// Client covers the endpoints called by OAuth clients.
+	Client func(http.Handler) http.Handler
+}
+
+// verifiedEmail enforces REQUIRE_VERIFIED_EMAIL on authenticated routes. Refusing the
+// login isn't enough, as tokens and API keys issued before verification was required
+// are still around.
+func verifiedEmail() func(http.Handler) http.Handler {
+	if helpers.EnvConfig.RequireVerifiedEmail {
+		return middleware.RequireVerifiedEmail
+	}
+
+	return func(next http.Handler) http.Handler { return next }
+}
 
 func SetupRoutes() *chi.Mux {
 	m := chi.NewRouter()
 
-	SetupUserRoutes(m)
+	limits := RateLimits{
+		Auth:   ratelimit.New("auth", 20, time.Minute, ratelimit.KeyByIP).Handler,
+		Mail:   ratelimit.New("mail", 5, 15*time.Minute, ratelimit.KeyByIP).Handler,
+		User:   ratelimit.New("user", 300, time.Minute, ratelimit.KeyByUser).Handler,
+		Client: ratelimit.New("client", 300, time.Minute, ratelimit.KeyByIP).Handler,
+	}
+
+	SetupUserRoutes(m, limits)
+	SetupWellKnownRoutes(m)
+	SetupAdminRoutes(m, limits)
+	SetupOrganizationRoutes(m, limits)
+	SetupInvitationRoutes(m, limits)
+	SetupOAuthRoutes(m, limits)
+	SetupSAMLRoutes(m, limits)
 
 	return m
 }
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"github.com/Adedunmol/zephyr/pkg/handlers"
+	"github.com/go-chi/chi/v5"
+)
+
+func SetupSAMLRoutes(m *chi.Mux, limits RateLimits) {
+
+	samlRouter := chi.NewRouter()
+
+	samlRouter.Get("/{slug}/metadata", handlers.SAMLMetadataHandler)
+
+	samlRouter.Group(func(r chi.Router) {
+		r.Use(limits.Auth)
+
+		r.Get("/{slug}/login", handlers.SAMLLoginHandler)
+		r.Post("/{slug}/acs", handlers.SAMLACSHandler)
+	})
+
+	m.Mount("/saml", samlRouter)
+}
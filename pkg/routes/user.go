@@ -2,15 +2,75 @@ package routes
 
 import (
 	"github.com/Adedunmol/zephyr/pkg/handlers"
+	"github.com/Adedunmol/zephyr/pkg/middleware"
 	"github.com/go-chi/chi/v5"
 )
 
-func SetupUserRoutes(m *chi.Mux) {
+func SetupUserRoutes(m *chi.Mux, limits RateLimits) {
 
 	userRouter := chi.NewRouter()
 
-	userRouter.Post("/register", handlers.CreateUserHandler)
-	userRouter.Post("/login", handlers.LoginUserHandler)
+	userRouter.Group(func(r chi.Router) {
+		r.Use(limits.Auth)
+
+		r.Post("/register", handlers.CreateUserHandler)
+		r.Post("/login", handlers.LoginUserHandler)
+		r.Post("/login/mfa", handlers.LoginMFAHandler)
+		r.Post("/login/mfa/webauthn/begin", handlers.BeginWebAuthnMFAHandler)
+		r.Post("/login/mfa/webauthn/finish", handlers.FinishWebAuthnMFAHandler)
+		r.Post("/login/webauthn/begin", handlers.BeginWebAuthnLoginHandler)
+		r.Post("/login/webauthn/finish", handlers.FinishWebAuthnLoginHandler)
+		r.Post("/refresh", handlers.RefreshTokenHandler)
+		r.Post("/password/reset", handlers.ResetPasswordHandler)
+		r.Get("/verify", handlers.VerifyEmailHandler)
+		r.Get("/magic-link/consume", handlers.ConsumeMagicLinkHandler)
+		r.Get("/oauth/{provider}/login", handlers.OAuthLoginHandler)
+		r.Get("/oauth/{provider}/callback", handlers.OAuthCallbackHandler)
+	})
+
+	userRouter.Group(func(r chi.Router) {
+		r.Use(limits.Mail)
+
+		r.Post("/password/forgot", handlers.ForgotPasswordHandler)
+		r.Post("/verify/resend", handlers.ResendVerificationHandler)
+		r.Post("/magic-link", handlers.MagicLinkHandler)
+	})
+
+	userRouter.Group(func(r chi.Router) {
+		r.Use(middleware.Authenticate)
+		r.Use(middleware.RequireUser)
+		r.Use(verifiedEmail())
+		r.Use(limits.User)
+
+		r.Get("/me", handlers.GetCurrentUserHandler)
+
+		// managing logins and credentials takes a login, not an API key.
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireSession)
+
+			r.Get("/me/sessions", handlers.ListSessionsHandler)
+			r.Delete("/me/sessions/{id}", handlers.RevokeSessionHandler)
+			r.Post("/logout", handlers.LogoutUserHandler)
+			r.Post("/logout-all", handlers.LogoutAllHandler)
+
+			r.Post("/me/api-keys", handlers.CreateAPIKeyHandler)
+			r.Get("/me/api-keys", handlers.ListAPIKeysHandler)
+			r.Delete("/me/api-keys/{id}", handlers.RevokeAPIKeyHandler)
+
+			r.Get("/me/identities", handlers.ListIdentitiesHandler)
+			r.Delete("/me/identities/{id}", handlers.UnlinkIdentityHandler)
+			r.Post("/me/identities/saml/{slug}", handlers.StartSAMLLinkHandler)
+
+			r.Post("/mfa/totp/enroll", handlers.EnrollTOTPHandler)
+			r.Post("/mfa/totp/confirm", handlers.ConfirmTOTPHandler)
+			r.Post("/mfa/totp/disable", handlers.DisableTOTPHandler)
+
+			r.Post("/webauthn/register/begin", handlers.BeginWebAuthnRegistrationHandler)
+			r.Post("/webauthn/register/finish", handlers.FinishWebAuthnRegistrationHandler)
+			r.Get("/webauthn/credentials", handlers.ListWebAuthnCredentialsHandler)
+			r.Delete("/webauthn/credentials/{id}", handlers.DeleteWebAuthnCredentialHandler)
+		})
+	})
 
 	m.Mount("/users", userRouter)
 }
@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"github.com/Adedunmol/zephyr/pkg/handlers"
+	"github.com/go-chi/chi/v5"
+)
+
+func SetupWellKnownRoutes(m *chi.Mux) {
+
+	wellKnownRouter := chi.NewRouter()
+
+	wellKnownRouter.Get("/jwks.json", handlers.JWKSHandler)
+	wellKnownRouter.Get("/openid-configuration", handlers.OpenIDConfigurationHandler)
+
+	m.Mount("/.well-known", wellKnownRouter)
+}
@@ -0,0 +1,376 @@
+// Package saml implements the service provider side of SAML 2.0 single sign-on, on top
+// of github.com/crewjam/saml. Every organization brings its own identity provider, so
+// a Provider is made for each of them from the key pair the ServiceProvider signs and
+// decrypts with.
+package saml
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Adedunmol/zephyr/pkg/helpers"
+	gosaml "github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+var (
+	ErrInvalidResponse    = errors.New("invalid SAML response")
+	ErrMissingEmail       = errors.New("SAML assertion has no email address")
+	ErrTransientNameID    = errors.New("SAML assertion has a transient name ID")
+	ErrInvalidCertificate = errors.New("not a PEM encoded certificate")
+	ErrDomainUnverified   = errors.New("domain ownership not verified")
+)
+
+// Default is the service provider of every organization. It is nil until a key pair
+// is configured, which leaves SAML sign-in off.
+var Default *ServiceProvider
+
+// defaults for the attribute mapping of identity providers, as sent by Okta and most
+// others. Azure AD and ADFS send claim URIs instead, which have to be mapped.
+const (
+	DEFAULT_EMAIL_ATTRIBUTE      = "email"
+	DEFAULT_USERNAME_ATTRIBUTE   = "username"
+	DEFAULT_FIRST_NAME_ATTRIBUTE = "firstName"
+	DEFAULT_LAST_NAME_ATTRIBUTE  = "lastName"
+)
+
+// DOMAIN_VERIFICATION_RECORD prefixes the domain an organization proves it owns to
+// name the TXT record holding its challenge.
+const DOMAIN_VERIFICATION_RECORD = "_zephyr-verification."
+
+// ServiceProvider holds the key pair authentication requests are signed with and
+// assertions encrypted for.
+type ServiceProvider struct {
+	Key         *rsa.PrivateKey
+	Certificate *x509.Certificate
+}
+
+// FromConfig loads the key pair in the SAML_CERTIFICATE and SAML_KEY files.
+func FromConfig() (*ServiceProvider, error) {
+	config := helpers.EnvConfig
+
+	if config.SAMLCertificate == "" || config.SAMLKey == "" {
+		return nil, errors.New("SAML_CERTIFICATE and SAML_KEY are required")
+	}
+
+	pair, err := tls.LoadX509KeyPair(config.SAMLCertificate, config.SAMLKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+
+	if !ok {
+		return nil, errors.New("SAML_KEY must be an RSA key")
+	}
+
+	certificate, err := x509.ParseCertificate(pair.Certificate[0])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServiceProvider{Key: key, Certificate: certificate}, nil
+}
+
+// IdentityProvider is the identity provider of an organization, as its administrators
+// copy it from the provider's metadata.
+type IdentityProvider struct {
+	EntityID string
+	SSOURL   string
+	// Certificate is the PEM encoded certificate assertions are signed with.
+	Certificate string
+}
+
+// AttributeMapping names the assertion attributes read into an Identity. Attributes
+// are matched on their name or friendly name, and empty names use the defaults.
+type AttributeMapping struct {
+	Email     string
+	Username  string
+	FirstName string
+	LastName  string
+}
+
+// Identity is the user an identity provider vouches for.
+type Identity struct {
+	// Subject is the persistent name ID of the user at the identity provider.
+	Subject   string
+	Email     string
+	Username  string
+	FirstName string
+	LastName  string
+}
+
+// Provider signs the users of one organization in with its identity provider.
+type Provider struct {
+	sp         gosaml.ServiceProvider
+	attributes AttributeMapping
+}
+
+// ParseCertificate decodes the PEM encoded certificate of an identity provider.
+func ParseCertificate(data string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(data)))
+
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, ErrInvalidCertificate
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// serviceProvider returns the service provider whose metadata is served at
+// metadataURL and whose assertion consumer service is at acsURL. The metadata URL
+// doubles as the entity ID, which is the audience assertions must be meant for.
+func (s *ServiceProvider) serviceProvider(metadataURL, acsURL string) (*gosaml.ServiceProvider, error) {
+	metadata, err := url.Parse(metadataURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	acs, err := url.Parse(acsURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &gosaml.ServiceProvider{
+		EntityID:          metadataURL,
+		Key:               s.Key,
+		Certificate:       s.Certificate,
+		MetadataURL:       *metadata,
+		AcsURL:            *acs,
+		AuthnNameIDFormat: gosaml.UnspecifiedNameIDFormat,
+		SignatureMethod:   dsig.RSASHA256SignatureMethod,
+	}, nil
+}
+
+// Metadata returns the XML metadata of the service provider at metadataURL, which
+// identity providers are configured with. It doesn't depend on the identity provider,
+// which may not be known yet.
+func (s *ServiceProvider) Metadata(metadataURL, acsURL string) ([]byte, error) {
+	sp, err := s.serviceProvider(metadataURL, acsURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), metadata...), nil
+}
+
+// Provider returns the provider signing users in with idp through the service
+// provider at metadataURL.
+func (s *ServiceProvider) Provider(metadataURL, acsURL string, idp IdentityProvider, attributes AttributeMapping) (*Provider, error) {
+	certificate, err := ParseCertificate(idp.Certificate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sp, err := s.serviceProvider(metadataURL, acsURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sp.IDPMetadata = identityProviderMetadata(idp, certificate)
+
+	return &Provider{sp: *sp, attributes: attributes}, nil
+}
+
+func identityProviderMetadata(idp IdentityProvider, certificate *x509.Certificate) *gosaml.EntityDescriptor {
+	return &gosaml.EntityDescriptor{
+		EntityID: idp.EntityID,
+		IDPSSODescriptors: []gosaml.IDPSSODescriptor{{
+			SSODescriptor: gosaml.SSODescriptor{
+				RoleDescriptor: gosaml.RoleDescriptor{
+					ProtocolSupportEnumeration: "urn:oasis:names:tc:SAML:2.0:protocol",
+					KeyDescriptors: []gosaml.KeyDescriptor{{
+						Use: "signing",
+						KeyInfo: gosaml.KeyInfo{X509Data: gosaml.X509Data{X509Certificates: []gosaml.X509Certificate{
+							{Data: base64.StdEncoding.EncodeToString(certificate.Raw)},
+						}}},
+					}},
+				},
+			},
+			SingleSignOnServices: []gosaml.Endpoint{{Binding: gosaml.HTTPRedirectBinding, Location: idp.SSOURL}},
+		}},
+	}
+}
+
+// AuthnRequestURL returns the URL sending the user to the identity provider with a
+// signed authentication request, using the HTTP-Redirect binding. The request gets a
+// random ID unless requestID is given; either way the ID has to be kept until the
+// response comes back.
+func (p *Provider) AuthnRequestURL(requestID, relayState string) (*url.URL, string, error) {
+	request, err := p.sp.MakeAuthenticationRequest(p.sp.GetSSOBindingLocation(gosaml.HTTPRedirectBinding), gosaml.HTTPRedirectBinding, gosaml.HTTPPostBinding)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if requestID != "" {
+		request.ID = requestID
+	}
+
+	redirect, err := request.Redirect(relayState, &p.sp)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return redirect, request.ID, nil
+}
+
+// ParseResponse checks the response posted to the assertion consumer service, which
+// must answer the request with requestID: its signature, issuer, audience, recipient
+// and validity period. Errors other than ErrMissingEmail and ErrTransientNameID wrap
+// ErrInvalidResponse.
+func (p *Provider) ParseResponse(r *http.Request, requestID string) (*Identity, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	// artifacts would have us call the identity provider, which isn't configured.
+	if r.PostForm.Get("SAMLResponse") == "" {
+		return nil, fmt.Errorf("%w: no SAMLResponse", ErrInvalidResponse)
+	}
+
+	assertion, err := p.sp.ParseResponse(r, []string{requestID})
+
+	if err != nil {
+		var invalid *gosaml.InvalidResponseError
+
+		if errors.As(err, &invalid) {
+			err = invalid.PrivateErr
+		}
+
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	return p.identity(assertion)
+}
+
+func (p *Provider) identity(assertion *gosaml.Assertion) (*Identity, error) {
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value == "" {
+		return nil, fmt.Errorf("%w: no name ID", ErrInvalidResponse)
+	}
+
+	nameID := assertion.Subject.NameID
+
+	// transient IDs change on every sign-in, so they can't be linked to an account.
+	if nameID.Format == string(gosaml.TransientNameIDFormat) {
+		return nil, ErrTransientNameID
+	}
+
+	identity := &Identity{
+		Subject:   nameID.Value,
+		Email:     attribute(assertion, p.attributes.Email, DEFAULT_EMAIL_ATTRIBUTE),
+		Username:  attribute(assertion, p.attributes.Username, DEFAULT_USERNAME_ATTRIBUTE),
+		FirstName: attribute(assertion, p.attributes.FirstName, DEFAULT_FIRST_NAME_ATTRIBUTE),
+		LastName:  attribute(assertion, p.attributes.LastName, DEFAULT_LAST_NAME_ATTRIBUTE),
+	}
+
+	if identity.Email == "" && nameID.Format == string(gosaml.EmailAddressNameIDFormat) {
+		identity.Email = nameID.Value
+	}
+
+	if identity.Email == "" {
+		return nil, ErrMissingEmail
+	}
+
+	if identity.Username == "" {
+		identity.Username, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	return identity, nil
+}
+
+// attribute returns the first value of the attribute called name, or fallback when
+// name is empty.
+func attribute(assertion *gosaml.Assertion, name, fallback string) string {
+	if name == "" {
+		name = fallback
+	}
+
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			if (attribute.Name == name || attribute.FriendlyName == name) && len(attribute.Values) > 0 {
+				return strings.TrimSpace(attribute.Values[0].Value)
+			}
+		}
+	}
+
+	return ""
+}
+
+// Resolver looks up the TXT records of a name, as net.DefaultResolver does.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DomainChallenge returns the TXT record value proving that organization owns domain.
+// It is derived from secret, so it doesn't have to be stored and can't be guessed by
+// other organizations.
+func DomainChallenge(secret string, organization uint, domain string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d:%s", organization, strings.ToLower(domain))
+
+	return "zephyr-verification=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyDomain checks that the verification record of domain holds challenge.
+// Failures wrap ErrDomainUnverified.
+func VerifyDomain(ctx context.Context, resolver Resolver, domain, challenge string) error {
+	records, err := resolver.LookupTXT(ctx, DOMAIN_VERIFICATION_RECORD+domain)
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDomainUnverified, err)
+	}
+
+	for _, record := range records {
+		if strings.TrimSpace(record) == challenge {
+			return nil
+		}
+	}
+
+	return ErrDomainUnverified
+}
+
+// EmailInDomains reports whether email is an address at one of domains. Subdomains
+// have to be listed on their own.
+func EmailInDomains(email string, domains []string) bool {
+	at := strings.LastIndex(email, "@")
+
+	if at < 0 {
+		return false
+	}
+
+	for _, domain := range domains {
+		if strings.EqualFold(email[at+1:], domain) {
+			return true
+		}
+	}
+
+	return false
+}
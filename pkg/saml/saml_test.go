@@ -0,0 +1,398 @@
+package saml
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	gosaml "github.com/crewjam/saml"
+)
+
+const checkMark = "\u2713"
+const ballotX = "\u2717"
+
+const (
+	idpEntityID = "https://idp.example.com/metadata"
+	metadataURL = "https://zephyr.example.com/saml/acme/metadata"
+	acsURL      = "https://zephyr.example.com/saml/acme/acs"
+)
+
+func newKeyPair(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal("Should be able to generate a key.", ballotX, err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "zephyr test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal("Should be able to create a certificate.", ballotX, err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+
+	if err != nil {
+		t.Fatal("Should be able to parse the certificate.", ballotX, err)
+	}
+
+	return key, certificate
+}
+
+func encodeCertificate(certificate *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw}))
+}
+
+func newIdentityProvider(t *testing.T) *gosaml.IdentityProvider {
+	key, certificate := newKeyPair(t)
+
+	metadata, _ := url.Parse(idpEntityID)
+	sso, _ := url.Parse("https://idp.example.com/sso")
+
+	return &gosaml.IdentityProvider{Key: key, Certificate: certificate, MetadataURL: *metadata, SSOURL: *sso}
+}
+
+func newProvider(t *testing.T, sp *ServiceProvider, metadata string, idp *gosaml.IdentityProvider, attributes AttributeMapping) *Provider {
+	provider, err := sp.Provider(metadata, acsURL, IdentityProvider{
+		EntityID:    idpEntityID,
+		SSOURL:      idp.SSOURL.String(),
+		Certificate: encodeCertificate(idp.Certificate),
+	}, attributes)
+
+	if err != nil {
+		t.Fatal("Should be able to make the provider.", ballotX, err)
+	}
+
+	return provider
+}
+
+func stringAttribute(name, value string) gosaml.Attribute {
+	return gosaml.Attribute{Name: name, Values: []gosaml.AttributeValue{{Type: "xs:string", Value: value}}}
+}
+
+// respond has idp answer the request with requestID, as it would at now, and returns
+// the response posted back to the assertion consumer service of provider.
+func respond(t *testing.T, idp *gosaml.IdentityProvider, provider *Provider, requestID string, now time.Time, session *gosaml.Session) *http.Request {
+	metadata := provider.sp.Metadata()
+
+	request := &gosaml.IdpAuthnRequest{
+		IDP:                     idp,
+		HTTPRequest:             httptest.NewRequest(http.MethodGet, "/sso", nil),
+		Request:                 gosaml.AuthnRequest{ID: requestID, IssueInstant: now},
+		ServiceProviderMetadata: metadata,
+		SPSSODescriptor:         &metadata.SPSSODescriptors[0],
+		ACSEndpoint:             &gosaml.IndexedEndpoint{Binding: gosaml.HTTPPostBinding, Location: acsURL},
+		Now:                     now,
+	}
+
+	if err := (gosaml.DefaultAssertionMaker{}).MakeAssertion(request, session); err != nil {
+		t.Fatal("Should be able to make the assertion.", ballotX, err)
+	}
+
+	if err := request.MakeResponse(); err != nil {
+		t.Fatal("Should be able to make the response.", ballotX, err)
+	}
+
+	doc := etree.NewDocument()
+	doc.SetRoot(request.ResponseEl)
+
+	body, err := doc.WriteToBytes()
+
+	if err != nil {
+		t.Fatal("Should be able to write the response.", ballotX, err)
+	}
+
+	form := url.Values{"SAMLResponse": {base64.StdEncoding.EncodeToString(body)}}
+
+	r := httptest.NewRequest(http.MethodPost, acsURL, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return r
+}
+
+func newSession(attributes ...gosaml.Attribute) *gosaml.Session {
+	return &gosaml.Session{
+		NameID:           "00u1ada",
+		NameIDFormat:     string(gosaml.PersistentNameIDFormat),
+		CreateTime:       time.Now(),
+		CustomAttributes: attributes,
+	}
+}
+
+func TestProvider(t *testing.T) {
+	key, certificate := newKeyPair(t)
+	sp := &ServiceProvider{Key: key, Certificate: certificate}
+	idp := newIdentityProvider(t)
+	provider := newProvider(t, sp, metadataURL, idp, AttributeMapping{})
+
+	t.Log("Given the need to test signing in with an organization's identity provider.")
+	{
+		t.Log("\tWhen serving the service provider metadata.")
+		{
+			metadata, err := sp.Metadata(metadataURL, acsURL)
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to marshal the metadata.", ballotX, err)
+			}
+
+			if !strings.Contains(string(metadata), `entityID="`+metadataURL+`"`) || !strings.Contains(string(metadata), `Location="`+acsURL+`"`) {
+				t.Errorf("\t\tShould describe the entity ID and assertion consumer service, but got %s. %v", metadata, ballotX)
+			}
+			t.Log("\t\tShould describe the entity ID and assertion consumer service.", checkMark)
+
+			if !strings.Contains(string(metadata), base64.StdEncoding.EncodeToString(certificate.Raw)) {
+				t.Errorf("\t\tShould publish the service provider certificate. %v", ballotX)
+			}
+			t.Log("\t\tShould publish the service provider certificate.", checkMark)
+		}
+
+		t.Log("\tWhen sending the user to the identity provider.")
+		{
+			redirect, requestID, err := provider.AuthnRequestURL("", "state")
+
+			if err != nil {
+				t.Fatal("\t\tShould be able to make the request.", ballotX, err)
+			}
+
+			query := redirect.Query()
+
+			if redirect.Host != "idp.example.com" || query.Get("SAMLRequest") == "" || query.Get("RelayState") != "state" {
+				t.Errorf("\t\tShould redirect to the SSO URL with the request, but got %s. %v", redirect, ballotX)
+			}
+			t.Log("\t\tShould redirect to the SSO URL with the request.", checkMark)
+
+			if query.Get("Signature") == "" || query.Get("SigAlg") == "" {
+				t.Errorf("\t\tShould sign the request. %v", ballotX)
+			}
+			t.Log("\t\tShould sign the request.", checkMark)
+
+			if requestID == "" {
+				t.Errorf("\t\tShould return the request ID. %v", ballotX)
+			}
+			t.Log("\t\tShould return the request ID.", checkMark)
+
+			_, requestID, err = provider.AuthnRequestURL("id-given", "")
+
+			if err != nil || requestID != "id-given" {
+				t.Errorf("\t\tShould use the request ID it is given, but got %q %v. %v", requestID, err, ballotX)
+			}
+			t.Log("\t\tShould use the request ID it is given.", checkMark)
+		}
+
+		t.Log("\tWhen the identity provider answers with a valid response.")
+		{
+			r := respond(t, idp, provider, "id-request", time.Now(), newSession(
+				stringAttribute("email", "ada@example.com"),
+				stringAttribute("firstName", "Ada"),
+				stringAttribute("lastName", "Lovelace"),
+			))
+
+			identity, err := provider.ParseResponse(r, "id-request")
+
+			if err != nil {
+				t.Fatal("\t\tShould accept the response.", ballotX, err)
+			}
+			t.Log("\t\tShould accept the response.", checkMark)
+
+			want := Identity{Subject: "00u1ada", Email: "ada@example.com", Username: "ada", FirstName: "Ada", LastName: "Lovelace"}
+
+			if *identity != want {
+				t.Errorf("\t\tShould map the attributes, but got %+v. %v", identity, ballotX)
+			}
+			t.Log("\t\tShould map the attributes.", checkMark)
+		}
+
+		t.Log("\tWhen the identity provider answers another request.")
+		{
+			r := respond(t, idp, provider, "id-other", time.Now(), newSession(stringAttribute("email", "ada@example.com")))
+
+			if _, err := provider.ParseResponse(r, "id-request"); !errors.Is(err, ErrInvalidResponse) {
+				t.Errorf("\t\tShould reject the response, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould reject the response.", checkMark)
+		}
+
+		t.Log("\tWhen the response is signed with another key.")
+		{
+			impostor := newIdentityProvider(t)
+
+			r := respond(t, impostor, provider, "id-request", time.Now(), newSession(stringAttribute("email", "ada@example.com")))
+
+			if _, err := provider.ParseResponse(r, "id-request"); !errors.Is(err, ErrInvalidResponse) {
+				t.Errorf("\t\tShould reject the response, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould reject the response.", checkMark)
+		}
+
+		t.Log("\tWhen the assertion is meant for another service provider.")
+		{
+			other := newProvider(t, sp, "https://zephyr.example.com/saml/globex/metadata", idp, AttributeMapping{})
+
+			r := respond(t, idp, other, "id-request", time.Now(), newSession(stringAttribute("email", "ada@example.com")))
+
+			if _, err := provider.ParseResponse(r, "id-request"); err == nil || !strings.Contains(err.Error(), "AudienceRestriction") {
+				t.Errorf("\t\tShould reject the audience, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould reject the audience.", checkMark)
+		}
+
+		t.Log("\tWhen the response has expired.")
+		{
+			r := respond(t, idp, provider, "id-request", time.Now().Add(-time.Hour), newSession(stringAttribute("email", "ada@example.com")))
+
+			if _, err := provider.ParseResponse(r, "id-request"); !errors.Is(err, ErrInvalidResponse) {
+				t.Errorf("\t\tShould reject the response, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould reject the response.", checkMark)
+		}
+
+		t.Log("\tWhen the name ID is transient.")
+		{
+			session := newSession(stringAttribute("email", "ada@example.com"))
+			session.NameIDFormat = string(gosaml.TransientNameIDFormat)
+
+			r := respond(t, idp, provider, "id-request", time.Now(), session)
+
+			if _, err := provider.ParseResponse(r, "id-request"); !errors.Is(err, ErrTransientNameID) {
+				t.Errorf("\t\tShould reject the name ID, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould reject the name ID.", checkMark)
+		}
+
+		t.Log("\tWhen the identity provider sends claim URIs.")
+		{
+			claims := "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/"
+
+			mapped := newProvider(t, sp, metadataURL, idp, AttributeMapping{FirstName: claims + "givenname", LastName: claims + "surname"})
+
+			session := newSession(stringAttribute(claims+"givenname", "Ada"), stringAttribute(claims+"surname", "Lovelace"))
+			session.NameID = "ada@example.com"
+			session.NameIDFormat = string(gosaml.EmailAddressNameIDFormat)
+
+			r := respond(t, idp, mapped, "id-request", time.Now(), session)
+
+			identity, err := mapped.ParseResponse(r, "id-request")
+
+			if err != nil {
+				t.Fatal("\t\tShould accept the response.", ballotX, err)
+			}
+
+			if identity.FirstName != "Ada" || identity.LastName != "Lovelace" {
+				t.Errorf("\t\tShould read the mapped attributes, but got %+v. %v", identity, ballotX)
+			}
+			t.Log("\t\tShould read the mapped attributes.", checkMark)
+
+			if identity.Email != "ada@example.com" {
+				t.Errorf("\t\tShould take the email from the name ID, but got %q. %v", identity.Email, ballotX)
+			}
+			t.Log("\t\tShould take the email from the name ID.", checkMark)
+		}
+
+		t.Log("\tWhen the certificate isn't PEM encoded.")
+		{
+			_, err := sp.Provider(metadataURL, acsURL, IdentityProvider{EntityID: idpEntityID, SSOURL: "https://idp.example.com/sso", Certificate: "MIIB"}, AttributeMapping{})
+
+			if !errors.Is(err, ErrInvalidCertificate) {
+				t.Errorf("\t\tShould refuse the certificate, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould refuse the certificate.", checkMark)
+		}
+	}
+}
+
+type resolver map[string][]string
+
+func (r resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, ok := r[name]
+
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+
+	return records, nil
+}
+
+func TestDomains(t *testing.T) {
+	challenge := DomainChallenge("secret", 1, "acme.com")
+
+	t.Log("Given the need to test domain verification.")
+	{
+		t.Log("\tWhen deriving challenges.")
+		{
+			if DomainChallenge("secret", 1, "ACME.com") != challenge {
+				t.Errorf("\t\tShould ignore the case of the domain. %v", ballotX)
+			}
+			t.Log("\t\tShould ignore the case of the domain.", checkMark)
+
+			if DomainChallenge("secret", 2, "acme.com") == challenge {
+				t.Errorf("\t\tShould give other organizations another challenge. %v", ballotX)
+			}
+			t.Log("\t\tShould give other organizations another challenge.", checkMark)
+		}
+
+		t.Log("\tWhen the verification record holds the challenge.")
+		{
+			records := resolver{DOMAIN_VERIFICATION_RECORD + "acme.com": {"v=spf1 -all", challenge}}
+
+			if err := VerifyDomain(context.Background(), records, "acme.com", challenge); err != nil {
+				t.Fatalf("\t\tShould verify the domain: %v %v", err, ballotX)
+			}
+			t.Log("\t\tShould verify the domain.", checkMark)
+		}
+
+		t.Log("\tWhen the verification record holds another challenge.")
+		{
+			records := resolver{DOMAIN_VERIFICATION_RECORD + "acme.com": {DomainChallenge("secret", 2, "acme.com")}}
+
+			if err := VerifyDomain(context.Background(), records, "acme.com", challenge); !errors.Is(err, ErrDomainUnverified) {
+				t.Errorf("\t\tShould return ErrDomainUnverified, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould return ErrDomainUnverified.", checkMark)
+		}
+
+		t.Log("\tWhen there is no verification record.")
+		{
+			if err := VerifyDomain(context.Background(), resolver{}, "acme.com", challenge); !errors.Is(err, ErrDomainUnverified) {
+				t.Errorf("\t\tShould return ErrDomainUnverified, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould return ErrDomainUnverified.", checkMark)
+		}
+
+		t.Log("\tWhen matching emails against domains.")
+		{
+			domains := []string{"acme.com"}
+
+			if !EmailInDomains("ada@ACME.com", domains) {
+				t.Errorf("\t\tShould accept addresses at a domain in any case. %v", ballotX)
+			}
+			t.Log("\t\tShould accept addresses at a domain in any case.", checkMark)
+
+			for _, email := range []string{"ada@mail.acme.com", "ada@acme.com.evil.io", "ada@notacme.com", "acme.com"} {
+				if EmailInDomains(email, domains) {
+					t.Errorf("\t\tShould reject %s. %v", email, ballotX)
+				}
+				t.Logf("\t\tShould reject %s. %v", email, checkMark)
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Adedunmol/zephyr/pkg/models"
+	"github.com/go-playground/validator/v10"
+)
+
+type CreateAPIKey struct {
+	Name      string     `json:"name" validate:"required,max=64"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (u *CreateAPIKey) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	if err := v.Struct(u); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+
+			switch err.Tag() {
+			case "required":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' cannot be blank", err.Field())
+				problems[field] = message
+			case "max":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' must be at most %v characters long", err.Field(), err.Param())
+				problems[field] = message
+			case "min":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' must have at least %v item", err.Field(), err.Param())
+				problems[field] = message
+			default:
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s': '%v' must satisfy '%s' '%v' criteria", err.Field(), err.Value(), err.Tag(), err.Param())
+				problems[field] = message
+			}
+		}
+	}
+
+	// permission scopes only narrow what read or write access allows, so a key
+	// without either would be refused on every request.
+	if len(u.Scopes) > 0 && !slices.Contains(u.Scopes, models.ReadScope) && !slices.Contains(u.Scopes, models.WriteScope) {
+		problems["Scopes"] = "Field 'Scopes' must include read or write"
+	}
+
+	if u.ExpiresAt != nil && !u.ExpiresAt.After(time.Now()) {
+		problems["ExpiresAt"] = "Field 'ExpiresAt' must be in the future"
+	}
+
+	return problems
+}
@@ -0,0 +1,96 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type CreateClient struct {
+	Name         string   `json:"name" validate:"required,max=64"`
+	RedirectURIs []string `json:"redirect_uris" validate:"omitempty,dive,url"`
+	Scopes       []string `json:"scopes" validate:"required,min=1"`
+	// GrantTypes default to authorization_code, for clients signing users in.
+	GrantTypes []string `json:"grant_types" validate:"omitempty,dive,oneof=authorization_code client_credentials"`
+	// Confidential clients get a secret, public ones rely on PKCE alone.
+	Confidential bool `json:"confidential"`
+}
+
+// Grants returns the grant types the client is registered for.
+func (u *CreateClient) Grants() []string {
+	if len(u.GrantTypes) == 0 {
+		return []string{"authorization_code"}
+	}
+
+	return u.GrantTypes
+}
+
+func (u *CreateClient) grants(grantType string) bool {
+	for _, grant := range u.Grants() {
+		if grant == grantType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (u *CreateClient) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	if err := v.Struct(u); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+
+			switch err.Tag() {
+			case "required":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' cannot be blank", err.Field())
+				problems[field] = message
+			case "max":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' must be at most %v characters long", err.Field(), err.Param())
+				problems[field] = message
+			case "min":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' must have at least %v item", err.Field(), err.Param())
+				problems[field] = message
+			case "url":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' must be a valid URL", err.Field())
+				problems[field] = message
+			case "oneof":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' must be one of: %v", err.Field(), err.Param())
+				problems[field] = message
+			default:
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s': '%v' must satisfy '%s' '%v' criteria", err.Field(), err.Value(), err.Tag(), err.Param())
+				problems[field] = message
+			}
+		}
+	}
+
+	if u.grants("authorization_code") && len(u.RedirectURIs) == 0 {
+		problems["RedirectURIs"] = "Field 'RedirectURIs' cannot be blank"
+	}
+
+	// a service authenticates with nothing but its secret.
+	if u.grants("client_credentials") && !u.Confidential {
+		problems["Confidential"] = "Field 'Confidential' must be set for the client_credentials grant"
+	}
+
+	// redirect URIs are matched exactly and sent back with the code in the query.
+	for i, uri := range u.RedirectURIs {
+		if parsed, err := url.Parse(uri); err == nil && (parsed.Fragment != "" || strings.ContainsAny(uri, " #")) {
+			field := fmt.Sprintf("RedirectURIs[%d]", i)
+			problems[field] = fmt.Sprintf("Field '%s' must not contain a fragment or spaces", field)
+		}
+	}
+
+	return problems
+}
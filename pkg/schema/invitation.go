@@ -0,0 +1,105 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type CreateInvitation struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=admin member"`
+}
+
+func (u *CreateInvitation) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	if err := v.Struct(u); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+
+			switch err.Tag() {
+			case "required":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' cannot be blank", err.Field())
+				problems[field] = message
+			case "email":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' must be a valid email address", err.Field())
+				problems[field] = message
+			case "oneof":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' must be one of: %v", err.Field(), err.Param())
+				problems[field] = message
+			default:
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s': '%v' must satisfy '%s' '%v' criteria", err.Field(), err.Value(), err.Tag(), err.Param())
+				problems[field] = message
+			}
+		}
+	}
+
+	return problems
+}
+
+// AcceptInvitation carries the invitation token and, when the invited email has no
+// account yet, the details to register one with. User is validated as a CreateUser
+// once its email has been taken from the invitation.
+type AcceptInvitation struct {
+	Token string      `json:"token" validate:"required"`
+	User  *CreateUser `json:"user" validate:"-"`
+}
+
+func (u *AcceptInvitation) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	if err := v.Struct(u); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+
+			switch err.Tag() {
+			case "required":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' cannot be blank", err.Field())
+				problems[field] = message
+			default:
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s': '%v' must satisfy '%s' '%v' criteria", err.Field(), err.Value(), err.Tag(), err.Param())
+				problems[field] = message
+			}
+		}
+	}
+
+	return problems
+}
+
+type DeclineInvitation struct {
+	Token string `json:"token" validate:"required"`
+}
+
+func (u *DeclineInvitation) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	if err := v.Struct(u); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+
+			switch err.Tag() {
+			case "required":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' cannot be blank", err.Field())
+				problems[field] = message
+			default:
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s': '%v' must satisfy '%s' '%v' criteria", err.Field(), err.Value(), err.Tag(), err.Param())
+				problems[field] = message
+			}
+		}
+	}
+
+	return problems
+}
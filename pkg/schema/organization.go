@@ -0,0 +1,41 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type CreateOrganization struct {
+	Name string `json:"name" validate:"required,max=100"`
+	Slug string `json:"slug" validate:"omitempty,max=64,lowercase"`
+}
+
+func (u *CreateOrganization) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	if err := v.Struct(u); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+
+			switch err.Tag() {
+			case "required":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' cannot be blank", err.Field())
+				problems[field] = message
+			case "max":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' must be at most %v characters long", err.Field(), err.Param())
+				problems[field] = message
+			default:
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s': '%v' must satisfy '%s' '%v' criteria", err.Field(), err.Value(), err.Tag(), err.Param())
+				problems[field] = message
+			}
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,84 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Adedunmol/zephyr/pkg/password"
+	"github.com/go-playground/validator/v10"
+)
+
+// CheckPassword adds a problem for field to problems when plaintext breaks the
+// password policy. Fields that already have a problem are left alone.
+func CheckPassword(problems map[string]string, field, plaintext string, userInputs ...string) map[string]string {
+	if _, ok := problems[field]; ok {
+		return problems
+	}
+
+	if err := password.CheckPolicy(plaintext, userInputs...); err != nil {
+		problems[field] = fmt.Sprintf("Field '%s' %v", field, err)
+	}
+
+	return problems
+}
+
+type ForgotPassword struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+func (u *ForgotPassword) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	if err := v.Struct(u); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+
+			switch err.Tag() {
+			case "required":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' cannot be blank", err.Field())
+				problems[field] = message
+			case "email":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' must be a valid email address", err.Field())
+				problems[field] = message
+			default:
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s': '%v' must satisfy '%s' '%v' criteria", err.Field(), err.Value(), err.Tag(), err.Param())
+				problems[field] = message
+			}
+		}
+	}
+
+	return problems
+}
+
+type ResetPassword struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+func (u *ResetPassword) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	if err := v.Struct(u); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+
+			switch err.Tag() {
+			case "required":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' cannot be blank", err.Field())
+				problems[field] = message
+			default:
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s': '%v' must satisfy '%s' '%v' criteria", err.Field(), err.Value(), err.Tag(), err.Param())
+				problems[field] = message
+			}
+		}
+	}
+
+	return CheckPassword(problems, "Password", u.Password)
+}
@@ -0,0 +1,67 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ConfigureSAML describes the identity provider of an organization, as found in its
+// metadata. The attributes are only needed when the provider doesn't send the
+// default ones. Each of the Domains has to publish its verification record.
+type ConfigureSAML struct {
+	EntityID           string   `json:"entity_id" validate:"required,max=255"`
+	SSOURL             string   `json:"sso_url" validate:"required,url"`
+	Certificate        string   `json:"certificate" validate:"required"`
+	Domains            []string `json:"domains" validate:"required,min=1,dive,fqdn"`
+	EmailAttribute     string   `json:"email_attribute" validate:"omitempty,max=255"`
+	UsernameAttribute  string   `json:"username_attribute" validate:"omitempty,max=255"`
+	FirstNameAttribute string   `json:"first_name_attribute" validate:"omitempty,max=255"`
+	LastNameAttribute  string   `json:"last_name_attribute" validate:"omitempty,max=255"`
+	DefaultRole        string   `json:"default_role" validate:"omitempty,oneof=admin member"`
+}
+
+func (u *ConfigureSAML) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	if err := v.Struct(u); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+
+			switch err.Tag() {
+			case "required":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' cannot be blank", err.Field())
+				problems[field] = message
+			case "max":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' must be at most %v characters long", err.Field(), err.Param())
+				problems[field] = message
+			case "url":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' must be a valid URL", err.Field())
+				problems[field] = message
+			case "min":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' must have at least %v entries", err.Field(), err.Param())
+				problems[field] = message
+			case "fqdn":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' must be a domain name", err.Field())
+				problems[field] = message
+			case "oneof":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' must be one of: %v", err.Field(), err.Param())
+				problems[field] = message
+			default:
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s': '%v' must satisfy '%s' '%v' criteria", err.Field(), err.Value(), err.Tag(), err.Param())
+				problems[field] = message
+			}
+		}
+	}
+
+	return problems
+}
@@ -11,7 +11,7 @@ type CreateUser struct {
 	FirstName string `json:"first_name" validate:"required"`
 	LastName  string `json:"last_name" validate:"required"`
 	Username  string `json:"username" validate:"required"`
-	Password  string `json:"password" validate:"required,min=6"`
+	Password  string `json:"password" validate:"required"`
 	Email     string `json:"email" validate:"required,email"`
 }
 
@@ -44,7 +44,7 @@ func (u *CreateUser) Valid(ctx context.Context) (problems map[string]string) {
 		}
 	}
 
-	return problems
+	return CheckPassword(problems, "Password", u.Password, u.Username, u.Email)
 }
 
 type LoginUser struct {
@@ -0,0 +1,130 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Adedunmol/zephyr/pkg/webauthn"
+	"github.com/go-playground/validator/v10"
+)
+
+type WebAuthnRegistration struct {
+	SessionID  string                         `json:"session_id" validate:"required"`
+	Name       string                         `json:"name" validate:"max=64"`
+	Credential *webauthn.RegistrationResponse `json:"credential" validate:"required"`
+}
+
+func (u *WebAuthnRegistration) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	if err := v.Struct(u); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+
+			switch err.Tag() {
+			case "required":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' cannot be blank", err.Field())
+				problems[field] = message
+			case "max":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' must be at most %v characters long", err.Field(), err.Param())
+				problems[field] = message
+			default:
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s': '%v' must satisfy '%s' '%v' criteria", err.Field(), err.Value(), err.Tag(), err.Param())
+				problems[field] = message
+			}
+		}
+	}
+
+	return problems
+}
+
+type WebAuthnLogin struct {
+	SessionID  string                      `json:"session_id" validate:"required"`
+	Credential *webauthn.AssertionResponse `json:"credential" validate:"required"`
+}
+
+func (u *WebAuthnLogin) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	if err := v.Struct(u); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+
+			switch err.Tag() {
+			case "required":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' cannot be blank", err.Field())
+				problems[field] = message
+			default:
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s': '%v' must satisfy '%s' '%v' criteria", err.Field(), err.Value(), err.Tag(), err.Param())
+				problems[field] = message
+			}
+		}
+	}
+
+	return problems
+}
+
+type MFAToken struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+}
+
+func (u *MFAToken) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	if err := v.Struct(u); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+
+			switch err.Tag() {
+			case "required":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' cannot be blank", err.Field())
+				problems[field] = message
+			default:
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s': '%v' must satisfy '%s' '%v' criteria", err.Field(), err.Value(), err.Tag(), err.Param())
+				problems[field] = message
+			}
+		}
+	}
+
+	return problems
+}
+
+type WebAuthnMFA struct {
+	MFAToken   string                      `json:"mfa_token" validate:"required"`
+	SessionID  string                      `json:"session_id" validate:"required"`
+	Credential *webauthn.AssertionResponse `json:"credential" validate:"required"`
+}
+
+func (u *WebAuthnMFA) Valid(ctx context.Context) (problems map[string]string) {
+	problems = make(map[string]string)
+
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	if err := v.Struct(u); err != nil {
+		for _, err := range err.(validator.ValidationErrors) {
+
+			switch err.Tag() {
+			case "required":
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s' cannot be blank", err.Field())
+				problems[field] = message
+			default:
+				field := err.Field()
+				message := fmt.Sprintf("Field '%s': '%v' must satisfy '%s' '%v' criteria", err.Field(), err.Value(), err.Tag(), err.Param())
+				problems[field] = message
+			}
+		}
+	}
+
+	return problems
+}
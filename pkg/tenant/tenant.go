@@ -0,0 +1,171 @@
+// Package tenant keeps the data of one organization out of reach of the others. Models
+// embedding Owned are tenant-owned: once the Plugin is registered, every query, update
+// and delete on them is filtered by the organization on the statement's context, and
+// new rows are stamped with it. Statements on tenant-owned tables without an
+// organization fail instead of silently returning everyone's data.
+//
+// The plugin only sees statements built from a model, so handlers have to pass the
+// request context with DB.WithContext and raw SQL is not covered.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	ErrNoOrganization    = errors.New("tenant-owned table used without an organization")
+	ErrWrongOrganization = errors.New("record belongs to another organization")
+)
+
+type organizationKey struct{}
+type unscopedKey struct{}
+
+// WithOrganization returns a copy of ctx scoped to the organization.
+func WithOrganization(ctx context.Context, id uint) context.Context {
+	return context.WithValue(ctx, organizationKey{}, id)
+}
+
+// FromContext returns the organization ctx is scoped to.
+func FromContext(ctx context.Context) (uint, bool) {
+	id, ok := ctx.Value(organizationKey{}).(uint)
+
+	return id, ok && id != 0
+}
+
+// Unscoped returns a copy of ctx that may touch every organization's data, for
+// background jobs and the like. Use it sparingly.
+func Unscoped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey{}, true)
+}
+
+// Owned is embedded in models whose rows belong to a single organization.
+type Owned struct {
+	OrganizationID uint `json:"organization_id" gorm:"index;not null"`
+}
+
+func (Owned) TenantOwned() {}
+
+type owned interface {
+	TenantOwned()
+}
+
+var ownedType = reflect.TypeOf((*owned)(nil)).Elem()
+
+// Plugin is the GORM plugin enforcing tenant scoping.
+type Plugin struct{}
+
+func (Plugin) Name() string {
+	return "tenant"
+}
+
+func (Plugin) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+
+	if err := callback.Create().Before("gorm:create").Register("tenant:create", assignOrganization); err != nil {
+		return err
+	}
+
+	if err := callback.Query().Before("gorm:query").Register("tenant:query", scopeToOrganization); err != nil {
+		return err
+	}
+
+	if err := callback.Row().Before("gorm:row").Register("tenant:row", scopeToOrganization); err != nil {
+		return err
+	}
+
+	if err := callback.Update().Before("gorm:update").Register("tenant:update", scopeUpdate); err != nil {
+		return err
+	}
+
+	return callback.Delete().Before("gorm:delete").Register("tenant:delete", scopeToOrganization)
+}
+
+// organization returns the organization field of a tenant-owned statement and the
+// organization to scope it to. ok is false when the statement must be left alone.
+func organization(db *gorm.DB) (field *schema.Field, id uint, ok bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil, 0, false
+	}
+
+	if !reflect.PointerTo(db.Statement.Schema.ModelType).Implements(ownedType) {
+		return nil, 0, false
+	}
+
+	if unscoped, _ := db.Statement.Context.Value(unscopedKey{}).(bool); unscoped {
+		return nil, 0, false
+	}
+
+	id, found := FromContext(db.Statement.Context)
+
+	if !found {
+		db.AddError(ErrNoOrganization)
+		return nil, 0, false
+	}
+
+	return db.Statement.Schema.LookUpField("OrganizationID"), id, true
+}
+
+// scope filters the statement by organization, returning the organization field if
+// it did.
+func scope(db *gorm.DB) (*schema.Field, bool) {
+	field, id, ok := organization(db)
+
+	if !ok {
+		return nil, false
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: id},
+	}})
+
+	return field, true
+}
+
+func scopeToOrganization(db *gorm.DB) {
+	scope(db)
+}
+
+func scopeUpdate(db *gorm.DB) {
+	// rows can't be moved to another organization either.
+	if field, ok := scope(db); ok {
+		db.Statement.Omits = append(db.Statement.Omits, field.DBName)
+	}
+}
+
+func assignOrganization(db *gorm.DB) {
+	field, id, ok := organization(db)
+
+	if !ok {
+		return
+	}
+
+	assign := func(value reflect.Value) {
+		current, zero := field.ValueOf(db.Statement.Context, value)
+
+		if zero {
+			if err := field.Set(db.Statement.Context, value, id); err != nil {
+				db.AddError(err)
+			}
+			return
+		}
+
+		if current.(uint) != id {
+			db.AddError(ErrWrongOrganization)
+		}
+	}
+
+	switch value := db.Statement.ReflectValue; value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			assign(reflect.Indirect(value.Index(i)))
+		}
+	case reflect.Struct:
+		assign(value)
+	}
+}
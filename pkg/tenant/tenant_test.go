@@ -0,0 +1,132 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const checkMark = "\u2713"
+const ballotX = "\u2717"
+
+type project struct {
+	gorm.Model
+	Owned
+	Name string
+}
+
+type country struct {
+	gorm.Model
+	Name string
+}
+
+// newDryRunDB builds SQL without ever connecting to a database.
+func newDryRunDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal("Should be able to open a dry run database.", ballotX, err)
+	}
+
+	if err := db.Use(Plugin{}); err != nil {
+		t.Fatal("Should be able to register the plugin.", ballotX, err)
+	}
+
+	return db
+}
+
+func TestPlugin(t *testing.T) {
+	db := newDryRunDB(t)
+	ctx := WithOrganization(context.Background(), 7)
+
+	t.Log("Given the need to test scoping queries to an organization.")
+	{
+		t.Log("\tWhen querying a tenant-owned table.")
+		{
+			var projects []project
+
+			stmt := db.WithContext(ctx).Where("name = ?", "zephyr").Find(&projects).Statement
+
+			if stmt.Error != nil || !strings.Contains(stmt.SQL.String(), `"projects"."organization_id" = $`) {
+				t.Errorf("\t\tShould filter by organization, but got %q %v. %v", stmt.SQL.String(), stmt.Error, ballotX)
+			}
+			t.Log("\t\tShould filter by organization.", checkMark)
+
+			if len(stmt.Vars) != 2 || stmt.Vars[1] != uint(7) {
+				t.Errorf("\t\tShould filter by the organization on the context, but got %v. %v", stmt.Vars, ballotX)
+			}
+			t.Log("\t\tShould filter by the organization on the context.", checkMark)
+		}
+
+		t.Log("\tWhen querying a tenant-owned table without an organization.")
+		{
+			var projects []project
+
+			if err := db.Find(&projects).Error; !errors.Is(err, ErrNoOrganization) {
+				t.Errorf("\t\tShould refuse the query, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould refuse the query.", checkMark)
+		}
+
+		t.Log("\tWhen querying a tenant-owned table on an unscoped context.")
+		{
+			var projects []project
+
+			stmt := db.WithContext(Unscoped(context.Background())).Find(&projects).Statement
+
+			if stmt.Error != nil || strings.Contains(stmt.SQL.String(), "organization_id") {
+				t.Errorf("\t\tShould not filter, but got %q %v. %v", stmt.SQL.String(), stmt.Error, ballotX)
+			}
+			t.Log("\t\tShould not filter.", checkMark)
+		}
+
+		t.Log("\tWhen querying a global table.")
+		{
+			var countries []country
+
+			stmt := db.Find(&countries).Statement
+
+			if stmt.Error != nil || strings.Contains(stmt.SQL.String(), "organization_id") {
+				t.Errorf("\t\tShould not filter, but got %q %v. %v", stmt.SQL.String(), stmt.Error, ballotX)
+			}
+			t.Log("\t\tShould not filter.", checkMark)
+		}
+
+		t.Log("\tWhen updating and deleting tenant-owned rows.")
+		{
+			update := db.WithContext(ctx).Model(&project{}).Where("id = ?", 1).Updates(map[string]interface{}{"name": "breeze", "organization_id": 8}).Statement
+
+			if update.Error != nil || !strings.Contains(update.SQL.String(), `"projects"."organization_id" = $`) || strings.Contains(update.SQL.String(), `SET "organization_id"`) {
+				t.Errorf("\t\tShould scope the update and keep the organization, but got %q %v. %v", update.SQL.String(), update.Error, ballotX)
+			}
+			t.Log("\t\tShould scope the update and keep the organization.", checkMark)
+
+			remove := db.WithContext(ctx).Delete(&project{}, 1).Statement
+
+			if remove.Error != nil || !strings.Contains(remove.SQL.String(), `"projects"."organization_id" = $`) {
+				t.Errorf("\t\tShould scope the delete, but got %q %v. %v", remove.SQL.String(), remove.Error, ballotX)
+			}
+			t.Log("\t\tShould scope the delete.", checkMark)
+		}
+
+		t.Log("\tWhen creating tenant-owned rows.")
+		{
+			p := project{Name: "zephyr"}
+
+			if err := db.WithContext(ctx).Create(&p).Error; err != nil || p.OrganizationID != 7 {
+				t.Errorf("\t\tShould stamp the organization, but got %d %v. %v", p.OrganizationID, err, ballotX)
+			}
+			t.Log("\t\tShould stamp the organization.", checkMark)
+
+			other := []project{{Name: "breeze", Owned: Owned{OrganizationID: 8}}}
+
+			if err := db.WithContext(ctx).Create(&other).Error; !errors.Is(err, ErrWrongOrganization) {
+				t.Errorf("\t\tShould refuse rows of another organization, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould refuse rows of another organization.", checkMark)
+		}
+	}
+}
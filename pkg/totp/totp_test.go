@@ -0,0 +1,114 @@
+package totp
+
+import (
+	"bytes"
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+const checkMark = "\u2713"
+const ballotX = "\u2717"
+
+// the SHA1 test vectors from RFC 6238, appendix B, truncated to 6 digits.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCode(t *testing.T) {
+	t.Log("Given the need to test generating codes.")
+	{
+		for _, v := range rfcVectors {
+			t.Logf("\tWhen checking the RFC 6238 vector at %d.", v.unix)
+			{
+				code, err := Code(rfcSecret, time.Unix(v.unix, 0))
+
+				if err != nil {
+					t.Fatal("\t\tShould be able to generate a code.", ballotX, err)
+				}
+
+				if code != v.code {
+					t.Errorf("\t\tShould generate %s, but got %s. %v", v.code, code, ballotX)
+				}
+				t.Logf("\t\tShould generate %s. %v", v.code, checkMark)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal("Should be able to generate a secret.", ballotX, err)
+	}
+
+	now := time.Now()
+
+	t.Log("Given the need to test validating codes.")
+	{
+		t.Log("\tWhen checking a code from the previous period.")
+		{
+			code, _ := Code(secret, now.Add(-Period*time.Second))
+
+			step, ok := Validate(secret, code, now)
+
+			if !ok || step != Step(now)-1 {
+				t.Errorf("\t\tShould accept it and report its step, but got %d %v. %v", step, ok, ballotX)
+			}
+			t.Log("\t\tShould accept it and report its step.", checkMark)
+		}
+
+		t.Log("\tWhen checking a code from too long ago.")
+		{
+			code, _ := Code(secret, now.Add(-3*Period*time.Second))
+
+			if _, ok := Validate(secret, code, now); ok {
+				t.Error("\t\tShould reject it.", ballotX)
+			}
+			t.Log("\t\tShould reject it.", checkMark)
+		}
+
+		t.Log("\tWhen checking malformed codes.")
+		{
+			for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+				if _, ok := Validate(secret, code, now); ok {
+					t.Errorf("\t\tShould reject %q. %v", code, ballotX)
+				}
+			}
+			t.Log("\t\tShould reject them.", checkMark)
+		}
+	}
+}
+
+func TestURI(t *testing.T) {
+	t.Log("Given the need to test enrolling authenticator apps.")
+	{
+		t.Log("\tWhen building the otpauth URI.")
+		{
+			uri := URI("Zephyr", "ade@example.com", "JBSWY3DPEHPK3PXP")
+
+			if !strings.HasPrefix(uri, "otpauth://totp/Zephyr:ade@example.com?") || !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") {
+				t.Errorf("\t\tShould have the label and secret, but got %s. %v", uri, ballotX)
+			}
+			t.Log("\t\tShould have the label and secret.", checkMark)
+
+			png, err := QRCode(uri, 256)
+
+			if err != nil || !bytes.HasPrefix(png, []byte("\x89PNG")) {
+				t.Errorf("\t\tShould encode it as a PNG QR code. %v", ballotX)
+			}
+			t.Log("\t\tShould encode it as a PNG QR code.", checkMark)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package webauthn
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var errCBOR = errors.New("malformed CBOR")
+
+const maxCBORDepth = 16
+
+// cborDecoder decodes the subset of CBOR (RFC 8949) used by authenticators:
+// integers, byte and text strings, arrays, maps, tags and simple values. Integers are
+// returned as int64, maps as map[interface{}]interface{}.
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// decodeCBOR decodes the first CBOR item of data and returns it along with the number
+// of bytes it took up.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	d := &cborDecoder{data: data}
+
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return v, d.pos, nil
+}
+
+func (d *cborDecoder) head() (byte, uint64, error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, errCBOR
+	}
+
+	b := d.data[d.pos]
+	d.pos++
+
+	major, info := b>>5, b&0x1f
+
+	var size int
+
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, fmt.Errorf("%w: unsupported additional information %d", errCBOR, info)
+	}
+
+	if len(d.data)-d.pos < size {
+		return 0, 0, errCBOR
+	}
+
+	var value uint64
+
+	for _, b := range d.data[d.pos : d.pos+size] {
+		value = value<<8 | uint64(b)
+	}
+	d.pos += size
+
+	return major, value, nil
+}
+
+func (d *cborDecoder) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errCBOR
+	}
+
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+
+	return b, nil
+}
+
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > maxCBORDepth {
+		return nil, fmt.Errorf("%w: nested too deeply", errCBOR)
+	}
+
+	start := d.pos
+
+	major, value, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if value > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return int64(value), nil
+	case 1:
+		if value > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return -1 - int64(value), nil
+	case 2:
+		b, err := d.bytes(value)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case 3:
+		b, err := d.bytes(value)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case 4:
+		// every item takes at least a byte, which bounds the allocation.
+		if value > uint64(len(d.data)-d.pos) {
+			return nil, errCBOR
+		}
+
+		items := make([]interface{}, value)
+
+		for i := range items {
+			if items[i], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case 5:
+		if value > uint64(len(d.data)-d.pos) {
+			return nil, errCBOR
+		}
+
+		m := make(map[interface{}]interface{}, value)
+
+		for i := uint64(0); i < value; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("%w: unsupported map key %T", errCBOR, key)
+			}
+
+			if m[key], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case 6:
+		// the tag itself carries no meaning for us.
+		return d.decode(depth + 1)
+	default:
+		info := d.data[start] & 0x1f
+
+		switch {
+		case info == 20:
+			return false, nil
+		case info == 21:
+			return true, nil
+		case info == 22, info == 23:
+			return nil, nil
+		case info == 26:
+			return float64(math.Float32frombits(uint32(value))), nil
+		case info == 27:
+			return math.Float64frombits(value), nil
+		default:
+			return nil, fmt.Errorf("%w: unsupported simple value %d", errCBOR, info)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+// Package webauthn implements the relying party side of the WebAuthn registration
+// and authentication ceremonies for passkeys and security keys. Only the "none"
+// attestation format is accepted: we care about the credential, not about which
+// authenticator model created it.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidResponse  = errors.New("invalid authenticator response")
+	ErrChallenge        = errors.New("challenge mismatch")
+	ErrOrigin           = errors.New("origin not allowed")
+	ErrRelyingParty     = errors.New("relying party ID mismatch")
+	ErrUserPresence     = errors.New("user presence not asserted")
+	ErrUserVerification = errors.New("user verification required")
+	ErrAttestation      = errors.New("unsupported attestation format")
+	ErrSignature        = errors.New("invalid signature")
+	ErrSignCount        = errors.New("signature counter did not increase, the authenticator may have been cloned")
+)
+
+// authenticator data flags.
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+	flagExtensionData    = 0x80
+)
+
+// Base64URL is binary data encoded as unpadded base64url in JSON, as WebAuthn
+// clients expect.
+type Base64URL []byte
+
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+
+	*b = decoded
+
+	return nil
+}
+
+// Config describes the relying party.
+type Config struct {
+	// RPID is the domain credentials are scoped to, e.g. "example.com".
+	RPID   string
+	RPName string
+	// Origins are the origins the ceremonies may be performed from, e.g.
+	// "https://app.example.com".
+	Origins []string
+	Timeout time.Duration
+}
+
+type RelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          Base64URL `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type string    `json:"type"`
+	ID   Base64URL `json:"id"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions is passed to navigator.credentials.create().
+type CreationOptions struct {
+	Challenge              Base64URL              `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	Attestation            string                 `json:"attestation"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+}
+
+// RequestOptions is passed to navigator.credentials.get().
+type RequestOptions struct {
+	Challenge        Base64URL              `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse is the JSON form of the PublicKeyCredential returned by
+// navigator.credentials.create().
+type RegistrationResponse struct {
+	ID       string    `json:"id"`
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AttestationObject Base64URL `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON form of the PublicKeyCredential returned by
+// navigator.credentials.get().
+type AssertionResponse struct {
+	ID       string    `json:"id"`
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AuthenticatorData Base64URL `json:"authenticatorData"`
+		Signature         Base64URL `json:"signature"`
+		UserHandle        Base64URL `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Credential is a newly registered credential.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// NewChallenge returns a random challenge.
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+func (c *Config) timeout() int64 {
+	if c.Timeout == 0 {
+		return (5 * time.Minute).Milliseconds()
+	}
+
+	return c.Timeout.Milliseconds()
+}
+
+// CreationOptions returns the options for registering a new credential for user,
+// excluding the credentials the user already has.
+func (c *Config) CreationOptions(challenge []byte, user UserEntity, existing [][]byte) *CreationOptions {
+	exclude := make([]CredentialDescriptor, len(existing))
+
+	for i, id := range existing {
+		exclude[i] = CredentialDescriptor{Type: "public-key", ID: id}
+	}
+
+	return &CreationOptions{
+		Challenge: challenge,
+		RP:        RelyingParty{ID: c.RPID, Name: c.RPName},
+		User:      user,
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:                c.timeout(),
+		Attestation:            "none",
+		ExcludeCredentials:     exclude,
+		AuthenticatorSelection: AuthenticatorSelection{ResidentKey: "preferred", UserVerification: "preferred"},
+	}
+}
+
+// RequestOptions returns the options for an assertion. allowed may be empty to let
+// the user pick any discoverable credential (passkey) for this relying party.
+func (c *Config) RequestOptions(challenge []byte, allowed [][]byte, userVerification string) *RequestOptions {
+	allow := make([]CredentialDescriptor, len(allowed))
+
+	for i, id := range allowed {
+		allow[i] = CredentialDescriptor{Type: "public-key", ID: id}
+	}
+
+	return &RequestOptions{
+		Challenge:        challenge,
+		RPID:             c.RPID,
+		Timeout:          c.timeout(),
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}
+}
+
+func (c *Config) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	var data clientData
+
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+
+	if data.Type != ceremony {
+		return fmt.Errorf("%w: unexpected client data type %q", ErrInvalidResponse, data.Type)
+	}
+
+	received, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(data.Challenge, "="))
+	if err != nil || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return ErrChallenge
+	}
+
+	for _, origin := range c.Origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %q", ErrOrigin, data.Origin)
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrInvalidResponse)
+	}
+
+	authData := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	rest := data[37:]
+
+	if authData.flags&flagAttestedCredData != 0 {
+		// AAGUID (16 bytes) followed by the credential ID length (2 bytes).
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data too short", ErrInvalidResponse)
+		}
+
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+
+		if len(rest) < idLength {
+			return nil, fmt.Errorf("%w: credential ID too short", ErrInvalidResponse)
+		}
+
+		authData.credentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+		}
+
+		authData.publicKey = rest[:n]
+		rest = rest[n:]
+	}
+
+	if authData.flags&flagExtensionData != 0 {
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+		}
+
+		rest = rest[n:]
+	}
+
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing authenticator data", ErrInvalidResponse)
+	}
+
+	return authData, nil
+}
+
+func (c *Config) verifyAuthenticatorData(authData *authenticatorData, requireUserVerification bool) error {
+	rpIDHash := sha256.Sum256([]byte(c.RPID))
+
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return ErrRelyingParty
+	}
+
+	if authData.flags&flagUserPresent == 0 {
+		return ErrUserPresence
+	}
+
+	if requireUserVerification && authData.flags&flagUserVerified == 0 {
+		return ErrUserVerification
+	}
+
+	return nil
+}
+
+// VerifyRegistration checks a registration response against the challenge that was
+// issued for it and returns the new credential.
+func (c *Config) VerifyRegistration(resp *RegistrationResponse, challenge []byte, requireUserVerification bool) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type %q", ErrInvalidResponse, resp.Type)
+	}
+
+	if err := c.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object is not a map", ErrInvalidResponse)
+	}
+
+	format, _ := attestation["fmt"].(string)
+	statement, _ := attestation["attStmt"].(map[interface{}]interface{})
+
+	if format != "none" || len(statement) != 0 {
+		return nil, fmt.Errorf("%w: %q", ErrAttestation, format)
+	}
+
+	rawAuthData, _ := attestation["authData"].([]byte)
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.verifyAuthenticatorData(authData, requireUserVerification); err != nil {
+		return nil, err
+	}
+
+	if authData.credentialID == nil || authData.publicKey == nil {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrInvalidResponse)
+	}
+
+	if !bytes.Equal(authData.credentialID, resp.RawID) {
+		return nil, fmt.Errorf("%w: credential ID mismatch", ErrInvalidResponse)
+	}
+
+	if _, err := parseCOSEKey(authData.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        append([]byte(nil), authData.credentialID...),
+		PublicKey: append([]byte(nil), authData.publicKey...),
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks an assertion made with the credential whose COSE public key
+// and last known signature counter are given. It returns the new signature counter.
+func (c *Config) VerifyAssertion(resp *AssertionResponse, challenge []byte, publicKey []byte, signCount uint32, requireUserVerification bool) (uint32, error) {
+	if resp.Type != "public-key" {
+		return 0, fmt.Errorf("%w: unexpected credential type %q", ErrInvalidResponse, resp.Type)
+	}
+
+	if err := c.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := parseAuthenticatorData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := c.verifyAuthenticatorData(authData, requireUserVerification); err != nil {
+		return 0, err
+	}
+
+	key, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), resp.Response.AuthenticatorData...), clientDataHash[:]...)
+
+	if !key.verify(signed, resp.Response.Signature) {
+		return 0, ErrSignature
+	}
+
+	// authenticators that don't keep a counter always report 0.
+	if (authData.signCount != 0 || signCount != 0) && authData.signCount <= signCount {
+		return 0, ErrSignCount
+	}
+
+	return authData.signCount, nil
+}
@@ -0,0 +1,328 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+)
+
+const checkMark = "\u2713"
+const ballotX = "\u2717"
+
+// encodeCBOR encodes the values the software authenticator needs.
+func encodeCBOR(v interface{}) []byte {
+	var buf bytes.Buffer
+
+	head := func(major byte, n uint64) {
+		switch {
+		case n < 24:
+			buf.WriteByte(major<<5 | byte(n))
+		case n <= 0xff:
+			buf.WriteByte(major<<5 | 24)
+			buf.WriteByte(byte(n))
+		case n <= 0xffff:
+			buf.WriteByte(major<<5 | 25)
+			binary.Write(&buf, binary.BigEndian, uint16(n))
+		default:
+			buf.WriteByte(major<<5 | 26)
+			binary.Write(&buf, binary.BigEndian, uint32(n))
+		}
+	}
+
+	switch v := v.(type) {
+	case int:
+		if v >= 0 {
+			head(0, uint64(v))
+		} else {
+			head(1, uint64(-1-v))
+		}
+	case []byte:
+		head(2, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		head(3, uint64(len(v)))
+		buf.WriteString(v)
+	case map[int]interface{}:
+		keys := make([]int, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Ints(keys)
+
+		head(5, uint64(len(v)))
+		for _, k := range keys {
+			buf.Write(encodeCBOR(k))
+			buf.Write(encodeCBOR(v[k]))
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		head(5, uint64(len(v)))
+		for _, k := range keys {
+			buf.Write(encodeCBOR(k))
+			buf.Write(encodeCBOR(v[k]))
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// softwareAuthenticator is a platform authenticator living in memory.
+type softwareAuthenticator struct {
+	rpID         string
+	origin       string
+	credentialID []byte
+	key          *ecdsa.PrivateKey
+	signCount    uint32
+	flags        byte
+}
+
+func newSoftwareAuthenticator(t *testing.T, rpID, origin string) *softwareAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Should be able to generate a credential key.", ballotX, err)
+	}
+
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+
+	return &softwareAuthenticator{rpID: rpID, origin: origin, credentialID: credentialID, key: key, flags: flagUserPresent | flagUserVerified}
+}
+
+func (a *softwareAuthenticator) cosePublicKey() []byte {
+	return encodeCBOR(map[int]interface{}{
+		1:  2,
+		3:  AlgES256,
+		-1: 1,
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+}
+
+func (a *softwareAuthenticator) authData(flags byte, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+
+	var buf bytes.Buffer
+	buf.Write(rpIDHash[:])
+	buf.WriteByte(flags)
+	binary.Write(&buf, binary.BigEndian, a.signCount)
+
+	if attested {
+		buf.Write(make([]byte, 16))
+		binary.Write(&buf, binary.BigEndian, uint16(len(a.credentialID)))
+		buf.Write(a.credentialID)
+		buf.Write(a.cosePublicKey())
+	}
+
+	return buf.Bytes()
+}
+
+func (a *softwareAuthenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    a.origin,
+	})
+
+	return data
+}
+
+func (a *softwareAuthenticator) create(challenge []byte, format string) *RegistrationResponse {
+	resp := &RegistrationResponse{ID: base64.RawURLEncoding.EncodeToString(a.credentialID), RawID: a.credentialID, Type: "public-key"}
+	resp.Response.ClientDataJSON = a.clientData("webauthn.create", challenge)
+	resp.Response.AttestationObject = encodeCBOR(map[string]interface{}{
+		"fmt":      format,
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(a.flags|flagAttestedCredData, true),
+	})
+
+	return resp
+}
+
+func (a *softwareAuthenticator) get(challenge []byte) *AssertionResponse {
+	a.signCount++
+
+	resp := &AssertionResponse{ID: base64.RawURLEncoding.EncodeToString(a.credentialID), RawID: a.credentialID, Type: "public-key"}
+	resp.Response.ClientDataJSON = a.clientData("webauthn.get", challenge)
+	resp.Response.AuthenticatorData = a.authData(a.flags, false)
+
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), resp.Response.AuthenticatorData...), clientDataHash[:]...))
+
+	resp.Response.Signature, _ = ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+
+	return resp
+}
+
+func TestRegistration(t *testing.T) {
+	config := &Config{RPID: "example.com", RPName: "Zephyr", Origins: []string{"https://app.example.com"}}
+
+	t.Log("Given the need to test registering credentials.")
+	{
+		t.Log("\tWhen registering with a valid response.")
+		{
+			authenticator := newSoftwareAuthenticator(t, "example.com", "https://app.example.com")
+			challenge, _ := NewChallenge()
+
+			credential, err := config.VerifyRegistration(authenticator.create(challenge, "none"), challenge, true)
+
+			if err != nil {
+				t.Fatal("\t\tShould accept the credential.", ballotX, err)
+			}
+			t.Log("\t\tShould accept the credential.", checkMark)
+
+			if !bytes.Equal(credential.ID, authenticator.credentialID) || !bytes.Equal(credential.PublicKey, authenticator.cosePublicKey()) {
+				t.Errorf("\t\tShould return the credential ID and public key. %v", ballotX)
+			}
+			t.Log("\t\tShould return the credential ID and public key.", checkMark)
+		}
+
+		tests := []struct {
+			name   string
+			mutate func(a *softwareAuthenticator, challenge []byte) (*RegistrationResponse, []byte)
+			err    error
+		}{
+			{"another challenge", func(a *softwareAuthenticator, challenge []byte) (*RegistrationResponse, []byte) {
+				other, _ := NewChallenge()
+				return a.create(other, "none"), challenge
+			}, ErrChallenge},
+			{"another origin", func(a *softwareAuthenticator, challenge []byte) (*RegistrationResponse, []byte) {
+				a.origin = "https://evil.example.net"
+				return a.create(challenge, "none"), challenge
+			}, ErrOrigin},
+			{"another relying party", func(a *softwareAuthenticator, challenge []byte) (*RegistrationResponse, []byte) {
+				a.rpID = "evil.example.net"
+				return a.create(challenge, "none"), challenge
+			}, ErrRelyingParty},
+			{"a packed attestation", func(a *softwareAuthenticator, challenge []byte) (*RegistrationResponse, []byte) {
+				return a.create(challenge, "packed"), challenge
+			}, ErrAttestation},
+			{"no user verification", func(a *softwareAuthenticator, challenge []byte) (*RegistrationResponse, []byte) {
+				a.flags = flagUserPresent
+				return a.create(challenge, "none"), challenge
+			}, ErrUserVerification},
+		}
+
+		for _, tt := range tests {
+			t.Logf("\tWhen registering with %s.", tt.name)
+			{
+				authenticator := newSoftwareAuthenticator(t, "example.com", "https://app.example.com")
+				challenge, _ := NewChallenge()
+
+				resp, expected := tt.mutate(authenticator, challenge)
+
+				if _, err := config.VerifyRegistration(resp, expected, true); !errors.Is(err, tt.err) {
+					t.Errorf("\t\tShould fail with %v, but got %v. %v", tt.err, err, ballotX)
+				}
+				t.Logf("\t\tShould fail with %v. %v", tt.err, checkMark)
+			}
+		}
+	}
+}
+
+func TestAssertion(t *testing.T) {
+	config := &Config{RPID: "example.com", RPName: "Zephyr", Origins: []string{"https://app.example.com"}}
+
+	authenticator := newSoftwareAuthenticator(t, "example.com", "https://app.example.com")
+	challenge, _ := NewChallenge()
+
+	credential, err := config.VerifyRegistration(authenticator.create(challenge, "none"), challenge, false)
+	if err != nil {
+		t.Fatal("Should be able to register the credential.", ballotX, err)
+	}
+
+	t.Log("Given the need to test asserting credentials.")
+	{
+		t.Log("\tWhen asserting with a valid response.")
+		{
+			challenge, _ := NewChallenge()
+
+			signCount, err := config.VerifyAssertion(authenticator.get(challenge), challenge, credential.PublicKey, credential.SignCount, true)
+
+			if err != nil {
+				t.Fatal("\t\tShould accept the assertion.", ballotX, err)
+			}
+			t.Log("\t\tShould accept the assertion.", checkMark)
+
+			if signCount != 1 {
+				t.Errorf("\t\tShould return the new signature counter, but got %d. %v", signCount, ballotX)
+			}
+			t.Log("\t\tShould return the new signature counter.", checkMark)
+
+			credential.SignCount = signCount
+		}
+
+		t.Log("\tWhen asserting with a tampered signature.")
+		{
+			challenge, _ := NewChallenge()
+
+			resp := authenticator.get(challenge)
+			resp.Response.Signature[len(resp.Response.Signature)-1] ^= 0xff
+
+			if _, err := config.VerifyAssertion(resp, challenge, credential.PublicKey, credential.SignCount, true); err == nil {
+				t.Error("\t\tShould reject the assertion.", ballotX)
+			}
+			t.Log("\t\tShould reject the assertion.", checkMark)
+		}
+
+		t.Log("\tWhen asserting with a counter that went backwards.")
+		{
+			challenge, _ := NewChallenge()
+
+			authenticator.signCount = 0
+
+			if _, err := config.VerifyAssertion(authenticator.get(challenge), challenge, credential.PublicKey, credential.SignCount, true); !errors.Is(err, ErrSignCount) {
+				t.Errorf("\t\tShould flag a possibly cloned authenticator, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould flag a possibly cloned authenticator.", checkMark)
+		}
+
+		t.Log("\tWhen asserting a registration response.")
+		{
+			challenge, _ := NewChallenge()
+
+			resp := authenticator.get(challenge)
+			resp.Response.ClientDataJSON = authenticator.clientData("webauthn.create", challenge)
+
+			if _, err := config.VerifyAssertion(resp, challenge, credential.PublicKey, credential.SignCount, true); !errors.Is(err, ErrInvalidResponse) {
+				t.Errorf("\t\tShould reject the ceremony type, but got %v. %v", err, ballotX)
+			}
+			t.Log("\t\tShould reject the ceremony type.", checkMark)
+		}
+	}
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	t.Log("Given the need to test decoding CBOR.")
+	{
+		t.Log("\tWhen decoding truncated or oversized input.")
+		{
+			inputs := [][]byte{
+				{},
+				{0x5a, 0xff, 0xff, 0xff, 0xff},
+				{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+				{0xa1, 0x01},
+				{0x1f},
+			}
+
+			for _, input := range inputs {
+				if _, _, err := decodeCBOR(input); err == nil {
+					t.Errorf("\t\tShould reject %x. %v", input, ballotX)
+				}
+			}
+			t.Log("\t\tShould reject them.", checkMark)
+		}
+	}
+}